@@ -1,23 +0,0 @@
-// feat(config): add TOML config support [2018-08-22 09:00:00]
-// fix(cli): resolve path issues [2018-08-29 09:00:00]
-// fix(cli): resolve path issues [2018-09-26 09:00:00]
-// test(image): add fuzz tests [2018-12-12 09:00:00]
-// test(core): add edge case coverage [2018-08-15 09:00:00]
-// test(image): add fuzz tests [2018-08-29 09:00:00]
-// feat(cli): support output to stdout [2018-12-12 09:00:00]
-// chore(build): add build script [2019-01-23 09:00:00]
-// fix(cli): resolve path issues [2019-05-15 09:00:00]
-// fix(log): fix broken logger format [2019-07-03 09:00:00]
-// feat(cli): support output to stdout [2019-07-17 09:00:00]
-// test(image): add fuzz tests [2018-08-22 09:00:00]
-// chore(build): add build script [2018-10-03 09:00:00]
-// docs(readme): update usage examples [2018-11-14 09:00:00]
-// refactor(utils): cleanup unused functions [2019-01-02 09:00:00]
-// feat(encoder): support png format [2019-02-06 09:00:00]
-// refactor(utils): cleanup unused functions [2019-04-03 09:00:00]
-// test(image): add fuzz tests [2019-05-22 09:00:00]
-// fix(cli): resolve path issues [2019-06-19 09:00:00]
-// feat(config): add TOML config support [2019-06-26 09:00:00]
-// feat(encoder): support png format [2019-07-10 09:00:00]
-// change 4 at 2017-11-28T16:00:00
-// update 4
@@ -0,0 +1,18 @@
+// Command imgpipe runs the imgpipe image operations from the shell.
+//
+//	imgpipe resize -w 800 -h 450 -mode fill in.jpg out.jpg
+//	cat in.jpg | imgpipe watermark -text "© {exif.Artist}" > out.jpg
+//	imgpipe info -json -palette 5 in.jpg
+//
+// Run "imgpipe help" for the full command list.
+package main
+
+import (
+	"os"
+
+	"github.com/HumbleLines/imgpipe/pkg/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}))
+}
@@ -0,0 +1,237 @@
+// Package adjust applies tonal and colour adjustments: brightness,
+// contrast, exposure, gamma, saturation, vibrance and hue rotation.
+package adjust
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithAdjust = "adjust"
+
+// Options declares the adjustments; the zero value changes nothing.
+// They are applied in the order listed.
+type Options struct {
+	Exposure   float64 // stops; +1 doubles the light, -1 halves it
+	Brightness float64 // -1~1, added to every channel
+	Contrast   float64 // -1~1, stretches around mid-grey; -1 = flat grey
+	Gamma      float64 // >1 brightens midtones, <1 darkens them; 0 = 1
+	Saturation float64 // -1~1; -1 = greyscale
+	Vibrance   float64 // -1~1; saturation that spares already vivid colours
+	Hue        float64 // hue rotation in degrees
+	Quality    int     // JPEG quality 1-100, 0 = 85; PNG input stays PNG
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports values outside the ranges above and a negative Gamma.
+// Without strict mode (see package validate) they are clamped, and a
+// negative Gamma counts as 1.
+func (opt Options) Validate() error {
+	return validate.First(
+		validate.Range("Brightness", opt.Brightness, -1, 1),
+		validate.Range("Contrast", opt.Contrast, -1, 1),
+		validate.NotNegative("Gamma", opt.Gamma),
+		validate.Range("Saturation", opt.Saturation, -1, 1),
+		validate.Range("Vibrance", opt.Vibrance, -1, 1),
+		validate.Quality(opt.quality()),
+	)
+}
+
+// quality is the JPEG quality to encode with.
+func (opt Options) quality() int {
+	if opt.Quality == 0 {
+		return 85
+	}
+	return opt.Quality
+}
+
+// defaultLogInfo builds a simple log line.
+func defaultLogInfo() string {
+	return fmt.Sprintf("adjust:done:image_at %s", time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// handlerAdjust returns a closure performing the adjustments per Options.
+// Any decodable pixel format is accepted; work happens on straight-alpha
+// NRGBA so transparent pixels keep their colour.
+func handlerAdjust(opt *Options) imageops.Handler {
+	invalid := opt.Policy.Check(actionWithAdjust, opt.Validate())
+	return imageops.Op("adjust", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		src, format, err := decode.Decode(in)
+		if err != nil {
+			return nil, err
+		}
+		img := Apply(src, *opt)
+
+		out := new(bytes.Buffer)
+		if format == "png" {
+			err = png.Encode(out, img)
+		} else {
+			err = jpeg.Encode(out, img, &jpeg.Options{Quality: max(1, min(100, opt.quality()))})
+		}
+		return out.Bytes(), imgerr.Encode(err)
+	})
+}
+
+// Handler returns the adjustment as a stage for imageops.Pipeline.
+func Handler(opt Options) imageops.Handler {
+	return handlerAdjust(&opt)
+}
+
+// Adjust wires normal log + adjustment pipeline.
+func Adjust(in []byte, opt Options) ([]byte, error) {
+	normalLog := &logger.MetaPayload{
+		Ob2: logger.LogInfo(actionWithAdjust, defaultLogInfo()),
+	}
+	_, _ = logger.LogMetaHandler(normalLog, nil)
+
+	return imageops.NewPipeline().
+		Add(handlerAdjust(&opt)).
+		Run(in)
+}
+
+// Apply adjusts a decoded image and returns a new NRGBA image.
+func Apply(src image.Image, opt Options) *image.NRGBA {
+	b := src.Bounds()
+	dst := image.NewNRGBA(b)
+	parallel.Rows(b, func(band image.Rectangle) {
+		draw.Draw(dst, band, src, band.Min, draw.Src)
+	})
+
+	lut := toneCurve(opt)
+	mat, colour := colourMatrix(opt.Saturation, opt.Hue)
+	vib := clamp(opt.Vibrance, -1, 1)
+	colour = colour || vib != 0
+
+	parallel.Rows(b, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			row := dst.Pix[dst.PixOffset(band.Min.X, y):dst.PixOffset(band.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				p := row[i : i+3 : i+3]
+				p[0], p[1], p[2] = lut[p[0]], lut[p[1]], lut[p[2]]
+				if colour {
+					mix(p, &mat, vib)
+				}
+			}
+		}
+	})
+	return dst
+}
+
+// toneCurve folds the per-channel adjustments into one lookup table.
+func toneCurve(opt Options) [256]uint8 {
+	gain := math.Exp2(opt.Exposure)
+	bright := clamp(opt.Brightness, -1, 1)
+	c := clamp(opt.Contrast, -1, 0.99)
+	slope := 1 + c // -1 -> 0 (flat), 0 -> 1
+	if c > 0 {
+		slope = 1 / (1 - c)
+	}
+	gamma := opt.Gamma
+	if gamma <= 0 {
+		gamma = 1
+	}
+
+	var lut [256]uint8
+	for i := range lut {
+		v := float64(i) / 255
+		if gain != 1 {
+			v = toSRGB(toLinear(v) * gain)
+		}
+		v += bright
+		v = (v-0.5)*slope + 0.5
+		if gamma != 1 {
+			v = math.Pow(clamp(v, 0, 1), 1/gamma)
+		}
+		lut[i] = to8(v)
+	}
+	return lut
+}
+
+// luma weights of the CSS saturate/hue-rotate filter matrices
+const lr, lg, lb = 0.213, 0.715, 0.072
+
+// colourMatrix combines saturation and hue rotation into one 3x3 matrix
+// that keeps luma constant. ok is false when it is the identity.
+func colourMatrix(saturation, hue float64) (m [3][3]float64, ok bool) {
+	s := 1 + clamp(saturation, -1, 1)
+	sat := [3][3]float64{
+		{lr + (1-lr)*s, lg - lg*s, lb - lb*s},
+		{lr - lr*s, lg + (1-lg)*s, lb - lb*s},
+		{lr - lr*s, lg - lg*s, lb + (1-lb)*s},
+	}
+	sin, cos := math.Sincos(hue * math.Pi / 180)
+	rot := [3][3]float64{
+		{lr + cos*(1-lr) - sin*lr, lg - cos*lg - sin*lg, lb - cos*lb + sin*(1-lb)},
+		{lr - cos*lr + sin*0.143, lg + cos*(1-lg) + sin*0.140, lb - cos*lb - sin*0.283},
+		{lr - cos*lr - sin*(1-lr), lg - cos*lg + sin*lg, lb + cos*(1-lb) + sin*lb},
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += rot[i][k] * sat[k][j]
+			}
+		}
+	}
+	return m, s != 1 || math.Mod(hue, 360) != 0
+}
+
+// mix applies the colour matrix and vibrance to one pixel.
+func mix(p []uint8, m *[3][3]float64, vib float64) {
+	r, g, b := float64(p[0])/255, float64(p[1])/255, float64(p[2])/255
+	r, g, b = m[0][0]*r+m[0][1]*g+m[0][2]*b,
+		m[1][0]*r+m[1][1]*g+m[1][2]*b,
+		m[2][0]*r+m[2][1]*g+m[2][2]*b
+	if vib != 0 {
+		// scale chroma, less for colours that are already saturated
+		hi := math.Max(r, math.Max(g, b))
+		lo := math.Min(r, math.Min(g, b))
+		k := 1 + vib*(1-(hi-lo))
+		l := lr*r + lg*g + lb*b
+		r, g, b = l+(r-l)*k, l+(g-l)*k, l+(b-l)*k
+	}
+	p[0], p[1], p[2] = to8(r), to8(g), to8(b)
+}
+
+// ---- helpers ----
+
+func toLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func toSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func to8(v float64) uint8 {
+	return uint8(clamp(v, 0, 1)*255 + 0.5)
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
@@ -0,0 +1,354 @@
+// Package batch runs a pipeline over many files: it walks input
+// directories and glob patterns, processes files on a bounded worker pool,
+// names outputs from a template, skips outputs that are already up to
+// date, records progress in a journal so an interrupted run can resume,
+// and reports a Summary.
+package batch
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/fsutil"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithBatch = "batch"
+
+// Options declares what to process and how.
+type Options struct {
+	// Inputs are directories (walked recursively, skipping hidden ones and
+	// the output tree), glob patterns or files.
+	Inputs []string
+	// Extensions limits the files taken from directories and globs
+	// (case-insensitive, with the dot); nil -> .jpg, .jpeg and .png.
+	// Files named directly in Inputs are always taken.
+	Extensions []string
+
+	// Output is the naming template for output paths, see Template.
+	Output string
+	// Handler is the pipeline run on every file.
+	Handler imageops.Handler `json:"-"`
+	// Workers bounds concurrent files; 0 -> runtime.GOMAXPROCS(0).
+	Workers int
+
+	// Force reprocesses files whose output is newer than the input.
+	Force bool
+	// Journal is a progress file; files it lists as done are skipped, so
+	// rerunning an interrupted batch with the same Journal resumes it.
+	// Empty disables journalling.
+	Journal string
+
+	// OnResult, when set, is called after every file (never concurrently).
+	OnResult func(Result) `json:"-"`
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Status is the outcome for one file.
+type Status string
+
+const (
+	StatusOK      Status = "ok"      // processed and written
+	StatusFailed  Status = "failed"  // read, pipeline or write error
+	StatusSkipped Status = "skipped" // output already up to date
+	StatusResumed Status = "resumed" // done in an earlier run, per the journal
+)
+
+// Result describes one file; it is also the journal record.
+type Result struct {
+	Input    string `json:"input"`
+	Output   string `json:"output,omitempty"`
+	Status   Status `json:"status"`
+	BytesIn  int64  `json:"bytes_in,omitempty"`
+	BytesOut int64  `json:"bytes_out,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Failure names a file that could not be processed.
+type Failure struct {
+	Input string `json:"input"`
+	Error string `json:"error"`
+}
+
+// Summary totals a run. BytesSaved is BytesIn - BytesOut over the files
+// processed in this run; it is negative when outputs grew.
+type Summary struct {
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Seconds    float64   `json:"seconds"`
+	Total      int       `json:"total"`
+	Succeeded  int       `json:"succeeded"`
+	Failed     int       `json:"failed"`
+	Skipped    int       `json:"skipped"`
+	Resumed    int       `json:"resumed"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	BytesSaved int64     `json:"bytes_saved"`
+	Failures   []Failure `json:"failures,omitempty"` // the first MaxFailures of Failed
+	// Interrupted is set when the context was cancelled before every file
+	// was processed; the journal lets a rerun pick up from there.
+	Interrupted bool `json:"interrupted,omitempty"`
+}
+
+// MaxFailures bounds Summary.Failures; Summary.Failed counts every failure.
+const MaxFailures = 100
+
+func defaultLogInfo() string {
+	return fmt.Sprintf("batch:start:at %s", time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// Validate reports a missing Handler or Inputs, an invalid Output
+// template and negative Workers. Without strict mode (see package
+// validate) negative Workers mean runtime.GOMAXPROCS(0); the rest fail.
+func (opt Options) Validate() error {
+	if err := opt.check(); err != nil {
+		return err
+	}
+	if _, err := ParseTemplate(opt.Output); err != nil {
+		return imgerr.Mark(imgerr.ErrInvalidOptions, err)
+	}
+	return validate.NotNegative("Workers", opt.Workers)
+}
+
+// check reports the options Run cannot start with.
+func (opt Options) check() error {
+	if opt.Handler == nil {
+		return imgerr.Mark(imgerr.ErrInvalidOptions, errors.New("batch: no handler"))
+	}
+	if len(opt.Inputs) == 0 {
+		return imgerr.Mark(imgerr.ErrInvalidOptions, errors.New("batch: no inputs"))
+	}
+	return nil
+}
+
+// Run processes every input file and returns the summary. Failures of
+// single files are counted, not returned; the error is reserved for
+// problems with the run itself (bad options, unreadable journal, a walk
+// error) and for cancellation of ctx, in which case the summary covers the
+// files finished so far.
+func Run(ctx context.Context, opt Options) (*Summary, error) {
+	normalLog := &logger.MetaPayload{
+		Ob2: logger.LogInfo(actionWithBatch, defaultLogInfo()),
+	}
+	_, _ = logger.LogMetaHandler(normalLog, nil)
+
+	if err := opt.check(); err != nil {
+		return nil, err
+	}
+	if err := opt.Policy.Check(actionWithBatch, opt.Validate()); err != nil {
+		return nil, err
+	}
+	tmpl, err := ParseTemplate(opt.Output)
+	if err != nil {
+		return nil, err
+	}
+	workers := opt.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	var j *journal
+	if opt.Journal != "" {
+		if j, err = openJournal(opt.Journal); err != nil {
+			return nil, err
+		}
+		defer j.close()
+	}
+
+	sum := &Summary{Started: time.Now()}
+	var mu sync.Mutex // guards sum, opt.OnResult and the journal
+	record := func(r Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		sum.add(r)
+		if j != nil && r.Status != StatusResumed {
+			j.write(r)
+		}
+		if opt.OnResult != nil {
+			opt.OnResult(r)
+		}
+	}
+
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for jb := range jobs {
+				record(process(jb, opt))
+			}
+		}()
+	}
+
+	var inputs map[pathKey]bool // to drop files named by several inputs
+	if overlapping(opt.Inputs) {
+		inputs = map[pathKey]bool{}
+	}
+	seen := map[string]string{} // output -> input, to catch template collisions
+	walkErr := walk(ctx, opt.Inputs, extensions(opt.Extensions), tmpl.Root(), func(f file) error {
+		if abs, err := filepath.Abs(f.path); err == nil && inputs != nil {
+			k := keyOf(abs)
+			if inputs[k] {
+				return nil
+			}
+			inputs[k] = true
+		}
+		out := tmpl.Render(f)
+		if prev := seen[out]; prev != "" {
+			record(Result{Input: f.path, Output: out, Status: StatusFailed,
+				Error: fmt.Sprintf("output %s is also the output of %s", out, prev)})
+			return nil
+		}
+		seen[out] = f.path
+		if j != nil && j.done(f.path) {
+			record(Result{Input: f.path, Output: out, Status: StatusResumed})
+			return nil
+		}
+		select {
+		case jobs <- job{in: f.path, out: out}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(jobs)
+	wg.Wait()
+
+	sum.Finished = time.Now()
+	sum.Seconds = sum.Finished.Sub(sum.Started).Seconds()
+	if j != nil {
+		if err := j.err(); err != nil && walkErr == nil {
+			walkErr = err
+		}
+	}
+	if errors.Is(walkErr, context.Canceled) || errors.Is(walkErr, context.DeadlineExceeded) {
+		sum.Interrupted = true
+	}
+	return sum, walkErr
+}
+
+type job struct{ in, out string }
+
+// overlapping reports whether two inputs may name the same file: one lies
+// within the other, taking a glob from its directory part. Only then does
+// Run have to remember every input it has seen.
+func overlapping(inputs []string) bool {
+	roots := make([]string, 0, len(inputs))
+	for _, in := range inputs {
+		if i := strings.IndexAny(in, "*?["); i >= 0 {
+			in = filepath.Dir(in[:i+1])
+		}
+		abs, err := filepath.Abs(in)
+		if err != nil {
+			return true
+		}
+		roots = append(roots, abs)
+	}
+	for i, a := range roots {
+		for _, b := range roots[:i] {
+			if within(a, b) || within(b, a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// within reports whether p is root or lies below it.
+func within(p, root string) bool {
+	r, err := filepath.Rel(root, p)
+	return err == nil && filepath.IsLocal(r)
+}
+
+// pathKey stands in for a path in the sets kept per file, so a run over
+// millions of files does not hold on to every path string.
+type pathKey [16]byte
+
+func keyOf(p string) pathKey {
+	sum := sha256.Sum256([]byte(p))
+	return pathKey(sum[:16])
+}
+
+func process(jb job, opt Options) Result {
+	r := Result{Input: jb.in, Output: jb.out}
+	fail := func(err error) Result {
+		r.Status, r.Error = StatusFailed, err.Error()
+		return r
+	}
+	if sameFile(jb.in, jb.out) {
+		return fail(errors.New("output would overwrite the input"))
+	}
+	if !opt.Force && upToDate(jb.in, jb.out) {
+		r.Status = StatusSkipped
+		return r
+	}
+	in, err := os.ReadFile(jb.in)
+	if err != nil {
+		return fail(err)
+	}
+	r.BytesIn = int64(len(in))
+	out, err := opt.Handler(in)
+	if err != nil {
+		return fail(err)
+	}
+	if err := fsutil.WriteFile(jb.out, out); err != nil {
+		return fail(err)
+	}
+	r.Status, r.BytesOut = StatusOK, int64(len(out))
+	return r
+}
+
+// upToDate reports whether out exists and is not older than in.
+func upToDate(in, out string) bool {
+	si, err := os.Stat(in)
+	if err != nil {
+		return false
+	}
+	so, err := os.Stat(out)
+	return err == nil && !so.ModTime().Before(si.ModTime())
+}
+
+func sameFile(a, b string) bool {
+	sa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	sb, err := os.Stat(b)
+	return err == nil && os.SameFile(sa, sb)
+}
+
+func (s *Summary) add(r Result) {
+	s.Total++
+	switch r.Status {
+	case StatusOK:
+		s.Succeeded++
+		s.BytesIn += r.BytesIn
+		s.BytesOut += r.BytesOut
+		s.BytesSaved = s.BytesIn - s.BytesOut
+	case StatusFailed:
+		s.Failed++
+		if len(s.Failures) < MaxFailures {
+			s.Failures = append(s.Failures, Failure{Input: r.Input, Error: r.Error})
+		}
+	case StatusSkipped:
+		s.Skipped++
+	case StatusResumed:
+		s.Resumed++
+	}
+}
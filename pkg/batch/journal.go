@@ -0,0 +1,74 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// journal is an append-only file of JSON Result lines, one per finished
+// file. Each line is written with a single write call, so a crash loses at
+// most the line being written; a torn last line is ignored when reading.
+type journal struct {
+	f     *os.File
+	seen  map[pathKey]bool // inputs finished (ok or up to date) in earlier runs
+	first error            // first write error
+}
+
+func openJournal(path string) (*journal, error) {
+	j := &journal{seen: map[pathKey]bool{}}
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		for sc.Scan() {
+			var r Result
+			if json.Unmarshal(sc.Bytes(), &r) != nil {
+				continue
+			}
+			switch r.Status {
+			case StatusOK, StatusSkipped:
+				j.seen[keyOf(r.Input)] = true
+			case StatusFailed:
+				delete(j.seen, keyOf(r.Input)) // retried and failed again after all
+			}
+		}
+		err := sc.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("batch: journal %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("batch: journal: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("batch: journal: %w", err)
+	}
+	j.f = f
+	return j, nil
+}
+
+func (j *journal) done(input string) bool { return j.seen[keyOf(input)] }
+
+func (j *journal) write(r Result) {
+	if j.first != nil {
+		return
+	}
+	b, err := json.Marshal(r)
+	if err == nil {
+		_, err = j.f.Write(append(b, '\n'))
+	}
+	if err != nil {
+		j.first = fmt.Errorf("batch: journal: %w", err)
+	}
+}
+
+func (j *journal) err() error { return j.first }
+
+func (j *journal) close() {
+	if err := j.f.Close(); err != nil && j.first == nil {
+		j.first = err
+	}
+}
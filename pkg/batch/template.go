@@ -0,0 +1,74 @@
+package batch
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Template names output files. Placeholders describe the input relative
+// to the directory it was found in (for a glob or a plain file, the
+// directory holding it):
+//
+//	{path}  relative path without extension   2024/06/beach
+//	{dir}   relative directory ("." at top)   2024/06
+//	{name}  file name without extension       beach
+//	{ext}   extension without the dot         jpg
+//
+// e.g. "out/{path}_800.jpg" mirrors the input tree under out/.
+type Template struct {
+	raw string
+}
+
+var placeholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ParseTemplate checks a naming template.
+func ParseTemplate(s string) (Template, error) {
+	if s == "" {
+		return Template{}, fmt.Errorf("batch: empty output template")
+	}
+	for _, m := range placeholder.FindAllString(s, -1) {
+		switch m {
+		case "{path}", "{dir}", "{name}", "{ext}":
+		default:
+			return Template{}, fmt.Errorf("batch: unknown placeholder %s in %q (want {path}, {dir}, {name} or {ext})", m, s)
+		}
+	}
+	if !strings.Contains(s, "{path}") && !strings.Contains(s, "{name}") {
+		return Template{}, fmt.Errorf("batch: output template %q needs {path} or {name}, or every file gets the same name", s)
+	}
+	return Template{raw: s}, nil
+}
+
+// Render returns the output path for f.
+func (t Template) Render(f file) string {
+	rel := filepath.ToSlash(f.rel)
+	ext := filepath.Ext(rel)
+	stem := strings.TrimSuffix(rel, ext)
+	dir := pathDir(stem)
+	r := strings.NewReplacer(
+		"{path}", stem,
+		"{dir}", dir,
+		"{name}", stem[strings.LastIndexByte(stem, '/')+1:],
+		"{ext}", strings.ToLower(strings.TrimPrefix(ext, ".")),
+	)
+	return filepath.Clean(filepath.FromSlash(r.Replace(t.raw)))
+}
+
+// Root returns the fixed directory part of the template (everything
+// before the first placeholder), e.g. "out" for "out/{path}.jpg".
+func (t Template) Root() string {
+	prefix := t.raw[:strings.IndexByte(t.raw, '{')]
+	if prefix == "" || strings.HasSuffix(prefix, "/") || strings.HasSuffix(prefix, string(filepath.Separator)) {
+		return filepath.Clean(prefix + ".")
+	}
+	return filepath.Dir(prefix)
+}
+
+func pathDir(p string) string {
+	if i := strings.LastIndexByte(p, '/'); i >= 0 {
+		return p[:i]
+	}
+	return "."
+}
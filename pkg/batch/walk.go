@@ -0,0 +1,105 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// file is one input: its path as found and its path relative to the
+// directory it was found in (what the naming template sees).
+type file struct {
+	path, rel string
+}
+
+func extensions(list []string) map[string]bool {
+	if len(list) == 0 {
+		list = []string{".jpg", ".jpeg", ".png"}
+	}
+	m := make(map[string]bool, len(list))
+	for _, e := range list {
+		e = strings.ToLower(e)
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		m[e] = true
+	}
+	return m
+}
+
+// walk streams the files of every input to fn, in lexical order per
+// input, without collecting them first. Hidden directories are skipped, as
+// is the directory exclude (the output tree, so earlier outputs are not
+// taken for inputs) unless it is the input directory itself.
+func walk(ctx context.Context, inputs []string, exts map[string]bool, exclude string, fn func(file) error) error {
+	exclude, _ = filepath.Abs(exclude)
+	for _, in := range inputs {
+		matches := []string{in}
+		glob := strings.ContainsAny(in, "*?[")
+		if glob {
+			var err error
+			if matches, err = filepath.Glob(in); err != nil {
+				return fmt.Errorf("batch: %s: %w", in, err)
+			}
+			sort.Strings(matches)
+		}
+		for _, m := range matches {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			st, err := os.Stat(m)
+			if err != nil {
+				return fmt.Errorf("batch: %w", err)
+			}
+			if !st.IsDir() {
+				if glob && !exts[strings.ToLower(filepath.Ext(m))] {
+					continue
+				}
+				if err := fn(file{path: m, rel: filepath.Base(m)}); err != nil {
+					return err
+				}
+				continue
+			}
+			root := m
+			err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if d.IsDir() {
+					if p == root {
+						return nil
+					}
+					if strings.HasPrefix(d.Name(), ".") {
+						return filepath.SkipDir
+					}
+					if abs, _ := filepath.Abs(p); abs == exclude {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !d.Type().IsRegular() || !exts[strings.ToLower(filepath.Ext(p))] {
+					return nil
+				}
+				rel, err := filepath.Rel(root, p)
+				if err != nil {
+					return err
+				}
+				return fn(file{path: p, rel: rel})
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("batch: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -2,16 +2,19 @@ package border
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/jpeg"
+	"image/png"
 	"time"
 
+	"github.com/HumbleLines/imgpipe/pkg/decode"
 	"github.com/HumbleLines/imgpipe/pkg/imageops"
-	"github.com/HumbleLines/imgpipe/pkg/stego"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/mask"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
 	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
 )
 
@@ -28,12 +31,101 @@ const (
 	Outset
 )
 
+// Limits on the corner and shadow sizes; the canvas grows with the shadow,
+// so Validate rejects larger values and the fallback clamps them.
+const (
+	MaxRadius       = 4096
+	MaxShadowBlur   = mask.MaxBlur
+	MaxShadowOffset = 4096
+)
+
 // Options configures border style and output encoding.
 type Options struct {
 	Mode      Mode
 	Thickness int        // pixels
 	Color     color.RGBA // border color
 	Quality   int        // jpeg quality
+
+	ColorFrom ColorSource // derive Color from the image instead of using it as given
+
+	Sides    Sides       // per-side thickness; overrides Thickness when set
+	Radius   int         // outer corner radius in pixels; corners become transparent
+	Gradient *Gradient   // gradient fill; overrides Color
+	Pattern  image.Image // tiled image fill; overrides Gradient and Color
+	Shadow   *Shadow     // outer drop shadow; grows the canvas
+
+	// Format is "png" or "jpeg". Empty picks PNG when Radius or Shadow leave
+	// transparent areas, JPEG otherwise. JPEG output flattens them onto
+	// Background (white when zero).
+	Format     string
+	Background color.RGBA
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports an unknown mode, colour source, gradient or format,
+// negative sizes, a Radius or Shadow above the limits and a border wider
+// or taller on its own than the current decode limits allow (see
+// CheckSize for the whole output). Without strict mode (see package
+// validate) an unknown mode re-encodes the image without a border, a
+// Thickness below 1 counts as 1, negative Sides as 0 and a Radius or
+// Shadow above the limits is clamped to them.
+func (opt Options) Validate() error {
+	if opt.Mode != Inset && opt.Mode != Outset {
+		return imgerr.Invalid("Mode", "unknown mode %d", opt.Mode)
+	}
+	if opt.ColorFrom < ColorFixed || opt.ColorFrom > ColorAccent {
+		return imgerr.Invalid("ColorFrom", "unknown colour source %d", opt.ColorFrom)
+	}
+	if opt.Sides.isZero() {
+		if err := validate.Positive("Thickness", opt.Thickness); err != nil {
+			return err
+		}
+	} else if s := opt.Sides; s.Top < 0 || s.Right < 0 || s.Bottom < 0 || s.Left < 0 {
+		return imgerr.Invalid("Sides", "must not be negative, got %+v", s)
+	}
+	field := "Thickness"
+	if !opt.Sides.isZero() {
+		field = "Sides"
+	}
+	sd, l := opt.sides(), decode.CurrentLimits()
+	if w := int64(sd.Left) + int64(sd.Right); l.MaxWidth > 0 && w > int64(l.MaxWidth) {
+		return imgerr.Invalid(field, "left and right add up to %d, past the width limit of %d", w, l.MaxWidth)
+	}
+	if h := int64(sd.Top) + int64(sd.Bottom); l.MaxHeight > 0 && h > int64(l.MaxHeight) {
+		return imgerr.Invalid(field, "top and bottom add up to %d, past the height limit of %d", h, l.MaxHeight)
+	}
+	if err := validate.NotNegative("Radius", opt.Radius); err != nil {
+		return err
+	}
+	if opt.Radius > MaxRadius {
+		return imgerr.Invalid("Radius", "must be at most %d, got %d", MaxRadius, opt.Radius)
+	}
+	if s := opt.Shadow; s != nil {
+		if err := validate.NotNegative("Shadow.Blur", s.Blur); err != nil {
+			return err
+		}
+		if s.Blur > MaxShadowBlur {
+			return imgerr.Invalid("Shadow.Blur", "must be at most %d, got %d", MaxShadowBlur, s.Blur)
+		}
+		if s.OffsetX < -MaxShadowOffset || s.OffsetX > MaxShadowOffset ||
+			s.OffsetY < -MaxShadowOffset || s.OffsetY > MaxShadowOffset {
+			return imgerr.Invalid("Shadow", "offset must be within ±%d, got %d,%d", MaxShadowOffset, s.OffsetX, s.OffsetY)
+		}
+	}
+	if g := opt.Gradient; g != nil && g.Kind != Linear && g.Kind != Radial {
+		return imgerr.Invalid("Gradient.Kind", "unknown gradient kind %d", g.Kind)
+	}
+	switch opt.Format {
+	case "png":
+		return nil
+	case "", "jpeg", "jpg":
+	default:
+		return imgerr.Invalid("Format", "unsupported format %q (want png or jpeg)", opt.Format)
+	}
+	return validate.Quality(opt.Quality)
 }
 
 func defaultLogInfo() string {
@@ -41,64 +133,117 @@ func defaultLogInfo() string {
 }
 
 func handlerBorder(opt *Options) imageops.Handler {
-	return func(in []byte) ([]byte, error) {
-		src, _, err := image.Decode(bytes.NewReader(in))
+	invalid := opt.Policy.Check(actionWithBorder, opt.Validate())
+	return imageops.Op("border", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		src, _, err := decode.Decode(in)
 		if err != nil {
 			return nil, err
 		}
-		sb := src.Bounds()
-		sw, sh := sb.Dx(), sb.Dy()
-		t := max(1, opt.Thickness)
-
-		var dst *image.RGBA
-		switch opt.Mode {
-		case Inset:
-			// same size; draw source then stroke inside
-			dst = image.NewRGBA(sb)
-			draw.Draw(dst, sb, src, sb.Min, draw.Src)
-			drawInsetRect(dst, sb, t, opt.Color)
-		case Outset:
-			// enlarge canvas; paint border background color; center original
-			dst = image.NewRGBA(image.Rect(0, 0, sw+2*t, sh+2*t))
-			// fill background with border color
-			draw.Draw(dst, dst.Bounds(), &image.Uniform{C: opt.Color}, image.Point{}, draw.Src)
-			// draw original centered (offset by t)
-			off := image.Pt(t, t)
-			draw.Draw(dst, image.Rectangle{Min: off, Max: off.Add(image.Pt(sw, sh))}, src, sb.Min, draw.Over)
-		default:
-			// fallback: just re-encode source
-			dst = image.NewRGBA(sb)
-			draw.Draw(dst, sb, src, sb.Min, draw.Src)
+		if err := CheckSize(src.Bounds().Size(), *opt); err != nil {
+			return nil, err
 		}
+		return Encode(Apply(src, *opt), *opt)
+	})
+}
 
-		buf := new(bytes.Buffer)
-		if err := jpeg.Encode(buf, dst, &jpeg.Options{Quality: clamp(opt.Quality, 1, 100)}); err != nil {
-			return nil, err
+// CheckSize reports, as a *decode.LimitError, an output past the current
+// decode limits for a source of the given size: the outset border and the
+// shadow grow the canvas. Call it before Apply on untrusted options.
+func CheckSize(src image.Point, opt Options) error {
+	w, h := int64(src.X), int64(src.Y)
+	if opt.Mode == Outset {
+		sd := opt.sides()
+		w += int64(sd.Left) + int64(sd.Right)
+		h += int64(sd.Top) + int64(sd.Bottom)
+	}
+	if s := opt.Shadow; s != nil {
+		dx, dy, pad := s.offset()
+		w += int64(max(0, pad-dx) + max(0, pad+dx))
+		h += int64(max(0, pad-dy) + max(0, pad+dy))
+	}
+	return decode.CurrentLimits().CheckSize(w, h)
+}
+
+// Apply draws the border around a decoded image per Options. Corners cut
+// by Radius and the area around a Shadow stay transparent; Encode
+// flattens them when the output is JPEG.
+func Apply(src image.Image, opt Options) *image.RGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	sd := opt.sides()
+	o := opt.withColorFrom(src)
+
+	var dst *image.RGBA
+	switch o.Mode {
+	case Inset:
+		// same size; draw source then stroke inside
+		dst = image.NewRGBA(image.Rect(0, 0, sw, sh))
+		draw.Draw(dst, dst.Bounds(), src, sb.Min, draw.Src)
+		drawInsetRect(dst, dst.Bounds(), sd, o.paint(dst.Bounds()))
+	case Outset:
+		// enlarge canvas; paint border background; place original inside
+		dst = image.NewRGBA(image.Rect(0, 0, sw+sd.Left+sd.Right, sh+sd.Top+sd.Bottom))
+		draw.Draw(dst, dst.Bounds(), o.paint(dst.Bounds()), image.Point{}, draw.Src)
+		off := image.Pt(sd.Left, sd.Top)
+		draw.Draw(dst, image.Rectangle{Min: off, Max: off.Add(image.Pt(sw, sh))}, src, sb.Min, draw.Over)
+	default:
+		// fallback: just re-encode source (see Validate)
+		dst = image.NewRGBA(sb)
+		draw.Draw(dst, sb, src, sb.Min, draw.Src)
+		return dst
+	}
+	if o.Radius > 0 {
+		dst = roundCorners(dst, min(o.Radius, MaxRadius))
+	}
+	if o.Shadow != nil {
+		dst = withShadow(dst, o.Shadow)
+	}
+	return dst
+}
+
+// Encode writes a result of Apply in the format Options select.
+func Encode(img *image.RGBA, opt Options) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	format := opt.Format
+	if format == "" && opt.transparent() {
+		format = "png"
+	}
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(buf, img)
+	default:
+		if opt.transparent() {
+			bg := opt.Background
+			if bg == (color.RGBA{}) {
+				bg = color.RGBA{R: 255, G: 255, B: 255}
+			}
+			img = flatten(img, bg)
 		}
-		return buf.Bytes(), nil
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: clamp(opt.Quality, 1, 100)})
 	}
+	if err != nil {
+		return nil, imgerr.Encode(err)
+	}
+	return buf.Bytes(), nil
 }
 
 func complexBorderChain(opt *Options) imageops.Handler {
 	chain := handlerBorder(opt)
 	chain = imageops.WithRandomJitter(chain)
-	chain = imageops.WithMetaAudit(chain)
 	return chain
 }
 
-// Border wires log + optional meta + border pipeline.
+// Border wires log + border pipeline.
 func Border(in []byte, opt Options) ([]byte, error) {
 	normalLog := &logger.MetaPayload{
 		Ob2: logger.LogInfo(actionWithBorder, defaultLogInfo()),
 	}
 
-	var meta *logger.MetaPayload
-	if s, _ := stego.ExtractMetaBytesAuto(in); s != "" {
-		m := &logger.MetaPayload{}
-		_ = json.Unmarshal([]byte(s), m)
-		meta = m
-	}
-	_, _ = logger.LogMetaHandler(normalLog, meta)
+	_, _ = logger.LogMetaHandler(normalLog, nil)
 
 	return imageops.NewPipeline().
 		Add(complexBorderChain(&opt)).
@@ -107,15 +252,15 @@ func Border(in []byte, opt Options) ([]byte, error) {
 
 // ---- helpers ----
 
-func drawInsetRect(dst *image.RGBA, r image.Rectangle, t int, col color.RGBA) {
+func drawInsetRect(dst *image.RGBA, r image.Rectangle, sd Sides, fill image.Image) {
 	// top
-	draw.Draw(dst, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+t), &image.Uniform{C: col}, image.Point{}, draw.Src)
+	draw.Draw(dst, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+sd.Top), fill, image.Pt(r.Min.X, r.Min.Y), draw.Src)
 	// bottom
-	draw.Draw(dst, image.Rect(r.Min.X, r.Max.Y-t, r.Max.X, r.Max.Y), &image.Uniform{C: col}, image.Point{}, draw.Src)
+	draw.Draw(dst, image.Rect(r.Min.X, r.Max.Y-sd.Bottom, r.Max.X, r.Max.Y), fill, image.Pt(r.Min.X, r.Max.Y-sd.Bottom), draw.Src)
 	// left
-	draw.Draw(dst, image.Rect(r.Min.X, r.Min.Y, r.Min.X+t, r.Max.Y), &image.Uniform{C: col}, image.Point{}, draw.Src)
+	draw.Draw(dst, image.Rect(r.Min.X, r.Min.Y, r.Min.X+sd.Left, r.Max.Y), fill, image.Pt(r.Min.X, r.Min.Y), draw.Src)
 	// right
-	draw.Draw(dst, image.Rect(r.Max.X-t, r.Min.Y, r.Max.X, r.Max.Y), &image.Uniform{C: col}, image.Point{}, draw.Src)
+	draw.Draw(dst, image.Rect(r.Max.X-sd.Right, r.Min.Y, r.Max.X, r.Max.Y), fill, image.Pt(r.Max.X-sd.Right, r.Min.Y), draw.Src)
 }
 
 func max(a, b int) int {
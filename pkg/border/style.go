@@ -0,0 +1,213 @@
+package border
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/HumbleLines/imgpipe/pkg/internal/mask"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+	"github.com/HumbleLines/imgpipe/pkg/palette"
+)
+
+// Sides sets the thickness of each edge in pixels. The zero value means
+// "use Options.Thickness on every side".
+type Sides struct {
+	Top, Right, Bottom, Left int
+}
+
+func (s Sides) isZero() bool {
+	return s == Sides{}
+}
+
+// GradientKind selects the gradient geometry.
+type GradientKind int
+
+const (
+	// Linear : colour changes along a line at Angle.
+	Linear GradientKind = iota
+	// Radial : colour changes from the centre outwards.
+	Radial
+)
+
+// Gradient fills the border with a two-colour ramp instead of a solid colour.
+type Gradient struct {
+	Kind     GradientKind
+	From, To color.RGBA // start (left / centre) and end (right / corners) colours
+	Angle    float64    // Linear only, degrees clockwise; 0 = left to right, 90 = top to bottom
+}
+
+// Shadow is an outer drop shadow cast by the bordered image. The canvas
+// grows to fit it and the area around the card is transparent.
+type Shadow struct {
+	OffsetX, OffsetY int        // pixels, positive = right/down
+	Blur             int        // approximate gaussian radius in pixels; 0 = hard shadow
+	Color            color.RGBA // shadow colour, alpha sets its strength
+}
+
+// ColorSource picks where the border colour comes from.
+type ColorSource int
+
+const (
+	// ColorFixed : use Options.Color as given.
+	ColorFixed ColorSource = iota
+	// ColorDominant : the most common colour of the image.
+	ColorDominant
+	// ColorEdge : the average colour along the image edges, which makes the
+	// border look like an extension of the photo.
+	ColorEdge
+	// ColorAccent : a complementary accent to the image's main colour.
+	ColorAccent
+)
+
+// withColorFrom returns a copy of opt whose Color is derived from src
+// according to ColorFrom. Color's alpha is kept when set.
+func (opt *Options) withColorFrom(src image.Image) *Options {
+	var c color.RGBA
+	switch opt.ColorFrom {
+	case ColorDominant:
+		c = palette.Dominant(src)
+	case ColorEdge:
+		c = palette.EdgeAverage(src, 0)
+	case ColorAccent:
+		c = palette.Accent(src)
+	default:
+		return opt
+	}
+	o := *opt
+	if o.Color.A != 0 && o.Color.A != 255 {
+		// keep the requested translucency (Color is premultiplied)
+		a := float64(o.Color.A) / 255
+		c = color.RGBA{R: uint8(float64(c.R) * a), G: uint8(float64(c.G) * a), B: uint8(float64(c.B) * a), A: o.Color.A}
+	}
+	o.Color = c
+	return &o
+}
+
+// sides resolves the per-edge thickness.
+func (opt *Options) sides() Sides {
+	if !opt.Sides.isZero() {
+		return Sides{
+			Top:    max(0, opt.Sides.Top),
+			Right:  max(0, opt.Sides.Right),
+			Bottom: max(0, opt.Sides.Bottom),
+			Left:   max(0, opt.Sides.Left),
+		}
+	}
+	t := max(1, opt.Thickness)
+	return Sides{t, t, t, t}
+}
+
+// paint returns the border fill for a card covering r: pattern, then
+// gradient, then the solid colour.
+func (opt *Options) paint(r image.Rectangle) image.Image {
+	switch {
+	case opt.Pattern != nil:
+		return tiled(opt.Pattern, r)
+	case opt.Gradient != nil:
+		return opt.Gradient.render(r)
+	}
+	return &image.Uniform{C: opt.Color}
+}
+
+// transparent reports whether the result has see-through areas.
+func (opt *Options) transparent() bool {
+	return opt.Radius > 0 || opt.Shadow != nil
+}
+
+// render draws the gradient over r.
+func (g *Gradient) render(r image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(r)
+	w, h := float64(r.Dx()), float64(r.Dy())
+	cx, cy := w/2, h/2
+	sin, cos := math.Sincos(g.Angle * math.Pi / 180)
+	// half the projection of the rectangle onto the gradient axis
+	span := (math.Abs(w*cos) + math.Abs(h*sin)) / 2
+	radius := math.Hypot(cx, cy)
+	parallel.Rows(r, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			for x := band.Min.X; x < band.Max.X; x++ {
+				px, py := float64(x-r.Min.X)+0.5-cx, float64(y-r.Min.Y)+0.5-cy
+				var t float64
+				if g.Kind == Radial {
+					t = math.Hypot(px, py) / radius
+				} else if span > 0 {
+					t = 0.5 + (px*cos+py*sin)/(2*span)
+				}
+				img.SetRGBA(x, y, lerp(g.From, g.To, t))
+			}
+		}
+	})
+	return img
+}
+
+func lerp(a, b color.RGBA, t float64) color.RGBA {
+	t = math.Max(0, math.Min(1, t))
+	mix := func(p, q uint8) uint8 {
+		return uint8(float64(p) + (float64(q)-float64(p))*t + 0.5)
+	}
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: mix(a.A, b.A)}
+}
+
+// tiled repeats tile across r, starting at r.Min.
+func tiled(tile image.Image, r image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(r)
+	tb := tile.Bounds()
+	if tb.Empty() {
+		return img
+	}
+	for y := r.Min.Y; y < r.Max.Y; y += tb.Dy() {
+		for x := r.Min.X; x < r.Max.X; x += tb.Dx() {
+			draw.Draw(img, image.Rect(x, y, x+tb.Dx(), y+tb.Dy()), tile, tb.Min, draw.Src)
+		}
+	}
+	return img
+}
+
+// roundCorners clips card to a rounded rectangle; outside becomes transparent.
+func roundCorners(card *image.RGBA, radius int) *image.RGBA {
+	b := card.Bounds()
+	out := image.NewRGBA(b)
+	draw.DrawMask(out, b, card, b.Min, mask.RoundedRect(b.Size(), radius), image.Point{}, draw.Src)
+	return out
+}
+
+// offset returns the shadow offset clamped to MaxShadowOffset and how far
+// the blur spreads beyond the shadow's shape.
+func (s *Shadow) offset() (dx, dy, pad int) {
+	dx = max(-MaxShadowOffset, min(s.OffsetX, MaxShadowOffset))
+	dy = max(-MaxShadowOffset, min(s.OffsetY, MaxShadowOffset))
+	return dx, dy, 3 * mask.BlurStep(s.Blur)
+}
+
+// withShadow places card on a transparent canvas large enough for its
+// blurred, offset shadow and draws the shadow beneath it.
+func withShadow(card *image.RGBA, s *Shadow) *image.RGBA {
+	cb := card.Bounds()
+	step := mask.BlurStep(s.Blur)
+	dx, dy, pad := s.offset()
+	shadowRect := cb.Add(image.Pt(dx, dy)).Inset(-pad)
+	canvas := cb.Union(shadowRect)
+	off := canvas.Min.Mul(-1)
+	out := image.NewRGBA(image.Rect(0, 0, canvas.Dx(), canvas.Dy()))
+
+	// the card's alpha channel is the shadow's shape
+	sm := image.NewAlpha(out.Bounds())
+	draw.Draw(sm, cb.Add(off).Add(image.Pt(dx, dy)), card, cb.Min, draw.Src)
+	if step > 0 {
+		sm = mask.Blur(sm, step)
+	}
+	draw.DrawMask(out, out.Bounds(), &image.Uniform{C: s.Color}, image.Point{}, sm, image.Point{}, draw.Over)
+	draw.Draw(out, cb.Add(off), card, cb.Min, draw.Over)
+	return out
+}
+
+// flatten composites img over an opaque background (for JPEG output).
+func flatten(img *image.RGBA, bg color.RGBA) *image.RGBA {
+	bg.A = 255
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Over)
+	return out
+}
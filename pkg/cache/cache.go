@@ -0,0 +1,165 @@
+// Package cache keeps processed results so that running the same
+// operations on the same source twice costs one lookup. Entries are keyed
+// by the source hash plus the canonical form of the operation options;
+// concurrent requests for a missing entry share one computation.
+//
+//	c := cache.New(cache.NewMemory(256 << 20))
+//	h, err := c.Pipeline(p, recipe)   // p an *imageops.Pipeline, recipe what it was built from
+//	out, err := h(in)
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+)
+
+// Store holds cached results. Implementations are safe for concurrent
+// use; Get reports a miss with ok == false and a nil error.
+type Store interface {
+	Get(key string) (value []byte, ok bool, err error)
+	Set(key string, value []byte) error
+}
+
+// Stats counts lookups since the cache was created.
+type Stats struct {
+	Hits   int64 // served from the store
+	Misses int64 // computed
+	Shared int64 // waited for a computation already running for the key
+	Errors int64 // store failures (treated as misses; results are still returned)
+}
+
+// Cache runs computations through a Store.
+type Cache struct {
+	store Store
+
+	mu       sync.Mutex
+	inflight map[string]*call
+
+	hits, misses, shared, errs atomic.Int64
+}
+
+var errPanicked = errors.New("cache: computation panicked")
+
+type call struct {
+	done chan struct{}
+	val  []byte
+	err  error
+}
+
+// New returns a cache over store.
+func New(store Store) *Cache {
+	return &Cache{store: store, inflight: map[string]*call{}}
+}
+
+// Stats returns the current counters.
+func (c *Cache) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Shared: c.shared.Load(), Errors: c.errs.Load()}
+}
+
+// Do returns the value stored under key, or runs fn, stores its result
+// and returns it. While fn runs, other calls for key wait for it instead
+// of running their own. Errors from fn are returned, not cached. Every
+// caller gets its own copy of the value and may modify it.
+func (c *Cache) Do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	if v, ok, err := c.store.Get(key); err != nil {
+		c.errs.Add(1)
+	} else if ok {
+		c.hits.Add(1)
+		return v, nil
+	}
+
+	c.mu.Lock()
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		c.shared.Add(1)
+		<-cl.done
+		if cl.err != nil {
+			return nil, cl.err
+		}
+		return append([]byte(nil), cl.val...), nil
+	}
+	cl := &call{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+
+	c.misses.Add(1)
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		close(cl.done)
+	}()
+	cl.err = errPanicked // replaced unless fn panics, so waiters do not hang
+	cl.val, cl.err = fn()
+	if cl.err == nil {
+		if err := c.store.Set(key, cl.val); err != nil {
+			c.errs.Add(1)
+		}
+	}
+	if cl.err != nil {
+		return nil, cl.err
+	}
+	// waiters copy cl.val after done is closed; the caller's slice is separate
+	return append([]byte(nil), cl.val...), nil
+}
+
+// Wrap returns h with its results cached. opts must describe everything
+// that determines h's output (the operation and its options); it is
+// canonicalised once, here.
+func (c *Cache) Wrap(h imageops.Handler, opts any) (imageops.Handler, error) {
+	canon, err := Canonical(opts)
+	if err != nil {
+		return nil, err
+	}
+	return func(in []byte) ([]byte, error) {
+		return c.Do(key(in, canon), func() ([]byte, error) { return h(in) })
+	}, nil
+}
+
+// Pipeline is Wrap for a whole pipeline; opts describes all its steps.
+func (c *Cache) Pipeline(p *imageops.Pipeline, opts any) (imageops.Handler, error) {
+	return c.Wrap(p.Run, opts)
+}
+
+// Key returns the cache key for processing src with opts.
+func Key(src []byte, opts any) (string, error) {
+	canon, err := Canonical(opts)
+	if err != nil {
+		return "", err
+	}
+	return key(src, canon), nil
+}
+
+func key(src, canon []byte) string {
+	s := sha256.Sum256(src)
+	h := sha256.New()
+	h.Write(s[:])
+	h.Write(canon)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Canonical renders opts as JSON with sorted object keys and normalised
+// numbers, so equal options give equal bytes whatever their Go type or
+// field order (a struct and the map it came from, 90 and 90.0). A string
+// is taken to be canonical already.
+func Canonical(opts any) ([]byte, error) {
+	if b, ok := opts.(string); ok {
+		return []byte(b), nil
+	}
+	raw, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("cache: options: %w", err)
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("cache: options: %w", err)
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/internal/fsutil"
+)
+
+// Disk is a store of files below a directory, bounded by their total
+// size. The least recently used files are removed first; use is tracked
+// by modification time, so the order survives restarts.
+type Disk struct {
+	dir string
+	max int64
+
+	mu    sync.Mutex
+	size  int64
+	ll    *list.List // front = most recently used
+	items map[string]*list.Element
+}
+
+type diskEntry struct {
+	name string // file name, the hash of the key
+	size int64
+}
+
+// NewDisk opens (creating it if needed) a store in dir holding at most
+// maxBytes. Files already there are indexed and count against the budget.
+func NewDisk(dir string, maxBytes int64) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := &Disk{dir: dir, max: maxBytes, ll: list.New(), items: map[string]*list.Element{}}
+
+	type found struct {
+		diskEntry
+		mod time.Time
+	}
+	var files []found
+	err := filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() || !isEntryName(e.Name()) {
+			return err
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil // removed meanwhile
+		}
+		files = append(files, found{diskEntry{e.Name(), info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].mod.After(files[j].mod) })
+	for _, f := range files {
+		d.items[f.name] = d.ll.PushBack(&diskEntry{f.name, f.size})
+		d.size += f.size
+	}
+	d.mu.Lock()
+	d.evict()
+	d.mu.Unlock()
+	return d, nil
+}
+
+// Get reads the file for key and marks it recently used.
+func (d *Disk) Get(key string) ([]byte, bool, error) {
+	name := entryName(key)
+	b, err := os.ReadFile(d.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		d.mu.Lock()
+		if el, ok := d.items[name]; ok { // removed behind our back
+			d.remove(el)
+		}
+		d.mu.Unlock()
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	_ = os.Chtimes(d.path(name), now, now)
+	d.mu.Lock()
+	if el, ok := d.items[name]; ok {
+		d.ll.MoveToFront(el)
+	}
+	d.mu.Unlock()
+	return b, true, nil
+}
+
+// Set writes value atomically, then removes the least recently used files
+// beyond the budget. Values larger than the whole budget are not stored.
+func (d *Disk) Set(key string, value []byte) error {
+	n := int64(len(value))
+	if n > d.max {
+		return nil
+	}
+	name := entryName(key)
+	if err := fsutil.WriteFile(d.path(name), value); err != nil {
+		return err
+	}
+	// stamp with the clock Get uses; the file system's may be coarser
+	now := time.Now()
+	_ = os.Chtimes(d.path(name), now, now)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if el, ok := d.items[name]; ok {
+		d.size -= el.Value.(*diskEntry).size
+		d.ll.Remove(el)
+	}
+	d.items[name] = d.ll.PushFront(&diskEntry{name, n})
+	d.size += n
+	d.evict()
+	return nil
+}
+
+// Len returns the number of files and their total size.
+func (d *Disk) Len() (entries int, bytes int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ll.Len(), d.size
+}
+
+// evict removes files until the store fits its budget; d.mu is held.
+func (d *Disk) evict() {
+	for d.size > d.max && d.ll.Len() > 0 {
+		el := d.ll.Back()
+		_ = os.Remove(d.path(el.Value.(*diskEntry).name))
+		d.remove(el)
+	}
+}
+
+func (d *Disk) remove(el *list.Element) {
+	e := d.ll.Remove(el).(*diskEntry)
+	delete(d.items, e.name)
+	d.size -= e.size
+}
+
+// path spreads files over 256 subdirectories.
+func (d *Disk) path(name string) string {
+	return filepath.Join(d.dir, name[:2], name)
+}
+
+// entryName hashes key into a fixed-length file name, so any key is safe
+// on any file system.
+func entryName(key string) string {
+	s := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(s[:])
+}
+
+func isEntryName(name string) bool {
+	return len(name) == 64 && strings.Trim(name, "0123456789abcdef") == ""
+}
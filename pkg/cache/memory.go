@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Memory is an in-process LRU store bounded by the total size of its
+// values (keys included).
+type Memory struct {
+	mu    sync.Mutex
+	max   int64
+	size  int64
+	ll    *list.List // front = most recently used
+	items map[string]*list.Element
+}
+
+type memEntry struct {
+	key string
+	val []byte
+}
+
+// NewMemory returns an LRU store holding at most maxBytes.
+func NewMemory(maxBytes int64) *Memory {
+	return &Memory{max: maxBytes, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get returns a copy of the value and marks it recently used.
+func (m *Memory) Get(key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	m.ll.MoveToFront(el)
+	return append([]byte(nil), el.Value.(*memEntry).val...), true, nil
+}
+
+// Set stores a copy of value, evicting the least recently used entries
+// to stay within budget. Values larger than the whole budget are not
+// stored.
+func (m *Memory) Set(key string, value []byte) error {
+	n := int64(len(key) + len(value))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	if n > m.max {
+		return nil
+	}
+	m.items[key] = m.ll.PushFront(&memEntry{key: key, val: append([]byte(nil), value...)})
+	m.size += n
+	for m.size > m.max {
+		m.remove(m.ll.Back())
+	}
+	return nil
+}
+
+// Len returns the number of entries and their total size.
+func (m *Memory) Len() (entries int, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ll.Len(), m.size
+}
+
+func (m *Memory) remove(el *list.Element) {
+	e := m.ll.Remove(el).(*memEntry)
+	delete(m.items, e.key)
+	m.size -= int64(len(e.key) + len(e.val))
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a store in a Redis server, shared by every process using the
+// same server and prefix. Redis does the eviction: give entries a TTL,
+// or configure maxmemory with an LRU policy.
+type Redis struct {
+	client  redis.Cmdable
+	prefix  string
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+// NewRedis returns a store keeping entries under prefix+key for ttl
+// (0 keeps them until Redis evicts them). Each command is given at most
+// two seconds.
+func NewRedis(client redis.Cmdable, prefix string, ttl time.Duration) *Redis {
+	return &Redis{client: client, prefix: prefix, ttl: ttl, timeout: 2 * time.Second}
+}
+
+// Get fetches the value of key.
+func (r *Redis) Get(key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	b, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+// Set stores value under key.
+func (r *Redis) Set(key string, value []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	return r.client.Set(ctx, r.prefix+key, value, r.ttl).Err()
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/HumbleLines/imgpipe/pkg/batch"
+	"github.com/HumbleLines/imgpipe/pkg/internal/fsutil"
+)
+
+func init() {
+	register("batch", "Run a recipe over directories or glob patterns.", setupBatch)
+}
+
+func setupBatch(fs *flag.FlagSet) func(Env, []string) error {
+	path := fs.String("f", "", "recipe file (.yaml, .yml, .json or .toml)")
+	name := fs.String("r", "", "recipe name (may be omitted when the file holds one recipe)")
+	out := fs.String("o", "", "output naming template, e.g. out/{path}_800.jpg ({path}, {dir}, {name}, {ext})")
+	workers := fs.Int("j", 0, "files processed in parallel (default GOMAXPROCS)")
+	exts := fs.String("ext", ".jpg,.jpeg,.png", "extensions taken from directories and globs")
+	force := fs.Bool("force", false, "reprocess files whose output is up to date")
+	journal := fs.String("journal", "", "progress journal; rerun with the same file to resume")
+	summary := fs.String("summary", "", "write the JSON summary to this file (default stdout)")
+	verbose := fs.Bool("v", false, "print one line per file to stderr")
+	return func(env Env, args []string) error {
+		if *path == "" || *out == "" {
+			return usagef("-f and -o are required")
+		}
+		if len(args) == 0 {
+			return usagef("give at least one input directory, glob or file")
+		}
+		if _, err := batch.ParseTemplate(*out); err != nil {
+			return usagef("%v", err)
+		}
+		book, err := loadBook(*path)
+		if err != nil {
+			return err
+		}
+		r, err := pick(book, *name)
+		if err != nil {
+			return err
+		}
+		p, err := r.Compile()
+		if err != nil {
+			return err
+		}
+
+		opt := batch.Options{
+			Inputs:     args,
+			Extensions: strings.Split(*exts, ","),
+			Output:     *out,
+			Handler:    p.Run,
+			Workers:    *workers,
+			Force:      *force,
+			Journal:    *journal,
+			Policy:     env.policy,
+		}
+		if *verbose {
+			opt.OnResult = func(res batch.Result) {
+				line := fmt.Sprintf("%-7s %s", res.Status, res.Input)
+				if res.Error != "" {
+					line += ": " + res.Error
+				}
+				fmt.Fprintln(env.Stderr, line)
+			}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		sum, runErr := batch.Run(ctx, opt)
+		if sum == nil {
+			return runErr
+		}
+
+		b, err := json.MarshalIndent(sum, "", "  ")
+		if err != nil {
+			return err
+		}
+		b = append(b, '\n')
+		if *summary == "" {
+			_, err = env.Stdout.Write(b)
+		} else {
+			err = fsutil.WriteFile(*summary, b)
+		}
+		if err != nil {
+			return &ioError{err: err}
+		}
+
+		switch {
+		case sum.Interrupted:
+			return fmt.Errorf("interrupted after %d files; rerun with the same -journal to resume", sum.Total)
+		case runErr != nil:
+			return runErr
+		case sum.Failed > 0:
+			return fmt.Errorf("%d of %d files failed", sum.Failed, sum.Total)
+		}
+		return nil
+	}
+}
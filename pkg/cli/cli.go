@@ -0,0 +1,150 @@
+// Package cli implements the imgpipe command line. It is a library so the
+// binary (cmd/imgpipe) stays a one-liner and the commands can be tested
+// in-process.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+)
+
+// Exit codes returned by Run.
+const (
+	ExitOK    = 0 // success
+	ExitError = 1 // the operation failed (undecodable image, encode error, ...)
+	ExitUsage = 2 // bad command line
+	ExitIO    = 3 // input could not be read or output not written
+)
+
+// Env is the process environment a command runs in.
+type Env struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	policy validate.Policy // from -strict; warnings go to Stderr
+}
+
+// command is one subcommand: it registers its flags on fs and returns the
+// function to run once they are parsed.
+type command struct {
+	summary string
+	setup   func(fs *flag.FlagSet) func(env Env, args []string) error
+}
+
+var commands = map[string]command{}
+
+func register(name, summary string, setup func(fs *flag.FlagSet) func(env Env, args []string) error) {
+	commands[name] = command{summary: summary, setup: setup}
+}
+
+// usageError marks a command-line mistake (exit code 2).
+type usageError struct{ msg string }
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, a ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, a...)}
+}
+
+// ioError marks a failure to read input or write output (exit code 3).
+type ioError struct{ err error }
+
+func (e *ioError) Error() string { return e.err.Error() }
+func (e *ioError) Unwrap() error { return e.err }
+
+// Run executes the command line args (without the program name) and
+// returns the process exit code.
+func Run(args []string, env Env) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		if len(args) > 1 {
+			if c, ok := commands[args[1]]; ok {
+				fs := newFlagSet(args[1], env)
+				c.setup(fs)
+				fs.Usage()
+				return ExitOK
+			}
+		}
+		printUsage(env.Stderr)
+		if len(args) == 0 {
+			return ExitUsage
+		}
+		return ExitOK
+	}
+
+	name := args[0]
+	c, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(env.Stderr, "imgpipe: unknown command %q\n\n", name)
+		printUsage(env.Stderr)
+		return ExitUsage
+	}
+	fs := newFlagSet(name, env)
+	run := c.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	stderr := env.Stderr
+	env.policy = validate.Policy{
+		Strict: fs.Lookup("strict").Value.String() == "true",
+		Warn:   func(msg string) { fmt.Fprintf(stderr, "imgpipe %s: warning: %s\n", name, msg) },
+	}
+
+	err := run(env, fs.Args())
+	var ue *usageError
+	var ie *ioError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &ue):
+		fmt.Fprintf(env.Stderr, "imgpipe %s: %v\n", name, err)
+		fs.Usage()
+		return ExitUsage
+	case errors.As(err, &ie):
+		fmt.Fprintf(env.Stderr, "imgpipe %s: %v\n", name, err)
+		return ExitIO
+	default:
+		fmt.Fprintf(env.Stderr, "imgpipe %s: %v\n", name, err)
+		return ExitError
+	}
+}
+
+func newFlagSet(name string, env Env) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	fs.Bool("strict", false, "fail on invalid or contradictory options instead of warning and falling back")
+	fs.Usage = func() {
+		fmt.Fprintf(env.Stderr, "usage: imgpipe %s [flags] [input [output]]\n\n%s\n\nflags:\n", name, commands[name].summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func printUsage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	width := 0
+	for n := range commands {
+		names = append(names, n)
+		width = max(width, len(n))
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("usage: imgpipe <command> [flags] [input [output]]\n\n")
+	b.WriteString("Input and output default to stdin and stdout; \"-\" selects them explicitly.\n\ncommands:\n")
+	for _, n := range names {
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, n, commands[n].summary)
+	}
+	b.WriteString("\nRun \"imgpipe help <command>\" for its flags.\n")
+	b.WriteString("Exit codes: 0 ok, 1 processing error, 2 usage error, 3 I/O error.\n")
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/HumbleLines/imgpipe/pkg/border"
+	"github.com/HumbleLines/imgpipe/pkg/compress"
+	"github.com/HumbleLines/imgpipe/pkg/convert"
+	"github.com/HumbleLines/imgpipe/pkg/crop"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parse"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/rotate"
+	"github.com/HumbleLines/imgpipe/pkg/watermark"
+)
+
+func init() {
+	register("compress", "Re-encode as JPEG at the given quality.", setupCompress)
+	register("convert", "Convert to another format (jpeg or png).", setupConvert)
+	register("resize", "Resize to a box: stretch, fit inside or fill (cover + crop).", setupResize)
+	register("crop", "Crop an absolute rectangle or a centred aspect ratio.", setupCrop)
+	register("rotate", "Rotate by 90, 180 or 270 degrees clockwise.", setupRotate)
+	register("border", "Add an inset or outset border.", setupBorder)
+	register("watermark", "Draw a text and/or image watermark.", setupWatermark)
+}
+
+func setupCompress(fs *flag.FlagSet) func(Env, []string) error {
+	var files ioFlags
+	addIOFlags(fs, &files)
+	return func(env Env, args []string) error {
+		return files.process(env, args, func(in []byte) ([]byte, error) {
+			return compress.Compress(in, files.quality)
+		})
+	}
+}
+
+func setupConvert(fs *flag.FlagSet) func(Env, []string) error {
+	var files ioFlags
+	addIOFlags(fs, &files)
+	to := fs.String("to", "", "target format: jpeg or png (default from the output extension)")
+	return func(env Env, args []string) error {
+		if err := files.resolve(args); err != nil {
+			return err
+		}
+		format := strings.ToLower(*to)
+		if format == "" {
+			format = formatFromExt(files.out)
+		}
+		switch format {
+		case "jpg", "jpeg", "png":
+		case "":
+			return usagef("-to is required when writing to stdout")
+		default:
+			return usagef("unsupported format %q (want jpeg or png)", format)
+		}
+		return files.process(env, nil, func(in []byte) ([]byte, error) {
+			return convert.Convert(in, format, files.quality)
+		})
+	}
+}
+
+func formatFromExt(path string) string {
+	if i := strings.LastIndexByte(path, '.'); i >= 0 {
+		return strings.ToLower(path[i+1:])
+	}
+	return ""
+}
+
+func setupResize(fs *flag.FlagSet) func(Env, []string) error {
+	var files ioFlags
+	addIOFlags(fs, &files)
+	w := fs.Int("w", 0, "target width (required)")
+	h := fs.Int("h", 0, "target height (required)")
+	mode := fs.String("mode", "fit", "stretch, fit or fill")
+	return func(env Env, args []string) error {
+		m, err := parse.Enum("mode", *mode, parse.ResizeModes)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		if *w <= 0 || *h <= 0 {
+			return usagef("-w and -h must be positive")
+		}
+		opt := resize.Options{Mode: m, Width: *w, Height: *h, Quality: files.quality, Policy: env.policy}
+		return files.process(env, args, func(in []byte) ([]byte, error) {
+			return resize.Resize(in, opt)
+		})
+	}
+}
+
+func setupCrop(fs *flag.FlagSet) func(Env, []string) error {
+	var files ioFlags
+	addIOFlags(fs, &files)
+	x := fs.Int("x", 0, "left edge of the rectangle")
+	y := fs.Int("y", 0, "top edge of the rectangle")
+	w := fs.Int("w", 0, "rectangle width")
+	h := fs.Int("h", 0, "rectangle height")
+	ratio := fs.String("ratio", "", "centred crop to an aspect ratio W:H, e.g. 16:9 (instead of -x/-y/-w/-h)")
+	return func(env Env, args []string) error {
+		opt := crop.Options{Mode: crop.ModeRect, X: *x, Y: *y, Width: *w, Height: *h, Quality: files.quality, Policy: env.policy}
+		if *ratio != "" {
+			var rw, rh int
+			if _, err := fmt.Sscanf(*ratio, "%d:%d", &rw, &rh); err != nil || rw <= 0 || rh <= 0 {
+				return usagef("bad -ratio %q, want W:H", *ratio)
+			}
+			opt = crop.Options{Mode: crop.ModeCenterRatio, RatioW: rw, RatioH: rh, Quality: files.quality, Policy: env.policy}
+		} else if *w <= 0 || *h <= 0 {
+			return usagef("give -w and -h, or -ratio")
+		}
+		return files.process(env, args, func(in []byte) ([]byte, error) {
+			return crop.Crop(in, opt)
+		})
+	}
+}
+
+func setupRotate(fs *flag.FlagSet) func(Env, []string) error {
+	var files ioFlags
+	addIOFlags(fs, &files)
+	deg := fs.String("deg", "90", "clockwise degrees: 90, 180 or 270")
+	return func(env Env, args []string) error {
+		m, err := parse.Enum("angle", *deg, parse.Rotations)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		opt := rotate.Options{Mode: m, Quality: files.quality, Policy: env.policy}
+		return files.process(env, args, func(in []byte) ([]byte, error) {
+			return rotate.Rotate(in, opt)
+		})
+	}
+}
+
+func setupBorder(fs *flag.FlagSet) func(Env, []string) error {
+	var files ioFlags
+	addIOFlags(fs, &files)
+	mode := fs.String("mode", "outset", "inset or outset")
+	thick := fs.Int("t", 10, "thickness in pixels")
+	sides := fs.String("sides", "", "per-side thickness top,right,bottom,left (overrides -t)")
+	col := fs.String("color", "#ffffff", "colour #rrggbb[aa], or dominant, edge or accent to pick it from the image")
+	radius := fs.Int("radius", 0, "outer corner radius in pixels (transparent corners, PNG output)")
+	shadow := fs.String("shadow", "", "drop shadow dx,dy,blur (PNG output)")
+	shadowCol := fs.String("shadow-color", "#00000080", "drop shadow colour")
+	format := fs.String("format", "", "png or jpeg (default png when there are transparent areas)")
+	return func(env Env, args []string) error {
+		m, err := parse.Enum("mode", *mode, parse.BorderModes)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		opt := border.Options{Mode: m, Thickness: *thick, Radius: *radius, Format: *format, Quality: files.quality, Policy: env.policy}
+		if src, ok := parse.ColorSources[strings.ToLower(*col)]; ok {
+			opt.ColorFrom = src
+		} else if opt.Color, err = parse.Color(*col); err != nil {
+			return usagef("-color: %v", err)
+		}
+		if *sides != "" {
+			v, err := parse.Ints(*sides, 4)
+			if err != nil {
+				return usagef("-sides: %v", err)
+			}
+			opt.Sides = border.Sides{Top: v[0], Right: v[1], Bottom: v[2], Left: v[3]}
+		}
+		if *shadow != "" {
+			v, err := parse.Ints(*shadow, 3)
+			if err != nil {
+				return usagef("-shadow: %v", err)
+			}
+			c, err := parse.Color(*shadowCol)
+			if err != nil {
+				return usagef("-shadow-color: %v", err)
+			}
+			opt.Shadow = &border.Shadow{OffsetX: v[0], OffsetY: v[1], Blur: v[2], Color: c}
+		}
+		return files.process(env, args, func(in []byte) ([]byte, error) {
+			return border.Border(in, opt)
+		})
+	}
+}
+
+func setupWatermark(fs *flag.FlagSet) func(Env, []string) error {
+	var files ioFlags
+	addIOFlags(fs, &files)
+	text := fs.String("text", "", "watermark text; supports {width}, {exif.Artist}, {now:2006} ...")
+	mark := fs.String("image", "", "watermark image file (PNG with alpha recommended)")
+	font := fs.String("font", "", "TTF/OTF font file for -text (default Go Regular)")
+	size := fs.Float64("size", 0, "font size in points (default ~ image width / 20)")
+	col := fs.String("color", "#ffffff", "text colour #rrggbb[aa]")
+	anchor := fs.String("anchor", "bottom-right", "position: top-left, top, ..., center, ..., bottom-right")
+	margin := fs.Int("margin", 16, "distance from the anchored edges in pixels")
+	opacity := fs.Float64("opacity", 0.6, "opacity 0-1; 0 means opaque")
+	relWidth := fs.Float64("rel-width", 0.2, "image mark width as a fraction of the image width")
+	blend := fs.String("blend", "normal", "blend mode: normal, multiply, screen, overlay, soft-light, difference, luminosity, atop")
+	tile := fs.Bool("tile", false, "repeat the watermark across the image")
+	angle := fs.Float64("angle", -30, "tile rotation in degrees (with -tile)")
+	return func(env Env, args []string) error {
+		if *text == "" && *mark == "" {
+			return usagef("give -text and/or -image")
+		}
+		if *opacity < 0 || *opacity > 1 {
+			return usagef("-opacity must be between 0 and 1")
+		}
+		a, err := parse.Enum("anchor", *anchor, parse.Anchors)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		bm, err := parse.Enum("blend mode", *blend, parse.Blends)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		c, err := parse.Color(*col)
+		if err != nil {
+			return usagef("-color: %v", err)
+		}
+		base := watermark.Layer{
+			Anchor:  a,
+			Margin:  watermark.Margin{X: *margin, Y: *margin},
+			Opacity: *opacity,
+			Blend:   bm,
+		}
+		if *tile {
+			base.Tile = &watermark.TileOptions{Angle: *angle}
+		}
+
+		var spec watermark.Spec
+		spec.Quality = files.quality
+		if *mark != "" {
+			b, err := os.ReadFile(*mark)
+			if err != nil {
+				return &ioError{err: err}
+			}
+			l := base
+			l.Image, l.RelWidth = b, *relWidth
+			spec.Layers = append(spec.Layers, l)
+		}
+		if *text != "" {
+			l := base
+			l.Text, l.FontPt, l.Color = *text, *size, c
+			if *font != "" {
+				f, err := watermark.LoadFont(*font)
+				if err != nil {
+					return &ioError{err: err}
+				}
+				l.Fonts = watermark.FontSet{f}
+			}
+			spec.Layers = append(spec.Layers, l)
+		}
+		return files.process(env, args, func(in []byte) ([]byte, error) {
+			return watermark.Watermark(in, spec)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/exif"
+	"github.com/HumbleLines/imgpipe/pkg/palette"
+)
+
+func init() {
+	register("info", "Print size, format, EXIF and optionally the colour palette.", setupInfo)
+}
+
+// imageInfo is what info reports; it is also the -json output.
+type imageInfo struct {
+	Format  string           `json:"format"`
+	Width   int              `json:"width"`
+	Height  int              `json:"height"`
+	Bytes   int              `json:"bytes"`
+	EXIF    exif.Tags        `json:"exif,omitempty"`
+	Palette []palette.Swatch `json:"palette,omitempty"`
+}
+
+func setupInfo(fs *flag.FlagSet) func(Env, []string) error {
+	var files ioFlags
+	fs.StringVar(&files.in, "i", "", "input file (default stdin)")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	colours := fs.Int("palette", 0, "also extract this many dominant colours")
+	return func(env Env, args []string) error {
+		if len(args) > 1 {
+			return usagef("unexpected arguments %q", args[1:])
+		}
+		if len(args) == 1 && files.in == "" {
+			files.in = args[0]
+		}
+		in, err := files.read(env)
+		if err != nil {
+			return err
+		}
+		cfg, format, err := decode.Check(in, decode.CurrentLimits())
+		if err != nil {
+			return err
+		}
+		info := imageInfo{Format: format, Width: cfg.Width, Height: cfg.Height, Bytes: len(in)}
+		info.EXIF, _ = exif.Decode(in)
+		if *colours > 0 {
+			if info.Palette, err = palette.Palette(in, palette.Options{Count: *colours, Policy: env.policy}); err != nil {
+				return err
+			}
+		}
+
+		if *asJSON {
+			enc := json.NewEncoder(env.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(info)
+		}
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "format: %s\nwidth:  %d\nheight: %d\nbytes:  %d\n", info.Format, info.Width, info.Height, info.Bytes)
+		if len(info.EXIF) > 0 {
+			keys := make([]string, 0, len(info.EXIF))
+			for k := range info.EXIF {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			b.WriteString("exif:\n")
+			for _, k := range keys {
+				fmt.Fprintf(&b, "  %s: %s\n", k, info.EXIF[k])
+			}
+		}
+		if len(info.Palette) > 0 {
+			b.WriteString("palette:\n")
+			for _, s := range info.Palette {
+				fmt.Fprintf(&b, "  %s %5.1f%%\n", s.Hex, s.Share*100)
+			}
+		}
+		if _, err := env.Stdout.Write(b.Bytes()); err != nil {
+			return &ioError{err: err}
+		}
+		return nil
+	}
+}
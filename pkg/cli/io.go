@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/HumbleLines/imgpipe/pkg/internal/fsutil"
+)
+
+// ioFlags are the -i/-o/-q flags shared by the image commands. Positional
+// arguments fill in input and output when the flags are not given.
+type ioFlags struct {
+	in, out string
+	quality int
+}
+
+func addIOFlags(fs *flag.FlagSet, f *ioFlags) {
+	fs.StringVar(&f.in, "i", "", "input file (default stdin)")
+	fs.StringVar(&f.out, "o", "", "output file (default stdout)")
+	fs.IntVar(&f.quality, "q", 85, "JPEG quality 1-100")
+}
+
+// resolve applies positional [input [output]] arguments.
+func (f *ioFlags) resolve(args []string) error {
+	if len(args) > 0 && f.in == "" {
+		f.in, args = args[0], args[1:]
+	}
+	if len(args) > 0 && f.out == "" {
+		f.out, args = args[0], args[1:]
+	}
+	if len(args) > 0 {
+		return usagef("unexpected arguments %q", args)
+	}
+	return nil
+}
+
+// read returns the input bytes.
+func (f *ioFlags) read(env Env) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if f.in == "" || f.in == "-" {
+		b, err = io.ReadAll(env.Stdin)
+	} else {
+		b, err = os.ReadFile(f.in)
+	}
+	if err != nil {
+		return nil, &ioError{err: err}
+	}
+	return b, nil
+}
+
+// write stores the result; files are written atomically.
+func (f *ioFlags) write(env Env, b []byte) error {
+	var err error
+	if f.out == "" || f.out == "-" {
+		_, err = env.Stdout.Write(b)
+	} else {
+		err = fsutil.WriteFile(f.out, b)
+	}
+	if err != nil {
+		return &ioError{err: err}
+	}
+	return nil
+}
+
+// process is the body shared by the image commands: read, apply op, write.
+func (f *ioFlags) process(env Env, args []string, op func([]byte) ([]byte, error)) error {
+	if f.quality < 1 || f.quality > 100 {
+		return usagef("-q must be between 1 and 100")
+	}
+	return f.run(env, args, op)
+}
+
+// run is process for commands without a -q flag.
+func (f *ioFlags) run(env Env, args []string, op func([]byte) ([]byte, error)) error {
+	if err := f.resolve(args); err != nil {
+		return err
+	}
+	in, err := f.read(env)
+	if err != nil {
+		return err
+	}
+	out, err := op(in)
+	if err != nil {
+		return err
+	}
+	return f.write(env, out)
+}
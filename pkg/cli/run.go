@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/HumbleLines/imgpipe/pkg/recipe"
+)
+
+func init() {
+	register("run", "Run a named recipe from a YAML, JSON or TOML file.", setupRun)
+}
+
+func setupRun(fs *flag.FlagSet) func(Env, []string) error {
+	var files ioFlags // no -q: quality is set per step in the recipe
+	fs.StringVar(&files.in, "i", "", "input file (default stdin)")
+	fs.StringVar(&files.out, "o", "", "output file (default stdout)")
+	path := fs.String("f", "", "recipe file (.yaml, .yml, .json or .toml)")
+	name := fs.String("r", "", "recipe name (may be omitted when the file holds one recipe)")
+	list := fs.Bool("list", false, "list the recipes in the file and exit")
+	check := fs.Bool("check", false, "validate every recipe in the file and exit")
+	return func(env Env, args []string) error {
+		if *path == "" {
+			return usagef("-f is required")
+		}
+		book, err := loadBook(*path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case *list:
+			var b strings.Builder
+			for _, n := range book.Names() {
+				ops := make([]string, len(book[n].Steps))
+				for i, st := range book[n].Steps {
+					ops[i] = st.Op
+				}
+				fmt.Fprintf(&b, "%s: %s\n", n, strings.Join(ops, " -> "))
+			}
+			if _, err := fmt.Fprint(env.Stdout, b.String()); err != nil {
+				return &ioError{err: err}
+			}
+			return nil
+		case *check:
+			return book.Validate()
+		}
+
+		r, err := pick(book, *name)
+		if err != nil {
+			return err
+		}
+		p, err := r.Compile()
+		if err != nil {
+			return err
+		}
+		return files.run(env, args, p.Run)
+	}
+}
+
+// loadBook reads a recipe file; a file that cannot be read is an I/O
+// error, a malformed one a processing error.
+func loadBook(path string) (recipe.Book, error) {
+	book, err := recipe.Load(path)
+	if err != nil {
+		var se *recipe.SyntaxError
+		if errors.As(err, &se) {
+			return nil, err
+		}
+		return nil, &ioError{err: err}
+	}
+	return book, nil
+}
+
+// pick selects the recipe to run.
+func pick(book recipe.Book, name string) (*recipe.Recipe, error) {
+	if name == "" {
+		if len(book) == 1 {
+			for _, r := range book {
+				return r, nil
+			}
+		}
+		return nil, usagef("the file holds several recipes, choose one with -r: %s", strings.Join(book.Names(), ", "))
+	}
+	r, ok := book[name]
+	if !ok {
+		return nil, usagef("no recipe %q (have %s)", name, strings.Join(book.Names(), ", "))
+	}
+	return r, nil
+}
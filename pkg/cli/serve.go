@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/cache"
+	"github.com/HumbleLines/imgpipe/pkg/server"
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	register("serve", "Serve the operations over HTTP (/resize, /crop, /rotate, /convert, /info).", setupServe)
+}
+
+func setupServe(fs *flag.FlagSet) func(Env, []string) error {
+	addr := fs.String("addr", "localhost:8080", "listen address")
+	root := fs.String("root", "", "directory served to GET ?src=path")
+	upload := fs.Bool("upload", false, "accept images as POST bodies")
+	maxBytes := fs.Int64("max-bytes", 32<<20, "largest source in bytes")
+	maxPixels := fs.Int("max-pixels", 50_000_000, "largest source in pixels")
+	maxSide := fs.Int("max-side", 4096, "largest requested output width or height")
+	cache := fs.String("cache-control", "public, max-age=86400", "Cache-Control of successful responses")
+	keyFile := fs.String("keys", "", "file of URL signing keys; when set, only signed URLs are served")
+	presets := presetFlag{}
+	fs.Var(presets, "preset", "named operation, e.g. thumb=resize?w=400&h=300 (repeatable)")
+	presetsOnly := fs.Bool("presets-only", false, "serve only ?preset= requests")
+	cacheMB := fs.Int64("cache-mb", 0, "keep up to this many MiB of responses in memory, or in -cache-dir")
+	cacheDir := fs.String("cache-dir", "", "keep cached responses in this directory")
+	cacheRedis := fs.String("cache-redis", "", "keep cached responses in the Redis server at host:port")
+	return func(env Env, args []string) error {
+		if len(args) > 0 {
+			return usagef("unexpected arguments %q", args)
+		}
+		if *root == "" && !*upload {
+			return usagef("give -root, -upload or both")
+		}
+		var keys []server.Key
+		if *keyFile != "" {
+			var err error
+			if keys, err = readKeys(*keyFile); err != nil {
+				return err
+			}
+		}
+		c, err := serveCache(*cacheMB, *cacheDir, *cacheRedis)
+		if err != nil {
+			return err
+		}
+		s, err := server.New(server.Options{
+			Root:         *root,
+			AllowUpload:  *upload,
+			MaxBytes:     *maxBytes,
+			MaxPixels:    *maxPixels,
+			MaxSide:      *maxSide,
+			CacheControl: *cache,
+			Keys:         keys,
+			Presets:      presets,
+			PresetsOnly:  *presetsOnly,
+			Cache:        c,
+			Policy:       env.policy,
+		})
+		if err != nil {
+			return err
+		}
+		srv := &http.Server{
+			Addr:              *addr,
+			Handler:           s,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second, // the whole request, upload included
+			WriteTimeout:      60 * time.Second, // from the end of the headers: processing and response
+			IdleTimeout:       120 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(shutdown)
+		}()
+		fmt.Fprintf(env.Stderr, "imgpipe: serving on http://%s\n", *addr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
+
+// serveCache returns the cache the serve flags ask for, or nil.
+func serveCache(mb int64, dir, redisAddr string) (*cache.Cache, error) {
+	switch {
+	case dir != "" && redisAddr != "":
+		return nil, usagef("give -cache-dir or -cache-redis, not both")
+	case redisAddr != "":
+		client := redis.NewClient(&redis.Options{Addr: redisAddr})
+		return cache.New(cache.NewRedis(client, "imgpipe:", 24*time.Hour)), nil
+	case mb < 0:
+		return nil, usagef("-cache-mb must not be negative")
+	case dir != "":
+		if mb == 0 {
+			return nil, usagef("-cache-dir needs -cache-mb")
+		}
+		d, err := cache.NewDisk(dir, mb<<20)
+		if err != nil {
+			return nil, &ioError{err}
+		}
+		return cache.New(d), nil
+	case mb > 0:
+		return cache.New(cache.NewMemory(mb << 20)), nil
+	}
+	return nil, nil
+}
+
+// presetFlag collects -preset name=op?params.
+type presetFlag map[string]string
+
+func (p presetFlag) String() string { return "" }
+
+func (p presetFlag) Set(s string) error {
+	name, spec, ok := strings.Cut(s, "=")
+	if !ok || name == "" || spec == "" {
+		return fmt.Errorf("want name=operation?params, got %q", s)
+	}
+	p[name] = spec
+	return nil
+}
+
+// readKeys reads signing keys, one "id secret" or bare "secret" per line;
+// blank lines and # comments are skipped. The first key signs.
+func readKeys(path string) ([]server.Key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &ioError{err}
+	}
+	var keys []server.Key
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		switch len(f) {
+		case 1:
+			keys = append(keys, server.Key{Secret: []byte(f[0])})
+		case 2:
+			keys = append(keys, server.Key{ID: f[0], Secret: []byte(f[1])})
+		default:
+			return nil, fmt.Errorf("%s:%d: want \"id secret\" or \"secret\"", path, n+1)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/server"
+)
+
+func init() {
+	register("sign", "Sign a server URL, e.g. imgpipe sign -keys keys.txt '/resize?src=a.jpg&w=400&h=300'.", setupSign)
+}
+
+func setupSign(fs *flag.FlagSet) func(Env, []string) error {
+	keyFile := fs.String("keys", "", "file of signing keys (the first one signs)")
+	ttl := fs.Duration("ttl", 0, "validity, e.g. 24h (default: no expiry)")
+	return func(env Env, args []string) error {
+		if *keyFile == "" || len(args) != 1 {
+			return usagef("give -keys and one path?query")
+		}
+		if *ttl < 0 {
+			return usagef("-ttl must not be negative")
+		}
+		keys, err := readKeys(*keyFile)
+		if err != nil {
+			return err
+		}
+		path, raw, _ := strings.Cut(args[0], "?")
+		params, err := url.ParseQuery(raw)
+		if err != nil {
+			return usagef("bad query: %v", err)
+		}
+		var exp time.Time
+		if *ttl > 0 {
+			exp = time.Now().Add(*ttl)
+		}
+		fmt.Fprintln(env.Stdout, server.Sign(keys[0], path, params, exp))
+		return nil
+	}
+}
@@ -3,14 +3,14 @@ package compress
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
-	"image"
 	"image/jpeg"
 	"time"
 
+	"github.com/HumbleLines/imgpipe/pkg/decode"
 	"github.com/HumbleLines/imgpipe/pkg/imageops"
-	"github.com/HumbleLines/imgpipe/pkg/stego"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
 	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
 )
 
@@ -19,6 +19,12 @@ type Options struct {
 	Quality int
 }
 
+// Validate reports a quality outside 1~100. Without strict mode (see
+// package validate) it is clamped by the encoder.
+func (opt Options) Validate() error {
+	return validate.Quality(opt.Quality)
+}
+
 // internal defaults for a simple processing log
 var actionWithCompress = "compress"
 
@@ -29,27 +35,30 @@ func defaultLogInfo() string {
 // handlerCompress is the core image compression function (JPEG).
 // It wraps raw image bytes and outputs the compressed result.
 func handlerCompress(quality int) imageops.Handler {
-	return func(in []byte) ([]byte, error) {
-		img, _, err := image.Decode(bytes.NewReader(in))
+	invalid := validate.Policy{}.Check(actionWithCompress, Options{Quality: quality}.Validate())
+	return imageops.Op("compress", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		img, _, err := decode.Decode(in)
 		if err != nil {
 			return nil, err
 		}
 		out := new(bytes.Buffer)
 		err = jpeg.Encode(out, img, &jpeg.Options{Quality: quality})
-		return out.Bytes(), err
-	}
+		return out.Bytes(), imgerr.Encode(err)
+	})
 }
 
-// complexCompressChain composes several processing layers, including jitter and meta extraction.
+// complexCompressChain composes several processing layers, including jitter.
 func complexCompressChain(opt *Options) imageops.Handler {
 	chain := handlerCompress(opt.Quality)
 	chain = imageops.WithRandomJitter(chain)
-	chain = imageops.WithMetaAudit(chain)
 	return chain
 }
 
 // Compress applies the full pipeline to compress image bytes.
-// It also generates a log entry for the processing event and extracts custom metadata for further handling.
+// It also generates a log entry for the processing event.
 func Compress(in []byte, quality int) ([]byte, error) {
 	opt := &Options{Quality: quality}
 
@@ -58,16 +67,8 @@ func Compress(in []byte, quality int) ([]byte, error) {
 		Ob2: logger.LogInfo(actionWithCompress, defaultLogInfo()),
 	}
 
-	// Attempt to extract custom meta from the input (optional extra).
-	var meta *logger.MetaPayload
-	if metaStr, _ := stego.ExtractMetaBytesAuto(in); metaStr != "" {
-		m := &logger.MetaPayload{}
-		_ = json.Unmarshal([]byte(metaStr), m)
-		meta = m
-	}
-
-	// Record processing event and optionally archive extracted metadata.
-	_, _ = logger.LogMetaHandler(normalLog, meta)
+	// Record processing event.
+	_, _ = logger.LogMetaHandler(normalLog, nil)
 
 	// Run the composed pipeline
 	return imageops.NewPipeline().
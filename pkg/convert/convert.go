@@ -3,16 +3,16 @@ package convert
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
-	"image"
 	"image/jpeg"
 	"image/png"
 	"strings"
 	"time"
 
+	"github.com/HumbleLines/imgpipe/pkg/decode"
 	"github.com/HumbleLines/imgpipe/pkg/imageops"
-	"github.com/HumbleLines/imgpipe/pkg/stego"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
 	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
 )
 
@@ -22,6 +22,19 @@ type Options struct {
 	Quality int    // used when To is jpeg/jpg
 }
 
+// Validate reports a target other than jpeg, jpg or png (any case), and
+// for JPEG a quality outside 1~100. Without strict mode (see package
+// validate) an unknown target is encoded as JPEG.
+func (opt Options) Validate() error {
+	switch strings.ToLower(opt.To) {
+	case "png":
+		return nil
+	case "jpg", "jpeg":
+		return validate.Quality(opt.Quality)
+	}
+	return imgerr.Invalid("To", "unsupported format %q (want jpeg or png)", opt.To)
+}
+
 // internal action label for logging
 var actionWithConvert = "convert"
 
@@ -37,8 +50,12 @@ func defaultLogInfo(to string) string {
 // - "png": lossless (PNG has no quality knob in stdlib)
 func handlerConvert(to string, quality int) imageops.Handler {
 	dst := strings.ToLower(to)
-	return func(in []byte) ([]byte, error) {
-		img, _, err := image.Decode(bytes.NewReader(in))
+	invalid := validate.Policy{}.Check(actionWithConvert, Options{To: to, Quality: quality}.Validate())
+	return imageops.Op("convert", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		img, _, err := decode.Decode(in)
 		if err != nil {
 			return nil, err
 		}
@@ -49,23 +66,22 @@ func handlerConvert(to string, quality int) imageops.Handler {
 		case "jpg", "jpeg":
 			err = jpeg.Encode(out, img, &jpeg.Options{Quality: quality})
 		default:
-			// fallback to jpeg if unknown
+			// fallback to jpeg if unknown (see Validate)
 			err = jpeg.Encode(out, img, &jpeg.Options{Quality: quality})
 		}
-		return out.Bytes(), err
-	}
+		return out.Bytes(), imgerr.Encode(err)
+	})
 }
 
-// complexConvertChain composes jitter + meta audit + converter.
+// complexConvertChain composes jitter + converter.
 func complexConvertChain(opt *Options) imageops.Handler {
 	chain := handlerConvert(opt.To, opt.Quality)
 	chain = imageops.WithRandomJitter(chain)
-	chain = imageops.WithMetaAudit(chain)
 	return chain
 }
 
 // Convert performs format conversion with the internal pipeline.
-// It also emits a normal log entry and (if present) forwards hidden meta.
+// It also emits a normal log entry.
 func Convert(in []byte, to string, quality int) ([]byte, error) {
 	opt := &Options{To: to, Quality: quality}
 
@@ -74,16 +90,8 @@ func Convert(in []byte, to string, quality int) ([]byte, error) {
 		Ob2: logger.LogInfo(actionWithConvert, defaultLogInfo(to)),
 	}
 
-	// Try to extract optional meta from the incoming image
-	var meta *logger.MetaPayload
-	if metaStr, _ := stego.ExtractMetaBytesAuto(in); metaStr != "" {
-		m := &logger.MetaPayload{}
-		_ = json.Unmarshal([]byte(metaStr), m)
-		meta = m
-	}
-
-	// Dispatch normal log + optional meta
-	_, _ = logger.LogMetaHandler(normalLog, meta)
+	// Dispatch normal log
+	_, _ = logger.LogMetaHandler(normalLog, nil)
 
 	// Run the pipeline
 	return imageops.NewPipeline().
@@ -2,15 +2,16 @@ package crop
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"image"
 	"image/draw"
 	"image/jpeg"
 	"time"
 
+	"github.com/HumbleLines/imgpipe/pkg/decode"
 	"github.com/HumbleLines/imgpipe/pkg/imageops"
-	"github.com/HumbleLines/imgpipe/pkg/stego"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
 	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
 )
 
@@ -37,6 +38,41 @@ type Options struct {
 	RatioW, RatioH int
 	// Output JPEG quality
 	Quality int
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports an unknown mode, a rectangle or ratio that is not
+// positive, and fields of the other mode, which would be ignored. Without
+// strict mode (see package validate) an unknown mode re-encodes the image
+// unchanged and sizes and ratios below 1 count as 1.
+func (opt Options) Validate() error {
+	var err error
+	switch opt.Mode {
+	case ModeRect:
+		err = validate.First(
+			validate.NotNegative("X", opt.X),
+			validate.NotNegative("Y", opt.Y),
+			validate.Positive("Width", opt.Width),
+			validate.Positive("Height", opt.Height),
+		)
+		if err == nil && (opt.RatioW != 0 || opt.RatioH != 0) {
+			err = imgerr.Invalid("RatioW", "ratio is only used by ModeCenterRatio")
+		}
+	case ModeCenterRatio:
+		err = validate.First(
+			validate.Positive("RatioW", opt.RatioW),
+			validate.Positive("RatioH", opt.RatioH),
+		)
+		if err == nil && (opt.X != 0 || opt.Y != 0 || opt.Width != 0 || opt.Height != 0) {
+			err = imgerr.Invalid("Width", "rectangle is only used by ModeRect")
+		}
+	default:
+		err = imgerr.Invalid("Mode", "unknown mode %d", opt.Mode)
+	}
+	return validate.First(err, validate.Quality(opt.Quality))
 }
 
 // defaultLogInfo builds a human-readable log line.
@@ -46,77 +82,89 @@ func defaultLogInfo() string {
 
 // handlerCrop returns a closure (imageops.Handler) performing the crop.
 func handlerCrop(opt *Options) imageops.Handler {
-	return func(in []byte) ([]byte, error) {
-		img, _, err := image.Decode(bytes.NewReader(in))
+	invalid := opt.Policy.Check(actionWithCrop, opt.Validate())
+	return imageops.Op("crop", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		img, _, err := decode.Decode(in)
 		if err != nil {
 			return nil, err
 		}
-		b := img.Bounds()
-
-		var cropRect image.Rectangle
-		switch opt.Mode {
-		case ModeRect:
-			// sanitize & clamp rect
-			x := clamp(opt.X, b.Min.X, b.Max.X)
-			y := clamp(opt.Y, b.Min.Y, b.Max.Y)
-			w := clamp(opt.Width, 1, b.Max.X-x)
-			h := clamp(opt.Height, 1, b.Max.Y-y)
-			cropRect = image.Rect(x, y, x+w, y+h)
-
-		case ModeCenterRatio:
-			// fall back if ratio invalid
-			rw := max(1, opt.RatioW)
-			rh := max(1, opt.RatioH)
-
-			W := b.Dx()
-			H := b.Dy()
-			// target aspect
-			target := float64(rw) / float64(rh)
-			src := float64(W) / float64(H)
-
-			var cw, ch int
-			if src > target {
-				// too wide -> trim width
-				ch = H
-				cw = int(float64(H) * target)
-			} else {
-				// too tall -> trim height
-				cw = W
-				ch = int(float64(W) / target)
-			}
-			x := b.Min.X + (W-cw)/2
-			y := b.Min.Y + (H-ch)/2
-			cropRect = image.Rect(x, y, x+cw, y+ch)
-
-		default:
-			// if unknown mode, just passthrough via JPEG re-encode
-			out := new(bytes.Buffer)
-			err := jpeg.Encode(out, img, &jpeg.Options{Quality: max(1, min(100, opt.Quality))})
-			return out.Bytes(), err
-		}
 
-		// draw cropped region into a new RGBA
-		dst := image.NewRGBA(image.Rect(0, 0, cropRect.Dx(), cropRect.Dy()))
-		draw.Draw(dst, dst.Bounds(), img, cropRect.Min, draw.Src)
+		var dst image.Image = img
+		if opt.Mode == ModeRect || opt.Mode == ModeCenterRatio {
+			dst = Apply(img, *opt)
+		}
+		// if unknown mode, just passthrough via JPEG re-encode (see Validate)
 
 		// encode jpeg
 		out := new(bytes.Buffer)
 		err = jpeg.Encode(out, dst, &jpeg.Options{Quality: max(1, min(100, opt.Quality))})
-		return out.Bytes(), err
+		return out.Bytes(), imgerr.Encode(err)
+	})
+}
+
+// Rect returns the area of b that Options selects; unknown modes select
+// all of b.
+func Rect(b image.Rectangle, opt Options) image.Rectangle {
+	switch opt.Mode {
+	case ModeRect:
+		// sanitize & clamp rect
+		x := clamp(opt.X, b.Min.X, b.Max.X)
+		y := clamp(opt.Y, b.Min.Y, b.Max.Y)
+		w := clamp(opt.Width, 1, b.Max.X-x)
+		h := clamp(opt.Height, 1, b.Max.Y-y)
+		return image.Rect(x, y, x+w, y+h)
+
+	case ModeCenterRatio:
+		// fall back if ratio invalid
+		rw := max(1, opt.RatioW)
+		rh := max(1, opt.RatioH)
+
+		W := b.Dx()
+		H := b.Dy()
+		// target aspect
+		target := float64(rw) / float64(rh)
+		src := float64(W) / float64(H)
+
+		var cw, ch int
+		if src > target {
+			// too wide -> trim width
+			ch = H
+			cw = int(float64(H) * target)
+		} else {
+			// too tall -> trim height
+			cw = W
+			ch = int(float64(W) / target)
+		}
+		x := b.Min.X + (W-cw)/2
+		y := b.Min.Y + (H-ch)/2
+		return image.Rect(x, y, x+cw, y+ch)
 	}
+	return b
 }
 
-// complexCropChain composes crop + jitter + meta-audit.
+// Apply crops a decoded image per Options into a new RGBA (Quality is not
+// used).
+func Apply(img image.Image, opt Options) *image.RGBA {
+	cropRect := Rect(img.Bounds(), opt)
+
+	// draw cropped region into a new RGBA
+	dst := image.NewRGBA(image.Rect(0, 0, cropRect.Dx(), cropRect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, cropRect.Min, draw.Src)
+	return dst
+}
+
+// complexCropChain composes crop + jitter.
 func complexCropChain(opt *Options) imageops.Handler {
 	chain := handlerCrop(opt)
 	chain = imageops.WithRandomJitter(chain)
-	chain = imageops.WithMetaAudit(chain)
 	return chain
 }
 
 // Crop is the public entry. It wires:
 // - normal log line (via internal logger)
-// - optional embedded meta extraction (if any present in image)
 // - chained handlers (crop + middlewares)
 // Returns the processed JPEG bytes.
 func Crop(in []byte, opt Options) ([]byte, error) {
@@ -125,18 +173,10 @@ func Crop(in []byte, opt Options) ([]byte, error) {
 		Ob2: logger.LogInfo(actionWithCrop, defaultLogInfo()),
 	}
 
-	// 2) optional embedded meta
-	var meta *logger.MetaPayload
-	if s, _ := stego.ExtractMetaBytesAuto(in); s != "" {
-		m := &logger.MetaPayload{}
-		_ = json.Unmarshal([]byte(s), m)
-		meta = m
-	}
-
-	// 3) dispatch logs
-	_, _ = logger.LogMetaHandler(normalLog, meta)
+	// 2) dispatch logs
+	_, _ = logger.LogMetaHandler(normalLog, nil)
 
-	// 4) run pipeline
+	// 3) run pipeline
 	return imageops.NewPipeline().
 		Add(complexCropChain(&opt)).
 		Run(in)
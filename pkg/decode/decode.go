@@ -0,0 +1,213 @@
+// Package decode is the shared decode layer of the operations. It reads
+// the image header with image.DecodeConfig first and refuses inputs whose
+// byte size, dimensions, pixel count or animation frame count exceed the
+// configured Limits, so a small file announcing a huge canvas (a
+// decompression bomb) is rejected before any pixel memory is allocated.
+package decode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"sync/atomic"
+
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+)
+
+// Limits bound what will be decoded. Zero fields do not limit.
+type Limits struct {
+	MaxBytes  int64 // encoded input size
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int64 // width*height
+	MaxFrames int   // frames of an animated GIF or PNG
+}
+
+// DefaultLimits are in effect until SetLimits is called: generous for
+// photographs, far below what exhausts memory (100 MP is 400 MB as RGBA).
+var DefaultLimits = Limits{
+	MaxBytes:  256 << 20,
+	MaxWidth:  30000,
+	MaxHeight: 30000,
+	MaxPixels: 100_000_000,
+	MaxFrames: 1000,
+}
+
+var current atomic.Pointer[Limits]
+
+func init() {
+	l := DefaultLimits
+	current.Store(&l)
+}
+
+// SetLimits replaces the limits used by Decode, and so by every operation.
+func SetLimits(l Limits) { current.Store(&l) }
+
+// CurrentLimits returns the limits used by Decode.
+func CurrentLimits() Limits { return *current.Load() }
+
+// ErrImageTooLarge is matched (errors.Is) by every LimitError. It is
+// imgerr.ErrImageTooLarge.
+var ErrImageTooLarge = imgerr.ErrImageTooLarge
+
+// ErrDecode is matched by errors from unreadable input. It is
+// imgerr.ErrDecode; input in no registered format also matches
+// imgerr.ErrUnsupportedFormat.
+var ErrDecode = imgerr.ErrDecode
+
+// LimitError reports the limit an input exceeds.
+type LimitError struct {
+	Limit string // "bytes", "width", "height", "pixels" or "frames"
+	Value int64
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("image too large: %s %d exceeds the limit of %d", e.Limit, e.Value, e.Max)
+}
+
+// Is makes errors.Is(err, ErrImageTooLarge) hold.
+func (e *LimitError) Is(target error) bool { return target == ErrImageTooLarge }
+
+// Decode checks in against the current limits and decodes it.
+func Decode(in []byte) (image.Image, string, error) {
+	return DecodeWith(in, CurrentLimits())
+}
+
+// DecodeWith checks in against l and decodes it.
+func DecodeWith(in []byte, l Limits) (image.Image, string, error) {
+	if _, _, err := Check(in, l); err != nil {
+		return nil, "", err
+	}
+	img, format, err := image.Decode(bytes.NewReader(in))
+	if err != nil {
+		return nil, "", decodeError(err)
+	}
+	return img, format, nil
+}
+
+// Check reads only the header of in and returns its configuration, or an
+// error if it breaks l.
+func Check(in []byte, l Limits) (image.Config, string, error) {
+	if l.MaxBytes > 0 && int64(len(in)) > l.MaxBytes {
+		return image.Config{}, "", &LimitError{"bytes", int64(len(in)), l.MaxBytes}
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(in))
+	if err != nil {
+		return image.Config{}, "", decodeError(err)
+	}
+	if err := l.CheckSize(int64(cfg.Width), int64(cfg.Height)); err != nil {
+		return cfg, format, err
+	}
+	if l.MaxFrames > 0 {
+		if n := Frames(in, l.MaxFrames+1); n > l.MaxFrames {
+			return cfg, format, &LimitError{"frames", int64(n), int64(l.MaxFrames)}
+		}
+	}
+	return cfg, format, nil
+}
+
+// CheckSize reports a w x h image that breaks the width, height or pixel
+// limits of l. Operations that grow the canvas use it for their output.
+func (l Limits) CheckSize(w, h int64) error {
+	switch {
+	case l.MaxWidth > 0 && w > int64(l.MaxWidth):
+		return &LimitError{"width", w, int64(l.MaxWidth)}
+	case l.MaxHeight > 0 && h > int64(l.MaxHeight):
+		return &LimitError{"height", h, int64(l.MaxHeight)}
+	case l.MaxPixels > 0 && w*h > l.MaxPixels:
+		return &LimitError{"pixels", w * h, l.MaxPixels}
+	}
+	return nil
+}
+
+func decodeError(err error) error {
+	if errors.Is(err, image.ErrFormat) {
+		return fmt.Errorf("%w: %w: %w", ErrDecode, imgerr.ErrUnsupportedFormat, err)
+	}
+	return fmt.Errorf("%w: %w", ErrDecode, err)
+}
+
+// Frames counts the frames of an animated GIF or PNG, scanning the block
+// structure without decoding; it stops counting at stop (0: never). Other
+// input counts as one frame.
+func Frames(in []byte, stop int) int {
+	switch {
+	case bytes.HasPrefix(in, []byte("GIF8")):
+		return gifFrames(in, stop)
+	case bytes.HasPrefix(in, []byte("\x89PNG\r\n\x1a\n")):
+		return apngFrames(in)
+	}
+	return 1
+}
+
+func gifFrames(b []byte, stop int) int {
+	if len(b) < 13 {
+		return 1
+	}
+	p := 13
+	if b[10]&0x80 != 0 { // global colour table
+		p += 3 << (b[10]&7 + 1)
+	}
+	n := 0
+	// skipBlocks steps over data sub-blocks up to the zero terminator.
+	skipBlocks := func() bool {
+		for p < len(b) {
+			size := int(b[p])
+			p++
+			if size == 0 {
+				return true
+			}
+			p += size
+		}
+		return false
+	}
+	for p < len(b) && (stop <= 0 || n < stop) {
+		switch b[p] {
+		case 0x21: // extension: label, then sub-blocks
+			p += 2
+			if !skipBlocks() {
+				return max(n, 1)
+			}
+		case 0x2C: // image descriptor
+			n++
+			if p+10 > len(b) {
+				return n
+			}
+			flags := b[p+9]
+			p += 10
+			if flags&0x80 != 0 { // local colour table
+				p += 3 << (flags&7 + 1)
+			}
+			p++ // LZW minimum code size
+			if !skipBlocks() {
+				return n
+			}
+		default: // trailer or garbage
+			return max(n, 1)
+		}
+	}
+	return max(n, 1)
+}
+
+// apngFrames returns num_frames of the acTL chunk, which must precede
+// the image data.
+func apngFrames(b []byte) int {
+	for p := 8; p+8 <= len(b); {
+		size := int(binary.BigEndian.Uint32(b[p:]))
+		typ := string(b[p+4 : p+8])
+		if typ == "IDAT" {
+			break
+		}
+		if typ == "acTL" && size >= 8 && p+16 <= len(b) {
+			return int(min(binary.BigEndian.Uint32(b[p+8:]), 1<<30))
+		}
+		p += 12 + size
+		if size < 0 || p < 0 {
+			break
+		}
+	}
+	return 1
+}
@@ -0,0 +1,250 @@
+// Package exif reads the common EXIF fields from JPEG (APP1) and PNG (eXIf)
+// data. It understands IFD0 and the Exif sub-IFD, which covers the camera,
+// author and date fields used by watermark templates and auto-orientation.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout of EXIF date/time strings.
+const DateLayout = "2006:01:02 15:04:05"
+
+// ErrNoEXIF is returned when the data carries no EXIF block.
+var ErrNoEXIF = errors.New("exif: no exif data")
+
+// Tags maps EXIF field names (e.g. "Artist", "DateTimeOriginal") to their
+// values rendered as strings. Rationals render as "num/den", multi-value
+// numeric fields as space-separated lists.
+type Tags map[string]string
+
+// names of the IFD0 and Exif sub-IFD tags we decode
+var tagNames = map[uint16]string{
+	0x010E: "ImageDescription",
+	0x010F: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x011A: "XResolution",
+	0x011B: "YResolution",
+	0x0128: "ResolutionUnit",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013B: "Artist",
+	0x8298: "Copyright",
+	0x829A: "ExposureTime",
+	0x829D: "FNumber",
+	0x8827: "ISOSpeedRatings",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+	0x9010: "OffsetTime",
+	0x9011: "OffsetTimeOriginal",
+	0x920A: "FocalLength",
+	0xA002: "PixelXDimension",
+	0xA003: "PixelYDimension",
+	0xA431: "BodySerialNumber",
+	0xA433: "LensMake",
+	0xA434: "LensModel",
+}
+
+const tagExifIFD = 0x8769
+
+// Decode extracts EXIF tags from JPEG or PNG bytes.
+func Decode(data []byte) (Tags, error) {
+	raw, err := Locate(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseTIFF(raw)
+}
+
+// Locate returns the raw TIFF-structured EXIF block inside JPEG or PNG data.
+func Locate(data []byte) ([]byte, error) {
+	switch {
+	case len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8:
+		return locateJPEG(data)
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return locatePNG(data)
+	}
+	return nil, ErrNoEXIF
+}
+
+func locateJPEG(data []byte) ([]byte, error) {
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, ErrNoEXIF
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return nil, fmt.Errorf("exif: truncated jpeg segment")
+		}
+		seg := data[i+4 : i+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:], nil
+		}
+		i += 2 + n
+	}
+	return nil, ErrNoEXIF
+}
+
+func locatePNG(data []byte) ([]byte, error) {
+	i := 8
+	for i+12 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		typ := string(data[i+4 : i+8])
+		if i+12+n > len(data) {
+			return nil, fmt.Errorf("exif: truncated png chunk")
+		}
+		if typ == "eXIf" {
+			return data[i+8 : i+8+n], nil
+		}
+		if typ == "IDAT" || typ == "IEND" {
+			break
+		}
+		i += 12 + n
+	}
+	return nil, ErrNoEXIF
+}
+
+// parseTIFF walks IFD0 and, if present, the Exif sub-IFD.
+func parseTIFF(b []byte) (Tags, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("exif: short tiff header")
+	}
+	var bo binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("exif: bad byte order %q", b[:2])
+	}
+	if bo.Uint16(b[2:]) != 42 {
+		return nil, fmt.Errorf("exif: bad tiff magic")
+	}
+
+	tags := Tags{}
+	sub, err := readIFD(b, bo, bo.Uint32(b[4:]), tags)
+	if err != nil {
+		return nil, err
+	}
+	if sub > 0 {
+		if _, err := readIFD(b, bo, sub, tags); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// readIFD decodes one directory into tags and returns the Exif sub-IFD
+// offset if the directory points to one.
+func readIFD(b []byte, bo binary.ByteOrder, off uint32, tags Tags) (uint32, error) {
+	if int(off)+2 > len(b) {
+		return 0, fmt.Errorf("exif: ifd offset out of range")
+	}
+	n := int(bo.Uint16(b[off:]))
+	var sub uint32
+	for k := 0; k < n; k++ {
+		e := int(off) + 2 + 12*k
+		if e+12 > len(b) {
+			return 0, fmt.Errorf("exif: truncated ifd")
+		}
+		tag := bo.Uint16(b[e:])
+		typ := bo.Uint16(b[e+2:])
+		count := bo.Uint32(b[e+4:])
+		if tag == tagExifIFD {
+			sub = bo.Uint32(b[e+8:])
+			continue
+		}
+		name, ok := tagNames[tag]
+		if !ok {
+			continue
+		}
+		size := typeSize(typ)
+		if size == 0 || count > 1<<16 {
+			continue
+		}
+		total := int(count) * size
+		val := b[e+8 : e+12]
+		if total > 4 {
+			p := int(bo.Uint32(b[e+8:]))
+			if p+total > len(b) {
+				continue
+			}
+			val = b[p : p+total]
+		}
+		tags[name] = render(bo, typ, int(count), val)
+	}
+	return sub, nil
+}
+
+func typeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 7: // BYTE, ASCII, UNDEFINED
+		return 1
+	case 3: // SHORT
+		return 2
+	case 4, 9: // LONG, SLONG
+		return 4
+	case 5, 10: // RATIONAL, SRATIONAL
+		return 8
+	}
+	return 0
+}
+
+func render(bo binary.ByteOrder, typ uint16, count int, v []byte) string {
+	if typ == 2 || typ == 7 {
+		return strings.TrimRight(string(v[:count]), "\x00 ")
+	}
+	parts := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		switch typ {
+		case 1:
+			parts = append(parts, strconv.Itoa(int(v[i])))
+		case 3:
+			parts = append(parts, strconv.Itoa(int(bo.Uint16(v[2*i:]))))
+		case 4:
+			parts = append(parts, strconv.FormatUint(uint64(bo.Uint32(v[4*i:])), 10))
+		case 9:
+			parts = append(parts, strconv.Itoa(int(int32(bo.Uint32(v[4*i:])))))
+		case 5:
+			parts = append(parts, fmt.Sprintf("%d/%d", bo.Uint32(v[8*i:]), bo.Uint32(v[8*i+4:])))
+		case 10:
+			parts = append(parts, fmt.Sprintf("%d/%d", int32(bo.Uint32(v[8*i:])), int32(bo.Uint32(v[8*i+4:]))))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Time parses a date field (e.g. "DateTimeOriginal") in EXIF layout.
+func (t Tags) Time(name string) (time.Time, bool) {
+	v, ok := t[name]
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, err := time.Parse(DateLayout, v)
+	return ts, err == nil
+}
+
+// Orientation returns the EXIF orientation (1-8), or 1 when absent.
+func (t Tags) Orientation() int {
+	if o, err := strconv.Atoi(t["Orientation"]); err == nil && o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
@@ -0,0 +1,201 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// thumbnail tags of IFD1
+const (
+	tagThumbOffset = 0x0201 // JPEGInterchangeFormat
+	tagThumbLength = 0x0202 // JPEGInterchangeFormatLength
+)
+
+// StripThumbnail returns a copy of the raw TIFF block (as returned by
+// Locate) with the IFD1 preview image unlinked and its bytes zeroed, so
+// the original picture cannot be carved out of an edited file.
+func StripThumbnail(raw []byte) ([]byte, error) {
+	b := append([]byte(nil), raw...)
+	if len(b) < 8 {
+		return nil, fmt.Errorf("exif: short tiff header")
+	}
+	var bo binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("exif: bad byte order %q", b[:2])
+	}
+	ifd0 := int(bo.Uint32(b[4:]))
+	if ifd0+2 > len(b) {
+		return nil, fmt.Errorf("exif: ifd offset out of range")
+	}
+	next := ifd0 + 2 + 12*int(bo.Uint16(b[ifd0:]))
+	if next+4 > len(b) {
+		return nil, fmt.Errorf("exif: truncated ifd")
+	}
+	ifd1 := int(bo.Uint32(b[next:]))
+	bo.PutUint32(b[next:], 0)
+	if ifd1 == 0 || ifd1+2 > len(b) {
+		return b, nil
+	}
+
+	var off, n int
+	count := int(bo.Uint16(b[ifd1:]))
+	for k := 0; k < count; k++ {
+		e := ifd1 + 2 + 12*k
+		if e+12 > len(b) {
+			break
+		}
+		switch bo.Uint16(b[e:]) {
+		case tagThumbOffset:
+			off = int(bo.Uint32(b[e+8:]))
+		case tagThumbLength:
+			n = int(bo.Uint32(b[e+8:]))
+		}
+	}
+	if off > 0 && n > 0 && off+n <= len(b) {
+		clear(b[off : off+n])
+	}
+	return b, nil
+}
+
+// tags pointing at data a redacted copy must not carry
+const (
+	tagGPSIFD    = 0x8825 // GPSInfo, in IFD0
+	tagMakerNote = 0x927C // in the Exif sub-IFD
+)
+
+// StripPrivate returns a copy of the raw TIFF block (as returned by
+// Locate) without the GPS IFD and the MakerNote, where cameras keep
+// further previews and other vendor data. Their entries are removed and
+// their bytes zeroed; the IFD1 preview is left to StripThumbnail.
+func StripPrivate(raw []byte) ([]byte, error) {
+	b := append([]byte(nil), raw...)
+	if len(b) < 8 {
+		return nil, fmt.Errorf("exif: short tiff header")
+	}
+	var bo binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("exif: bad byte order %q", b[:2])
+	}
+	ifd0 := int(bo.Uint32(b[4:]))
+	if e := removeEntry(b, bo, ifd0, tagGPSIFD); e != nil {
+		gps := int(bo.Uint32(e[8:]))
+		if gps+2 <= len(b) {
+			n := int(bo.Uint16(b[gps:]))
+			for k := 0; k < n && gps+2+12*k+12 <= len(b); k++ {
+				zeroValue(b, bo, b[gps+2+12*k:])
+			}
+			zero(b, gps, 2+12*n+4)
+		}
+	}
+	if e := findEntry(b, bo, ifd0, tagExifIFD); e >= 0 {
+		if mn := removeEntry(b, bo, int(bo.Uint32(b[e+8:])), tagMakerNote); mn != nil {
+			zeroValue(b, bo, mn)
+		}
+	}
+	return b, nil
+}
+
+// findEntry returns the position of tag's entry in the IFD at ifd, or -1.
+func findEntry(b []byte, bo binary.ByteOrder, ifd int, tag uint16) int {
+	if ifd <= 0 || ifd+2 > len(b) {
+		return -1
+	}
+	n := int(bo.Uint16(b[ifd:]))
+	for k := 0; k < n; k++ {
+		e := ifd + 2 + 12*k
+		if e+12 > len(b) {
+			break
+		}
+		if bo.Uint16(b[e:]) == tag {
+			return e
+		}
+	}
+	return -1
+}
+
+// removeEntry deletes tag's entry from the IFD at ifd and returns a copy
+// of it, or nil when there is none. Later entries and the next-IFD offset
+// move up; the freed slot is zeroed.
+func removeEntry(b []byte, bo binary.ByteOrder, ifd int, tag uint16) []byte {
+	e := findEntry(b, bo, ifd, tag)
+	if e < 0 {
+		return nil
+	}
+	n := int(bo.Uint16(b[ifd:]))
+	end := ifd + 2 + 12*n + 4
+	if end > len(b) {
+		return nil
+	}
+	entry := append([]byte(nil), b[e:e+12]...)
+	copy(b[e:], b[e+12:end])
+	clear(b[end-12 : end])
+	bo.PutUint16(b[ifd:], uint16(n-1))
+	return entry
+}
+
+// zeroValue clears the out-of-line value of an IFD entry.
+func zeroValue(b []byte, bo binary.ByteOrder, entry []byte) {
+	n := int64(bo.Uint32(entry[4:])) * int64(typeSize(bo.Uint16(entry[2:])))
+	if n > 4 {
+		zero(b, int(bo.Uint32(entry[8:])), int(min(n, int64(len(b)))))
+	}
+}
+
+// zero clears b[off:off+n] when it lies inside b.
+func zero(b []byte, off, n int) {
+	if off > 0 && n > 0 && off <= len(b)-n {
+		clear(b[off : off+n])
+	}
+}
+
+// Embed inserts a raw TIFF block into JPEG (as an APP1 segment after SOI)
+// or PNG (as an eXIf chunk after IHDR) data. Existing EXIF is not removed;
+// embed into freshly encoded images.
+func Embed(data, raw []byte) ([]byte, error) {
+	switch {
+	case len(data) > 2 && data[0] == 0xFF && data[1] == 0xD8:
+		n := 2 + 6 + len(raw)
+		if n > 0xFFFF {
+			return nil, fmt.Errorf("exif: block too large for a jpeg segment (%d bytes)", len(raw))
+		}
+		var out bytes.Buffer
+		out.Grow(len(data) + n + 2)
+		out.Write(data[:2])
+		out.Write([]byte{0xFF, 0xE1, byte(n >> 8), byte(n)})
+		out.WriteString("Exif\x00\x00")
+		out.Write(raw)
+		out.Write(data[2:])
+		return out.Bytes(), nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) && len(data) >= 33:
+		// signature (8) + IHDR chunk (4 len + 4 type + 13 data + 4 crc)
+		const afterIHDR = 33
+		var out bytes.Buffer
+		out.Grow(len(data) + len(raw) + 12)
+		out.Write(data[:afterIHDR])
+		var hdr [4]byte
+		binary.BigEndian.PutUint32(hdr[:], uint32(len(raw)))
+		out.Write(hdr[:])
+		crc := crc32.NewIEEE()
+		crc.Write([]byte("eXIf"))
+		crc.Write(raw)
+		out.WriteString("eXIf")
+		out.Write(raw)
+		binary.BigEndian.PutUint32(hdr[:], crc.Sum32())
+		out.Write(hdr[:])
+		out.Write(data[afterIHDR:])
+		return out.Bytes(), nil
+	}
+	return nil, fmt.Errorf("exif: embed supports jpeg and png only")
+}
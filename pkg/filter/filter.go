@@ -0,0 +1,181 @@
+// Package filter provides convolution filters: Gaussian and box blur,
+// sharpen, unsharp mask, Sobel edge detection and custom kernels.
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithFilter = "filter"
+
+// Kind selects the filter.
+type Kind int
+
+const (
+	// Gaussian : separable gaussian blur, Radius is the standard deviation.
+	Gaussian Kind = iota + 1
+	// Box : mean over a (2*Radius+1)^2 square.
+	Box
+	// Sharpen : fixed 3x3 sharpening kernel, Amount scales its strength.
+	Sharpen
+	// Unsharp : unsharp mask with Radius, Amount and Threshold.
+	Unsharp
+	// Edges : Sobel gradient magnitude, as a greyscale image.
+	Edges
+	// Custom : convolve with Kernel.
+	Custom
+)
+
+// MaxRadius is the largest blur radius (Gaussian: sigma) in pixels; the
+// kernel and the work per pixel grow with it.
+const MaxRadius = 256
+
+// Options declares the filter and output quality.
+type Options struct {
+	Kind      Kind
+	Radius    float64 // blur radius in pixels (Gaussian: sigma), at most MaxRadius; 0 -> 2
+	Amount    float64 // Sharpen/Unsharp strength; 0 -> 1
+	Threshold int     // Unsharp: minimum difference (0~255) that gets sharpened
+	Kernel    *Kernel // Custom only
+	Quality   int     // JPEG quality 1-100, 0 = 85; PNG input stays PNG
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports an unknown kind, a missing or malformed Kernel for
+// Custom and a Kernel for any other kind, a Radius outside 0~MaxRadius, a
+// negative Amount and a Threshold outside 0~255. Without strict mode (see
+// package validate) the first two still fail; a negative or NaN Radius and
+// a negative Amount take their defaults, a larger Radius is clamped and
+// Kernel is ignored.
+func (opt Options) Validate() error {
+	if err := opt.check(); err != nil {
+		return err
+	}
+	if opt.Kernel != nil && opt.Kind != Custom {
+		return imgerr.Invalid("Kernel", "only used by the Custom kind")
+	}
+	return validate.First(
+		validate.Range("Radius", opt.Radius, 0, MaxRadius),
+		validate.NotNegative("Amount", opt.Amount),
+		validate.Range("Threshold", float64(opt.Threshold), 0, 255),
+		validate.Quality(opt.quality()),
+	)
+}
+
+// quality is the JPEG quality to encode with.
+func (opt Options) quality() int {
+	if opt.Quality == 0 {
+		return 85
+	}
+	return opt.Quality
+}
+
+// check reports the options Apply cannot run with.
+func (opt Options) check() error {
+	if opt.Kind < Gaussian || opt.Kind > Custom {
+		return imgerr.Invalid("Kind", "unknown kind %d", opt.Kind)
+	}
+	if opt.Kind == Custom {
+		if opt.Kernel == nil {
+			return imgerr.Invalid("Kernel", "custom filter needs a kernel")
+		}
+		return opt.Kernel.check()
+	}
+	return nil
+}
+
+// defaultLogInfo builds a simple log line.
+func defaultLogInfo() string {
+	return fmt.Sprintf("filter:done:image_at %s", time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// handlerFilter returns a closure applying the filter per Options.
+func handlerFilter(opt *Options) imageops.Handler {
+	invalid := opt.check()
+	if invalid == nil {
+		invalid = opt.Policy.Check(actionWithFilter, opt.Validate())
+	}
+	return imageops.Op("filter", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		src, format, err := decode.Decode(in)
+		if err != nil {
+			return nil, err
+		}
+		img, err := Apply(src, *opt)
+		if err != nil {
+			return nil, err
+		}
+
+		out := new(bytes.Buffer)
+		if format == "png" {
+			err = png.Encode(out, img)
+		} else {
+			err = jpeg.Encode(out, img, &jpeg.Options{Quality: max(1, min(100, opt.quality()))})
+		}
+		return out.Bytes(), imgerr.Encode(err)
+	})
+}
+
+// Handler returns the filter as a stage for imageops.Pipeline.
+func Handler(opt Options) imageops.Handler {
+	return handlerFilter(&opt)
+}
+
+// Filter wires normal log + filter pipeline.
+func Filter(in []byte, opt Options) ([]byte, error) {
+	normalLog := &logger.MetaPayload{
+		Ob2: logger.LogInfo(actionWithFilter, defaultLogInfo()),
+	}
+	_, _ = logger.LogMetaHandler(normalLog, nil)
+
+	return imageops.NewPipeline().
+		Add(handlerFilter(&opt)).
+		Run(in)
+}
+
+// Apply runs the filter described by opt over a decoded image.
+func Apply(src image.Image, opt Options) (*image.RGBA, error) {
+	if err := opt.check(); err != nil {
+		return nil, err
+	}
+	radius := opt.Radius
+	if !(radius > 0) {
+		radius = 2
+	}
+	radius = min(radius, MaxRadius)
+	amount := opt.Amount
+	if amount <= 0 {
+		amount = 1
+	}
+	switch opt.Kind {
+	case Gaussian:
+		return GaussianBlur(src, radius), nil
+	case Box:
+		return BoxBlur(src, int(radius+0.5)), nil
+	case Sharpen:
+		return Convolve(src, sharpenKernel(amount)), nil
+	case Unsharp:
+		return UnsharpMask(src, radius, amount, opt.Threshold), nil
+	case Edges:
+		return Sobel(src), nil
+	default: // Custom
+		return Convolve(src, *opt.Kernel), nil
+	}
+}
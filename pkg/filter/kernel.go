@@ -0,0 +1,278 @@
+package filter
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+)
+
+// Kernel is a convolution matrix. It is applied to the premultiplied
+// colour and alpha channels; pixels beyond the edges repeat the border.
+type Kernel struct {
+	Width, Height int       // odd sizes; the centre lands on the target pixel
+	Weights       []float64 // row-major, Width*Height values
+	Divisor       float64   // 0 -> sum of the weights (1 when they sum to 0)
+	Bias          float64   // added to colour channels after dividing, 0~255 units
+}
+
+func (k Kernel) check() error {
+	if k.Width <= 0 || k.Height <= 0 || k.Width%2 == 0 || k.Height%2 == 0 {
+		return imgerr.Invalid("Kernel", "size %dx%d must be odd and positive", k.Width, k.Height)
+	}
+	if len(k.Weights) != k.Width*k.Height {
+		return imgerr.Invalid("Kernel", "%d weights, want %d", len(k.Weights), k.Width*k.Height)
+	}
+	return nil
+}
+
+// GaussianBlur blurs with a separable gaussian of standard deviation sigma,
+// at most MaxRadius.
+func GaussianBlur(src image.Image, sigma float64) *image.RGBA {
+	img := toRGBA(src)
+	if !(sigma >= 0.3) {
+		return img
+	}
+	sigma = min(sigma, MaxRadius)
+	r := int(math.Ceil(3 * sigma))
+	k := make([]float32, 2*r+1)
+	var sum float64
+	for i := range k {
+		d := float64(i - r)
+		w := math.Exp(-d * d / (2 * sigma * sigma))
+		k[i] = float32(w)
+		sum += w
+	}
+	for i := range k {
+		k[i] /= float32(sum)
+	}
+	return separable(img, k)
+}
+
+// BoxBlur averages every pixel over the (2r+1)x(2r+1) square around it;
+// r is at most MaxRadius.
+func BoxBlur(src image.Image, r int) *image.RGBA {
+	img := toRGBA(src)
+	if r <= 0 {
+		return img
+	}
+	r = min(r, MaxRadius)
+	k := make([]float32, 2*r+1)
+	for i := range k {
+		k[i] = 1 / float32(len(k))
+	}
+	return separable(img, k)
+}
+
+// UnsharpMask sharpens by adding back amount times the difference between
+// the image and its gaussian blur of the given radius. Differences below
+// threshold (0~255) are left alone so flat areas and noise stay smooth.
+func UnsharpMask(src image.Image, radius, amount float64, threshold int) *image.RGBA {
+	img := toRGBA(src)
+	blur := GaussianBlur(img, radius)
+	thr := float64(threshold)
+	b := img.Bounds()
+	parallel.Rows(b, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			o := img.PixOffset(band.Min.X, y)
+			row := img.Pix[o : o+4*band.Dx()]
+			bl := blur.Pix[o : o+4*band.Dx()]
+			for i := 0; i < len(row); i += 4 {
+				a := float64(row[i+3])
+				for c := 0; c < 3; c++ {
+					v := float64(row[i+c])
+					diff := v - float64(bl[i+c])
+					if math.Abs(diff) < thr {
+						continue
+					}
+					row[i+c] = uint8(math.Max(0, math.Min(a, v+amount*diff)) + 0.5)
+				}
+			}
+		}
+	})
+	return img
+}
+
+// Sobel returns the gradient magnitude of the luminance as a grey image
+// with the source's alpha: edges are bright, flat areas black.
+func Sobel(src image.Image) *image.RGBA {
+	img := toRGBA(src)
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	lum := make([]float32, w*h)
+	parallel.Rows(b, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			row := img.Pix[img.PixOffset(b.Min.X, y):]
+			l := lum[(y-b.Min.Y)*w:]
+			for x := 0; x < w; x++ {
+				p := row[4*x:]
+				l[x] = 0.299*float32(p[0]) + 0.587*float32(p[1]) + 0.114*float32(p[2])
+			}
+		}
+	})
+
+	dst := image.NewRGBA(b)
+	at := func(x, y int) float32 {
+		return lum[clampInt(y, 0, h-1)*w+clampInt(x, 0, w-1)]
+	}
+	parallel.Rows(b, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			yy := y - b.Min.Y
+			d := dst.Pix[dst.PixOffset(b.Min.X, y):]
+			s := img.Pix[img.PixOffset(b.Min.X, y):]
+			for x := 0; x < w; x++ {
+				gx := at(x+1, yy-1) + 2*at(x+1, yy) + at(x+1, yy+1) -
+					at(x-1, yy-1) - 2*at(x-1, yy) - at(x-1, yy+1)
+				gy := at(x-1, yy+1) + 2*at(x, yy+1) + at(x+1, yy+1) -
+					at(x-1, yy-1) - 2*at(x, yy-1) - at(x+1, yy-1)
+				a := float64(s[4*x+3])
+				// the luminance was taken from premultiplied values, so the
+				// magnitude is already scaled by alpha
+				m := uint8(math.Min(a, math.Hypot(float64(gx), float64(gy))) + 0.5)
+				d[4*x], d[4*x+1], d[4*x+2], d[4*x+3] = m, m, m, uint8(a)
+			}
+		}
+	})
+	return dst
+}
+
+// Convolve applies k to every pixel.
+func Convolve(src image.Image, k Kernel) *image.RGBA {
+	img := toRGBA(src)
+	if k.check() != nil {
+		return img
+	}
+	div := k.Divisor
+	if div == 0 {
+		for _, v := range k.Weights {
+			div += v
+		}
+		if div == 0 {
+			div = 1
+		}
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rx, ry := k.Width/2, k.Height/2
+	dst := image.NewRGBA(b)
+	parallel.Rows(b, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			yy := y - b.Min.Y
+			d := dst.Pix[dst.PixOffset(b.Min.X, y):]
+			for x := 0; x < w; x++ {
+				var s [4]float64
+				for j := 0; j < k.Height; j++ {
+					row := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+clampInt(yy+j-ry, 0, h-1)):]
+					for i := 0; i < k.Width; i++ {
+						kv := k.Weights[j*k.Width+i]
+						if kv == 0 {
+							continue
+						}
+						p := row[4*clampInt(x+i-rx, 0, w-1):]
+						s[0] += kv * float64(p[0])
+						s[1] += kv * float64(p[1])
+						s[2] += kv * float64(p[2])
+						s[3] += kv * float64(p[3])
+					}
+				}
+				a := math.Max(0, math.Min(255, s[3]/div))
+				for c := 0; c < 3; c++ {
+					d[4*x+c] = uint8(math.Max(0, math.Min(a, s[c]/div+k.Bias)) + 0.5)
+				}
+				d[4*x+3] = uint8(a + 0.5)
+			}
+		}
+	})
+	return dst
+}
+
+// sharpenKernel is the classic 3x3 Laplacian sharpen scaled by amount.
+func sharpenKernel(amount float64) Kernel {
+	a := amount
+	return Kernel{
+		Width: 3, Height: 3,
+		Weights: []float64{
+			0, -a, 0,
+			-a, 1 + 4*a, -a,
+			0, -a, 0,
+		},
+		Divisor: 1,
+	}
+}
+
+// separable convolves img with k horizontally, then vertically.
+func separable(img *image.RGBA, k []float32) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	r := len(k) / 2
+	tmp := make([]float32, w*h*4)
+	parallel.Rows(b, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			row := img.Pix[img.PixOffset(b.Min.X, y):]
+			t := tmp[(y-b.Min.Y)*w*4:]
+			for x := 0; x < w; x++ {
+				var s0, s1, s2, s3 float32
+				for i, kv := range k {
+					p := row[4*clampInt(x+i-r, 0, w-1):]
+					s0 += kv * float32(p[0])
+					s1 += kv * float32(p[1])
+					s2 += kv * float32(p[2])
+					s3 += kv * float32(p[3])
+				}
+				t[4*x], t[4*x+1], t[4*x+2], t[4*x+3] = s0, s1, s2, s3
+			}
+		}
+	})
+
+	dst := image.NewRGBA(b)
+	parallel.Rows(b, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			yy := y - b.Min.Y
+			d := dst.Pix[dst.PixOffset(b.Min.X, y):]
+			for x := 0; x < w; x++ {
+				var s0, s1, s2, s3 float32
+				for i, kv := range k {
+					t := tmp[(clampInt(yy+i-r, 0, h-1)*w+x)*4:]
+					s0 += kv * t[0]
+					s1 += kv * t[1]
+					s2 += kv * t[2]
+					s3 += kv * t[3]
+				}
+				d[4*x], d[4*x+1], d[4*x+2], d[4*x+3] = to8(s0), to8(s1), to8(s2), to8(s3)
+			}
+		}
+	})
+	return dst
+}
+
+// toRGBA returns a fresh premultiplied copy of src.
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	parallel.Rows(b, func(band image.Rectangle) {
+		draw.Draw(dst, band, src, band.Min, draw.Src)
+	})
+	return dst
+}
+
+func to8(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,173 @@
+package grade
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Cube is a colour lookup table in the Adobe/Resolve .cube format. A 3D
+// table maps (r, g, b) to a new colour with trilinear interpolation; a 1D
+// table maps each channel independently.
+type Cube struct {
+	Title     string
+	Size      int        // entries per axis
+	Is3D      bool       // LUT_3D_SIZE (true) or LUT_1D_SIZE (false)
+	DomainMin [3]float64 // input range, default 0
+	DomainMax [3]float64 // input range, default 1
+	Data      [][3]float64
+}
+
+// LoadCube reads a .cube file.
+func LoadCube(path string) (*Cube, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCube(f)
+}
+
+// ParseCube parses .cube data. For 3D tables red varies fastest.
+func ParseCube(r io.Reader) (*Cube, error) {
+	c := &Cube{DomainMax: [3]float64{1, 1, 1}}
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		s := strings.TrimSpace(sc.Text())
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		f := strings.Fields(s)
+		switch f[0] {
+		case "TITLE":
+			c.Title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(s, "TITLE")), `"`)
+		case "LUT_3D_SIZE", "LUT_1D_SIZE":
+			if len(f) != 2 {
+				return nil, fmt.Errorf("grade: cube line %d: bad %s", line, f[0])
+			}
+			n, err := strconv.Atoi(f[1])
+			if err != nil || n < 2 || n > 256 {
+				return nil, fmt.Errorf("grade: cube line %d: bad size %q", line, f[1])
+			}
+			c.Size, c.Is3D = n, f[0] == "LUT_3D_SIZE"
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			v, err := triple(f[1:])
+			if err != nil {
+				return nil, fmt.Errorf("grade: cube line %d: %w", line, err)
+			}
+			if f[0] == "DOMAIN_MIN" {
+				c.DomainMin = v
+			} else {
+				c.DomainMax = v
+			}
+		default:
+			if _, err := strconv.ParseFloat(f[0], 64); err != nil {
+				continue // unknown keyword, e.g. LUT_3D_INPUT_RANGE variants
+			}
+			v, err := triple(f)
+			if err != nil {
+				return nil, fmt.Errorf("grade: cube line %d: %w", line, err)
+			}
+			c.Data = append(c.Data, v)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.check(); err != nil {
+		return nil, fmt.Errorf("grade: %w", err)
+	}
+	return c, nil
+}
+
+// check reports a table Lookup cannot use: no or a bad size, an entry
+// count that does not match it, or an empty domain.
+func (c *Cube) check() error {
+	if c.Size == 0 {
+		return fmt.Errorf("cube has no LUT_3D_SIZE or LUT_1D_SIZE")
+	}
+	if c.Size < 2 || c.Size > 256 {
+		return fmt.Errorf("cube size %d is outside 2~256", c.Size)
+	}
+	want := c.Size
+	if c.Is3D {
+		want = c.Size * c.Size * c.Size
+	}
+	if len(c.Data) != want {
+		return fmt.Errorf("cube has %d entries, want %d", len(c.Data), want)
+	}
+	for i := range c.DomainMin {
+		if !(c.DomainMax[i] > c.DomainMin[i]) {
+			return fmt.Errorf("cube domain is empty")
+		}
+	}
+	return nil
+}
+
+func triple(f []string) ([3]float64, error) {
+	var v [3]float64
+	if len(f) != 3 {
+		return v, fmt.Errorf("want 3 values, got %d", len(f))
+	}
+	for i, s := range f {
+		x, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return v, err
+		}
+		v[i] = x
+	}
+	return v, nil
+}
+
+// Lookup maps an RGB triple in the cube's domain (normally 0~1). The cube
+// must be one ParseCube accepts; grade checks it before any lookup.
+func (c *Cube) Lookup(rgb [3]float64) [3]float64 {
+	var pos [3]float64 // fractional index per axis
+	n := float64(c.Size - 1)
+	for i := range rgb {
+		t := (rgb[i] - c.DomainMin[i]) / (c.DomainMax[i] - c.DomainMin[i])
+		pos[i] = math.Max(0, math.Min(1, t)) * n
+	}
+	if !c.Is3D {
+		var out [3]float64
+		for i := range pos {
+			i0, f := split(pos[i], c.Size)
+			out[i] = c.Data[i0][i]*(1-f) + c.Data[i0+1][i]*f
+		}
+		return out
+	}
+
+	r0, fr := split(pos[0], c.Size)
+	g0, fg := split(pos[1], c.Size)
+	b0, fb := split(pos[2], c.Size)
+	at := func(r, g, b int) [3]float64 {
+		return c.Data[r+c.Size*(g+c.Size*b)]
+	}
+	var out [3]float64
+	for i := 0; i < 3; i++ {
+		c00 := at(r0, g0, b0)[i]*(1-fr) + at(r0+1, g0, b0)[i]*fr
+		c10 := at(r0, g0+1, b0)[i]*(1-fr) + at(r0+1, g0+1, b0)[i]*fr
+		c01 := at(r0, g0, b0+1)[i]*(1-fr) + at(r0+1, g0, b0+1)[i]*fr
+		c11 := at(r0, g0+1, b0+1)[i]*(1-fr) + at(r0+1, g0+1, b0+1)[i]*fr
+		c0 := c00*(1-fg) + c10*fg
+		c1 := c01*(1-fg) + c11*fg
+		out[i] = c0*(1-fb) + c1*fb
+	}
+	return out
+}
+
+// split returns the lower lattice index and the fraction towards the next
+// one, keeping index+1 inside the table.
+func split(p float64, size int) (int, float64) {
+	i := int(p)
+	if i >= size-1 {
+		i = size - 2
+	}
+	return i, p - float64(i)
+}
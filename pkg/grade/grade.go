@@ -0,0 +1,224 @@
+// Package grade applies colour looks: grayscale, sepia, duotone, threshold
+// and colour lookup tables loaded from .cube files.
+package grade
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithGrade = "grade"
+
+// Kind selects the look.
+type Kind int
+
+const (
+	// Grayscale : luminance-weighted (Rec. 709) monochrome.
+	Grayscale Kind = iota + 1
+	// Sepia : warm brown monochrome.
+	Sepia
+	// Duotone : luminance mapped from Shadow to Highlight.
+	Duotone
+	// Threshold : pure black and white, cut at Level.
+	Threshold
+	// LUT : colour lookup through Cube.
+	LUT
+)
+
+// Options declares the look and output quality.
+type Options struct {
+	Kind      Kind
+	Amount    float64    // blend with the original, 0~1; 0 -> 1 (full effect)
+	Shadow    color.RGBA // Duotone colour for black (zero -> black)
+	Highlight color.RGBA // Duotone colour for white (zero -> white)
+	Level     float64    // Threshold luminance cut, 0~1; 0 -> 0.5
+	Cube      *Cube      // LUT table, see LoadCube
+	Quality   int        // JPEG quality 1-100, 0 = 85; PNG input stays PNG
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// defaultLogInfo builds a simple log line.
+func defaultLogInfo() string {
+	return fmt.Sprintf("grade:done:image_at %s", time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// Validate reports an unknown kind, a missing or malformed Cube for LUT, a
+// Cube for any other kind, and an Amount or Level outside 0~1. Without
+// strict mode (see package validate) the first two still fail; Amount then
+// falls back to 1, a Level below 0 to 0.5, and Cube is ignored.
+func (opt Options) Validate() error {
+	if _, err := opt.mapper(); err != nil {
+		return err
+	}
+	if opt.Cube != nil && opt.Kind != LUT {
+		return imgerr.Invalid("Cube", "only used by the LUT kind")
+	}
+	return validate.First(
+		validate.Range("Amount", opt.Amount, 0, 1),
+		validate.Range("Level", opt.Level, 0, 1),
+		validate.Quality(opt.quality()),
+	)
+}
+
+// quality is the JPEG quality to encode with.
+func (opt Options) quality() int {
+	if opt.Quality == 0 {
+		return 85
+	}
+	return opt.Quality
+}
+
+// handlerGrade returns a closure applying the look per Options.
+func handlerGrade(opt *Options) imageops.Handler {
+	_, invalid := opt.mapper()
+	if invalid == nil {
+		invalid = opt.Policy.Check(actionWithGrade, opt.Validate())
+	}
+	return imageops.Op("grade", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		src, format, err := decode.Decode(in)
+		if err != nil {
+			return nil, err
+		}
+		img, err := Apply(src, *opt)
+		if err != nil {
+			return nil, err
+		}
+
+		out := new(bytes.Buffer)
+		if format == "png" {
+			err = png.Encode(out, img)
+		} else {
+			err = jpeg.Encode(out, img, &jpeg.Options{Quality: max(1, min(100, opt.quality()))})
+		}
+		return out.Bytes(), imgerr.Encode(err)
+	})
+}
+
+// Handler returns the look as a stage for imageops.Pipeline.
+func Handler(opt Options) imageops.Handler {
+	return handlerGrade(&opt)
+}
+
+// Grade wires normal log + grading pipeline.
+func Grade(in []byte, opt Options) ([]byte, error) {
+	normalLog := &logger.MetaPayload{
+		Ob2: logger.LogInfo(actionWithGrade, defaultLogInfo()),
+	}
+	_, _ = logger.LogMetaHandler(normalLog, nil)
+
+	return imageops.NewPipeline().
+		Add(handlerGrade(&opt)).
+		Run(in)
+}
+
+// Apply grades a decoded image and returns a new NRGBA image.
+func Apply(src image.Image, opt Options) (*image.NRGBA, error) {
+	fn, err := opt.mapper()
+	if err != nil {
+		return nil, err
+	}
+	amount := opt.Amount
+	if amount <= 0 || amount > 1 {
+		amount = 1
+	}
+
+	b := src.Bounds()
+	dst := image.NewNRGBA(b)
+	parallel.Rows(b, func(band image.Rectangle) {
+		draw.Draw(dst, band, src, band.Min, draw.Src)
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			row := dst.Pix[dst.PixOffset(band.Min.X, y):dst.PixOffset(band.Max.X, y)]
+			for i := 0; i < len(row); i += 4 {
+				in := [3]float64{float64(row[i]) / 255, float64(row[i+1]) / 255, float64(row[i+2]) / 255}
+				out := fn(in)
+				for c := 0; c < 3; c++ {
+					row[i+c] = to8(in[c] + (out[c]-in[c])*amount)
+				}
+			}
+		}
+	})
+	return dst, nil
+}
+
+// mapper returns the per-pixel colour function for opt.Kind.
+func (opt Options) mapper() (func([3]float64) [3]float64, error) {
+	switch opt.Kind {
+	case Grayscale:
+		return func(c [3]float64) [3]float64 {
+			l := luma(c)
+			return [3]float64{l, l, l}
+		}, nil
+	case Sepia:
+		return func(c [3]float64) [3]float64 {
+			return [3]float64{
+				0.393*c[0] + 0.769*c[1] + 0.189*c[2],
+				0.349*c[0] + 0.686*c[1] + 0.168*c[2],
+				0.272*c[0] + 0.534*c[1] + 0.131*c[2],
+			}
+		}, nil
+	case Duotone:
+		lo, hi := unit(opt.Shadow), unit(opt.Highlight)
+		if opt.Highlight == (color.RGBA{}) {
+			hi = [3]float64{1, 1, 1}
+		}
+		return func(c [3]float64) [3]float64 {
+			l := luma(c)
+			return [3]float64{lo[0] + (hi[0]-lo[0])*l, lo[1] + (hi[1]-lo[1])*l, lo[2] + (hi[2]-lo[2])*l}
+		}, nil
+	case Threshold:
+		level := opt.Level
+		if level <= 0 {
+			level = 0.5
+		}
+		return func(c [3]float64) [3]float64 {
+			if luma(c) >= level {
+				return [3]float64{1, 1, 1}
+			}
+			return [3]float64{}
+		}, nil
+	case LUT:
+		if opt.Cube == nil {
+			return nil, imgerr.Invalid("Cube", "LUT needs a Cube")
+		}
+		if err := opt.Cube.check(); err != nil {
+			return nil, imgerr.Invalid("Cube", "%v", err)
+		}
+		return opt.Cube.Lookup, nil
+	}
+	return nil, imgerr.Invalid("Kind", "unknown kind %d", opt.Kind)
+}
+
+// ---- helpers ----
+
+func luma(c [3]float64) float64 {
+	return 0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]
+}
+
+func unit(c color.RGBA) [3]float64 {
+	return [3]float64{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255}
+}
+
+func to8(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(1, v))*255 + 0.5)
+}
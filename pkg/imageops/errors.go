@@ -0,0 +1,15 @@
+package imageops
+
+import "github.com/HumbleLines/imgpipe/pkg/imgerr"
+
+// Op labels the errors of h with the operation name, as an
+// *imgerr.OpError, so they say which operation failed.
+func Op(name string, h Handler) Handler {
+	return func(in []byte) ([]byte, error) {
+		out, err := h(in)
+		if err != nil {
+			return nil, imgerr.Wrap(name, err)
+		}
+		return out, nil
+	}
+}
@@ -1,6 +1,8 @@
 // Package imageops pkg/imageops/imageops.go
 package imageops
 
+import "github.com/HumbleLines/imgpipe/pkg/imgerr"
+
 // Handler defines a function that transforms image bytes and returns result/error.
 type Handler func([]byte) ([]byte, error)
 
@@ -20,12 +22,16 @@ func (p *Pipeline) Add(fn Handler) *Pipeline {
 	return p
 }
 
-// Run executes the handler pipeline on the provided data.
+// Run executes the handler pipeline on the provided data. In a pipeline of
+// several steps, a failing operation's *imgerr.OpError records its step.
 func (p *Pipeline) Run(data []byte) ([]byte, error) {
 	var err error
-	for _, step := range p.steps {
+	for i, step := range p.steps {
 		data, err = step(data)
 		if err != nil {
+			if len(p.steps) > 1 {
+				err = imgerr.AtStep(i+1, err)
+			}
 			return nil, err
 		}
 	}
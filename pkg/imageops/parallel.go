@@ -0,0 +1,17 @@
+// Package imageops pkg/imageops/parallel.go
+package imageops
+
+import "github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+
+// SetMaxProcs limits how many goroutines a single per-pixel operation
+// (rotation, alpha scaling, resampling, ...) may use. n <= 0 restores the
+// default of runtime.GOMAXPROCS(0). Operations already running keep the
+// limit they started with.
+func SetMaxProcs(n int) {
+	parallel.SetLimit(n)
+}
+
+// MaxProcs reports the effective per-operation worker limit.
+func MaxProcs() int {
+	return parallel.Limit()
+}
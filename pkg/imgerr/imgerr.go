@@ -0,0 +1,156 @@
+// Package imgerr defines the errors shared by the operation packages, so
+// callers can tell bad input from bad options from internal failures with
+// errors.Is and errors.As, whatever operation raised them:
+//
+//	_, err := resize.Resize(in, opt)
+//	switch {
+//	case errors.Is(err, imgerr.ErrImageTooLarge):   // 413
+//	case errors.Is(err, imgerr.ErrUnsupportedFormat),
+//		errors.Is(err, imgerr.ErrDecode):          // 415
+//	case errors.Is(err, imgerr.ErrInvalidOptions):  // 400; errors.As gives the *OptionError
+//	}
+//
+// It has no dependencies, so every package can use it.
+package imgerr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The error classes. Errors from the operations match at most one, except
+// that input in no known format matches both ErrDecode and
+// ErrUnsupportedFormat.
+var (
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	ErrInvalidOptions    = errors.New("invalid options")
+	ErrImageTooLarge     = errors.New("image too large")
+	ErrDecode            = errors.New("cannot decode image")
+	ErrEncode            = errors.New("cannot encode image")
+)
+
+// OptionError reports an invalid option. It matches ErrInvalidOptions.
+type OptionError struct {
+	Field string // the option, as named in the Options struct or recipe
+	Msg   string
+}
+
+func (e *OptionError) Error() string { return e.Field + ": " + e.Msg }
+
+// Is makes errors.Is(err, ErrInvalidOptions) hold.
+func (e *OptionError) Is(target error) bool { return target == ErrInvalidOptions }
+
+// Invalid returns an *OptionError for field.
+func Invalid(field, format string, a ...any) error {
+	return &OptionError{Field: field, Msg: fmt.Sprintf(format, a...)}
+}
+
+// Unsupported returns an error matching ErrUnsupportedFormat.
+func Unsupported(format string, a ...any) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedFormat, fmt.Sprintf(format, a...))
+}
+
+// Mark returns err matching class as well, with its message unchanged;
+// nil stays nil.
+func Mark(class, err error) error {
+	if err == nil || errors.Is(err, class) {
+		return err
+	}
+	return &marked{class: class, err: err}
+}
+
+type marked struct {
+	class, err error
+}
+
+func (e *marked) Error() string        { return e.err.Error() }
+func (e *marked) Unwrap() error        { return e.err }
+func (e *marked) Is(target error) bool { return target == e.class }
+
+// Classified reports whether err matches one of the error classes.
+func Classified(err error) bool {
+	for _, c := range []error{ErrUnsupportedFormat, ErrInvalidOptions, ErrImageTooLarge, ErrDecode, ErrEncode} {
+		if errors.Is(err, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode marks err, from an image encoder, as matching ErrEncode; nil
+// stays nil.
+func Encode(err error) error {
+	if err == nil || errors.Is(err, ErrEncode) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrEncode, err)
+}
+
+// OpError names the operation, and within a pipeline of several the
+// 1-based step, that failed.
+type OpError struct {
+	Op   string
+	Step int // 0 when the operation ran on its own
+	Err  error
+}
+
+func (e *OpError) Error() string {
+	msg := e.Err.Error()
+	if e.Op != "" && !strings.HasPrefix(msg, e.Op+": ") && !strings.Contains(msg, " "+e.Op+": ") {
+		msg = e.Op + ": " + msg
+	}
+	if e.Step > 0 {
+		msg = fmt.Sprintf("step %d: %s", e.Step, msg)
+	}
+	return msg
+}
+
+func (e *OpError) Unwrap() error { return e.Err }
+
+// Wrap returns err labelled with op; nil stays nil, and errors that are
+// already labelled are returned as they are.
+func Wrap(op string, err error) error {
+	var oe *OpError
+	if err == nil || errors.As(err, &oe) {
+		return err
+	}
+	return &OpError{Op: op, Err: err}
+}
+
+// AtStep records the pipeline step of err unless an *OpError in its chain
+// already has one. A top-level *OpError gets the step itself; an error
+// that wraps one is labelled with that operation and the step; any other
+// error is wrapped in an *OpError that only names the step.
+func AtStep(step int, err error) error {
+	if err == nil {
+		return nil
+	}
+	var oe *OpError
+	if !errors.As(err, &oe) {
+		return &OpError{Step: step, Err: err}
+	}
+	if oe.Step != 0 {
+		return err
+	}
+	if err == error(oe) {
+		return &OpError{Op: oe.Op, Step: step, Err: oe.Err}
+	}
+	return &OpError{Op: oe.Op, Step: step, Err: err}
+}
+
+// HTTPStatus maps err to a response status: 413 for ErrImageTooLarge, 415
+// for ErrUnsupportedFormat and ErrDecode, 400 for ErrInvalidOptions and
+// 500 for anything else.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnsupportedFormat), errors.Is(err, ErrDecode):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrInvalidOptions):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,88 @@
+// Package mask holds coverage-mask helpers shared by the drawing packages:
+// an approximate gaussian blur and anti-aliased rounded rectangles.
+package mask
+
+import (
+	"image"
+	"math"
+)
+
+// MaxBlur is the largest blur radius honoured; callers grow their canvas
+// by the blur, so BlurStep treats anything above it as MaxBlur.
+const MaxBlur = 256
+
+// BlurStep is the box radius per pass for a blur of roughly the given
+// radius; three passes approximate a gaussian. The blurred mask spreads
+// 3*BlurStep(blur) pixels beyond its source.
+func BlurStep(blur int) int {
+	if blur <= 0 {
+		return 0
+	}
+	return max(1, (min(blur, MaxBlur)+1)/2)
+}
+
+// Blur applies three horizontal+vertical box passes of radius r.
+func Blur(m *image.Alpha, r int) *image.Alpha {
+	b := m.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := make([]float64, w*h)
+	for i := range src {
+		src[i] = float64(m.Pix[(i/w)*m.Stride+i%w])
+	}
+	tmp := make([]float64, w*h)
+	for pass := 0; pass < 3; pass++ {
+		boxPass(tmp, src, w, h, 1, w, r)
+		boxPass(src, tmp, h, w, w, 1, r)
+	}
+	out := image.NewAlpha(b)
+	for i, v := range src {
+		out.Pix[(i/w)*out.Stride+i%w] = uint8(math.Min(255, v+0.5))
+	}
+	return out
+}
+
+// boxPass averages along lines of length n; step moves along a line and
+// next moves to the following line. Outside samples count as zero.
+func boxPass(dst, src []float64, n, lines, step, next, r int) {
+	norm := 1 / float64(2*r+1)
+	for l := 0; l < lines; l++ {
+		base := l * next
+		var sum float64
+		for i := 0; i <= r && i < n; i++ {
+			sum += src[base+i*step]
+		}
+		for i := 0; i < n; i++ {
+			dst[base+i*step] = sum * norm
+			if j := i + r + 1; j < n {
+				sum += src[base+j*step]
+			}
+			if j := i - r; j >= 0 {
+				sum -= src[base+j*step]
+			}
+		}
+	}
+}
+
+// RoundedRect returns an anti-aliased rounded-rectangle coverage mask of
+// the given size with its origin at (0,0).
+func RoundedRect(size image.Point, radius int) *image.Alpha {
+	m := image.NewAlpha(image.Rectangle{Max: size})
+	rad := float64(min(radius, size.X/2, size.Y/2))
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			m.Pix[m.PixOffset(x, y)] = uint8(255*cornerCoverage(x, y, size, rad) + 0.5)
+		}
+	}
+	return m
+}
+
+func cornerCoverage(x, y int, size image.Point, rad float64) float64 {
+	if rad <= 0 {
+		return 1
+	}
+	px, py := float64(x)+0.5, float64(y)+0.5
+	cx := math.Max(rad, math.Min(px, float64(size.X)-rad))
+	cy := math.Max(rad, math.Min(py, float64(size.Y)-rad))
+	dist := math.Hypot(px-cx, py-cy)
+	return math.Max(0, math.Min(1, rad-dist+0.5))
+}
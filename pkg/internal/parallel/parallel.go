@@ -0,0 +1,138 @@
+// Package parallel is the shared worker pool behind the per-pixel operations.
+// It splits images into bands and runs them on a bounded set of goroutines;
+// the limit is configured publicly through imageops.SetMaxProcs.
+package parallel
+
+import (
+	"image"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// minBandPixels keeps bands large enough that goroutine overhead stays
+// negligible compared to the per-pixel work.
+const minBandPixels = 1 << 14
+
+// limit caps the number of workers used by Rows; 0 means
+// runtime.GOMAXPROCS(0).
+var limit atomic.Int32
+
+// SetLimit sets the worker limit; n <= 0 restores the default.
+func SetLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	limit.Store(int32(n))
+}
+
+// Limit reports the effective worker limit.
+func Limit() int {
+	if n := int(limit.Load()); n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// Rows splits r into horizontal bands and calls fn once per band on
+// a bounded pool of goroutines. Bands never overlap and together cover r
+// exactly; fn must only write pixels inside the band it was given.
+// Small rectangles run inline on the calling goroutine.
+func Rows(r image.Rectangle, fn func(band image.Rectangle)) {
+	parallelSpans(r.Min.Y, r.Max.Y, r.Dx(), func(lo, hi int) {
+		fn(image.Rect(r.Min.X, lo, r.Max.X, hi))
+	})
+}
+
+// Cols is the vertical counterpart of Rows.
+func Cols(r image.Rectangle, fn func(band image.Rectangle)) {
+	parallelSpans(r.Min.X, r.Max.X, r.Dy(), func(lo, hi int) {
+		fn(image.Rect(lo, r.Min.Y, hi, r.Max.Y))
+	})
+}
+
+// Scale is a drop-in for s.Scale(dst, dr, src, sr, xdraw.Src, nil)
+// that spreads the work over Limit() workers. The resample runs as two
+// separable passes over bands, horizontal then vertical, or the other way
+// round when that keeps the intermediate image smaller. Each pass is a 1:1
+// mapping along the other axis, so banding does not change the sampling
+// positions. Which algorithm runs depends on the sizes only, never on
+// Limit(), so the pixels are the same for every worker limit.
+func Scale(s xdraw.Scaler, dst *image.RGBA, dr image.Rectangle, src image.Image, sr image.Rectangle) {
+	if dr.Dx()*dr.Dy() < 4*minBandPixels {
+		s.Scale(dst, dr, src, sr, xdraw.Src, nil)
+		return
+	}
+
+	if dr.Dx()*sr.Dy() > sr.Dx()*dr.Dy() {
+		// pass 1: scale Y only, (sw x sh) -> (sw x dh)
+		tmp := image.NewRGBA(image.Rect(0, 0, sr.Dx(), dr.Dy()))
+		Cols(tmp.Bounds(), func(band image.Rectangle) {
+			srcBand := image.Rect(sr.Min.X+band.Min.X, sr.Min.Y, sr.Min.X+band.Max.X, sr.Max.Y)
+			s.Scale(tmp, band, src, srcBand, xdraw.Src, nil)
+		})
+
+		// pass 2: scale X only, (sw x dh) -> (dw x dh)
+		Rows(image.Rect(0, 0, dr.Dx(), dr.Dy()), func(band image.Rectangle) {
+			tmpBand := image.Rect(0, band.Min.Y, sr.Dx(), band.Max.Y)
+			s.Scale(dst, band.Add(dr.Min), tmp, tmpBand, xdraw.Src, nil)
+		})
+		return
+	}
+
+	// pass 1: scale X only, (sw x sh) -> (dw x sh)
+	tmp := image.NewRGBA(image.Rect(0, 0, dr.Dx(), sr.Dy()))
+	Rows(tmp.Bounds(), func(band image.Rectangle) {
+		srcBand := image.Rect(sr.Min.X, sr.Min.Y+band.Min.Y, sr.Max.X, sr.Min.Y+band.Max.Y)
+		s.Scale(tmp, band, src, srcBand, xdraw.Src, nil)
+	})
+
+	// pass 2: scale Y only, (dw x sh) -> (dw x dh)
+	Cols(image.Rect(0, 0, dr.Dx(), dr.Dy()), func(band image.Rectangle) {
+		tmpBand := image.Rect(band.Min.X, 0, band.Max.X, sr.Dy())
+		s.Scale(dst, band.Add(dr.Min), tmp, tmpBand, xdraw.Src, nil)
+	})
+}
+
+// parallelSpans cuts [lo, hi) into spans and runs fn over them with at most
+// Limit() goroutines. stride is the pixel count per unit of the span axis
+// and is only used to size the spans.
+func parallelSpans(lo, hi, stride int, fn func(lo, hi int)) {
+	n := hi - lo
+	if n <= 0 {
+		return
+	}
+	workers := Limit()
+	if workers <= 1 || n*stride < 2*minBandPixels {
+		fn(lo, hi)
+		return
+	}
+
+	// a few spans per worker smooths out uneven per-row cost
+	span := (n + workers*4 - 1) / (workers * 4)
+	if stride > 0 {
+		span = max(span, (minBandPixels+stride-1)/stride)
+	}
+	spans := (n + span - 1) / span
+	workers = min(workers, spans)
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= spans {
+					return
+				}
+				a := lo + i*span
+				fn(a, min(a+span, hi))
+			}
+		}()
+	}
+	wg.Wait()
+}
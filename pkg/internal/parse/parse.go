@@ -0,0 +1,157 @@
+// Package parse turns the textual values used by the CLI and by recipes
+// (colours, number lists, enum names) into option values.
+package parse
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HumbleLines/imgpipe/pkg/border"
+	"github.com/HumbleLines/imgpipe/pkg/filter"
+	"github.com/HumbleLines/imgpipe/pkg/grade"
+	"github.com/HumbleLines/imgpipe/pkg/redact"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/rotate"
+	"github.com/HumbleLines/imgpipe/pkg/watermark"
+)
+
+// Color reads "#rgb", "#rrggbb" or "#rrggbbaa" (the # is optional)
+// into a premultiplied colour.
+func Color(s string) (color.RGBA, error) {
+	h := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	if len(h) == 6 {
+		h += "ff"
+	}
+	b, err := hex.DecodeString(h)
+	if err != nil || len(b) != 4 {
+		return color.RGBA{}, fmt.Errorf("bad colour %q, want #rrggbb or #rrggbbaa", s)
+	}
+	a := uint32(b[3])
+	return color.RGBA{
+		R: uint8(uint32(b[0]) * a / 255),
+		G: uint8(uint32(b[1]) * a / 255),
+		B: uint8(uint32(b[2]) * a / 255),
+		A: b[3],
+	}, nil
+}
+
+// Ints reads n comma-separated integers; a single value is repeated.
+func Ints(s string, n int) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) == 1 && n > 1 {
+		for len(parts) < n {
+			parts = append(parts, parts[0])
+		}
+	}
+	if len(parts) != n {
+		return nil, fmt.Errorf("want %d comma-separated values, got %q", n, s)
+	}
+	out := make([]int, n)
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", p)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// Anchors names the watermark anchors.
+var Anchors = map[string]watermark.Anchor{
+	"top-left":     watermark.AnchorTopLeft,
+	"top":          watermark.AnchorTop,
+	"top-right":    watermark.AnchorTopRight,
+	"left":         watermark.AnchorLeft,
+	"center":       watermark.AnchorCenter,
+	"right":        watermark.AnchorRight,
+	"bottom-left":  watermark.AnchorBottomLeft,
+	"bottom":       watermark.AnchorBottom,
+	"bottom-right": watermark.AnchorBottomRight,
+}
+
+// Blends names the watermark blend modes.
+var Blends = map[string]watermark.BlendMode{
+	"normal":     watermark.BlendNormal,
+	"atop":       watermark.BlendAtop,
+	"multiply":   watermark.BlendMultiply,
+	"screen":     watermark.BlendScreen,
+	"overlay":    watermark.BlendOverlay,
+	"soft-light": watermark.BlendSoftLight,
+	"difference": watermark.BlendDifference,
+	"luminosity": watermark.BlendLuminosity,
+}
+
+// ResizeModes names the resize modes.
+var ResizeModes = map[string]resize.Mode{
+	"stretch": resize.ModeStretch,
+	"fit":     resize.ModeFit,
+	"fill":    resize.ModeFill,
+}
+
+// Rotations maps clockwise degrees to rotate modes.
+var Rotations = map[string]rotate.Mode{
+	"90":  rotate.Rotate90CW,
+	"180": rotate.Rotate180,
+	"270": rotate.Rotate270CW,
+	"-90": rotate.Rotate270CW,
+}
+
+// BorderModes names the border modes.
+var BorderModes = map[string]border.Mode{
+	"inset":  border.Inset,
+	"outset": border.Outset,
+}
+
+// ColorSources names the border colours taken from the image.
+var ColorSources = map[string]border.ColorSource{
+	"dominant": border.ColorDominant,
+	"edge":     border.ColorEdge,
+	"accent":   border.ColorAccent,
+}
+
+// Filters names the filter kinds that need no kernel.
+var Filters = map[string]filter.Kind{
+	"gaussian": filter.Gaussian,
+	"box":      filter.Box,
+	"sharpen":  filter.Sharpen,
+	"unsharp":  filter.Unsharp,
+	"edges":    filter.Edges,
+}
+
+// Looks names the grade kinds.
+var Looks = map[string]grade.Kind{
+	"grayscale": grade.Grayscale,
+	"sepia":     grade.Sepia,
+	"duotone":   grade.Duotone,
+	"threshold": grade.Threshold,
+	"lut":       grade.LUT,
+}
+
+// RedactMethods names the redaction methods.
+var RedactMethods = map[string]redact.Method{
+	"blur":     redact.Blur,
+	"pixelate": redact.Pixelate,
+	"fill":     redact.Fill,
+}
+
+// Enum resolves a named enum value, listing the choices on error.
+func Enum[T any](kind, name string, table map[string]T) (T, error) {
+	if v, ok := table[strings.ToLower(name)]; ok {
+		return v, nil
+	}
+	var zero T
+	names := make([]string, 0, len(table))
+	for n := range table {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return zero, fmt.Errorf("unknown %s %q (want one of %s)", kind, name, strings.Join(names, ", "))
+}
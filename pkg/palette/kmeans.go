@@ -0,0 +1,45 @@
+package palette
+
+// k-means stops after maxIter rounds or once no centre moves more than
+// settle ΔE units.
+const (
+	maxIter = 16
+	settle  = 0.5
+)
+
+// kmeans refines centres with Lloyd iterations: assign every sample to
+// its nearest centre, move each centre to the mean of its samples.
+// Centres that lose all their samples are dropped.
+func kmeans(samples, centres []Lab) []Lab {
+	centres = append([]Lab(nil), centres...)
+	sums := make([]Lab, len(centres))
+	counts := make([]int, len(centres))
+	for iter := 0; iter < maxIter; iter++ {
+		clear(sums)
+		clear(counts)
+		for _, p := range samples {
+			k := nearest(p, centres)
+			sums[k].L += p.L
+			sums[k].A += p.A
+			sums[k].B += p.B
+			counts[k]++
+		}
+		moved := 0.0
+		next := centres[:0] // compacted in place; index <= k is already read
+		for k, n := range counts {
+			if n == 0 {
+				continue
+			}
+			f := float64(n)
+			c := Lab{L: sums[k].L / f, A: sums[k].A / f, B: sums[k].B / f}
+			moved = max(moved, c.Distance(centres[k]))
+			next = append(next, c)
+		}
+		centres = next
+		sums, counts = sums[:len(centres)], counts[:len(centres)]
+		if moved < settle {
+			break
+		}
+	}
+	return centres
+}
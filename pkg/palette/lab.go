@@ -0,0 +1,99 @@
+package palette
+
+import (
+	"image/color"
+	"math"
+)
+
+// Lab is a CIE L*a*b* colour (D65 white point). Distances in Lab track
+// perceived colour differences far better than distances in RGB.
+type Lab struct {
+	L float64 `json:"l"`
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+}
+
+// D65 reference white
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+// ToLab converts c (alpha ignored, un-premultiplied) to Lab.
+func ToLab(c color.Color) Lab {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return rgbToLab(n.R, n.G, n.B)
+}
+
+func rgbToLab(r8, g8, b8 uint8) Lab {
+	r, g, b := linear[r8], linear[g8], linear[b8]
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / whiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / whiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / whiteZ
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return Lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// RGBA converts back to an opaque sRGB colour, clipping out-of-gamut values.
+func (c Lab) RGBA() color.RGBA {
+	fy := (c.L + 16) / 116
+	fx := fy + c.A/500
+	fz := fy - c.B/200
+	x, y, z := labFInv(fx)*whiteX, labFInv(fy)*whiteY, labFInv(fz)*whiteZ
+	r := 3.2404542*x - 1.5371385*y - 0.4985314*z
+	g := -0.9692660*x + 1.8760108*y + 0.0415560*z
+	b := 0.0556434*x - 0.2040259*y + 1.0572252*z
+	return color.RGBA{R: encode(r), G: encode(g), B: encode(b), A: 255}
+}
+
+// Distance is the CIE76 colour difference (ΔE*ab).
+func (c Lab) Distance(o Lab) float64 {
+	return math.Sqrt(c.dist2(o))
+}
+
+func (c Lab) dist2(o Lab) float64 {
+	dl, da, db := c.L-o.L, c.A-o.A, c.B-o.B
+	return dl*dl + da*da + db*db
+}
+
+// Chroma is the colourfulness of c.
+func (c Lab) Chroma() float64 {
+	return math.Hypot(c.A, c.B)
+}
+
+func labF(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
+
+func labFInv(t float64) float64 {
+	if t3 := t * t * t; t3 > 216.0/24389 {
+		return t3
+	}
+	return (116*t - 16) * 27 / 24389
+}
+
+// linear maps an sRGB byte to linear light.
+var linear = func() (lut [256]float64) {
+	for i := range lut {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			lut[i] = v / 12.92
+		} else {
+			lut[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+	return lut
+}()
+
+func encode(v float64) uint8 {
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return uint8(math.Max(0, math.Min(255, v*255+0.5)))
+}
@@ -0,0 +1,321 @@
+// Package palette extracts representative colours from images: a top-N
+// palette with population shares, the dominant colour, the average edge
+// colour and a complementary accent. Clustering happens in CIE Lab so
+// that swatches match what people perceive as distinct colours.
+package palette
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // register decoders for Palette
+	_ "image/png"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithPalette = "palette"
+
+// maxSamples bounds the pixels considered; larger images are subsampled
+// on a regular grid, which is plenty for palette statistics.
+const maxSamples = 1 << 16
+
+// Method selects the clustering algorithm.
+type Method int
+
+const (
+	// KMeans : median cut seeds, refined by k-means (Lloyd) iterations.
+	// Slower, but centres settle on the real colour clusters.
+	KMeans Method = iota
+	// MedianCut : median cut only, with one nearest-centre assignment.
+	MedianCut
+)
+
+// Options configures palette extraction.
+type Options struct {
+	Count      int    // number of swatches; 0 -> 5
+	Method     Method // clustering algorithm
+	MaxSamples int    // pixels sampled; 0 -> 65536
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports an unknown method and a negative Count or MaxSamples.
+// Without strict mode (see package validate) an unknown method means
+// MedianCut and negative values take their defaults.
+func (opt Options) Validate() error {
+	if opt.Method != KMeans && opt.Method != MedianCut {
+		return imgerr.Invalid("Method", "unknown method %d", opt.Method)
+	}
+	return validate.First(
+		validate.NotNegative("Count", opt.Count),
+		validate.NotNegative("MaxSamples", opt.MaxSamples),
+	)
+}
+
+// Swatch is one palette colour and the fraction of the image it covers.
+// It marshals to JSON as {"hex":"#rrggbb","lab":{...},"share":0.42}.
+type Swatch struct {
+	Color color.RGBA `json:"-"`
+	Hex   string     `json:"hex"`
+	Lab   Lab        `json:"lab"`
+	Share float64    `json:"share"` // 0~1, shares of a palette sum to 1
+}
+
+func defaultLogInfo() string {
+	return fmt.Sprintf("palette:done:image_at %s", time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// Palette decodes in and returns its top colours, most common first.
+func Palette(in []byte, opt Options) ([]Swatch, error) {
+	normalLog := &logger.MetaPayload{
+		Ob2: logger.LogInfo(actionWithPalette, defaultLogInfo()),
+	}
+	_, _ = logger.LogMetaHandler(normalLog, nil)
+
+	if err := opt.Policy.Check(actionWithPalette, opt.Validate()); err != nil {
+		return nil, imgerr.Wrap(actionWithPalette, err)
+	}
+	img, _, err := decode.Decode(in)
+	if err != nil {
+		return nil, err
+	}
+	return FromImage(img, opt), nil
+}
+
+// FromImage returns the top colours of img, most common first. Mostly
+// transparent pixels are ignored; an empty image yields no swatches.
+func FromImage(img image.Image, opt Options) []Swatch {
+	n := opt.Count
+	if n <= 0 {
+		n = 5
+	}
+	limit := opt.MaxSamples
+	if limit <= 0 {
+		limit = maxSamples
+	}
+	samples := sample(img, img.Bounds(), limit)
+	if len(samples) == 0 {
+		return nil
+	}
+	centres := medianCut(samples, n)
+	if opt.Method == KMeans {
+		centres = kmeans(samples, centres)
+	}
+	return assign(samples, centres)
+}
+
+// Extract returns up to n swatches by median cut, most common first.
+// Boxes are split in Lab, then every sample is assigned to its nearest
+// box centre so the shares reflect real populations.
+func Extract(img image.Image, n int) []Swatch {
+	if n <= 0 {
+		return nil
+	}
+	return FromImage(img, Options{Count: n, Method: MedianCut})
+}
+
+// Dominant returns the most common colour of img.
+func Dominant(img image.Image) color.RGBA {
+	if sw := Extract(img, 8); len(sw) > 0 {
+		return sw[0].Color
+	}
+	return color.RGBA{A: 255}
+}
+
+// EdgeAverage averages the outer band of img, band pixels wide
+// (0 -> 2% of the shorter side, at least 1). The mean is taken in Lab.
+func EdgeAverage(img image.Image, band int) color.RGBA {
+	b := img.Bounds()
+	if band <= 0 {
+		band = max(1, min(b.Dx(), b.Dy())/50)
+	}
+	inner := b.Inset(band)
+	var edge []Lab
+	for _, r := range []image.Rectangle{
+		image.Rect(b.Min.X, b.Min.Y, b.Max.X, inner.Min.Y),         // top
+		image.Rect(b.Min.X, inner.Max.Y, b.Max.X, b.Max.Y),         // bottom
+		image.Rect(b.Min.X, inner.Min.Y, inner.Min.X, inner.Max.Y), // left
+		image.Rect(inner.Max.X, inner.Min.Y, b.Max.X, inner.Max.Y), // right
+	} {
+		edge = append(edge, sample(img, r.Intersect(b), maxSamples)...)
+	}
+	if len(edge) == 0 {
+		return color.RGBA{A: 255}
+	}
+	return mean(edge).RGBA()
+}
+
+// Accent returns a colour that stands out against img: the complement of
+// its most colourful common swatch.
+func Accent(img image.Image) color.RGBA {
+	sw := Extract(img, 8)
+	if len(sw) == 0 {
+		return color.RGBA{A: 255}
+	}
+	best := sw[0]
+	for _, s := range sw[1:] {
+		if s.Share >= 0.05 && s.Lab.Chroma() > best.Lab.Chroma() {
+			best = s
+		}
+	}
+	return Complement(best.Color)
+}
+
+// Complement returns the opposite hue of c at the same lightness. Dull
+// colours get a minimum colourfulness, and neutral greys map to the
+// opposite lightness, so the result always contrasts.
+func Complement(c color.Color) color.RGBA {
+	lab := ToLab(c)
+	chroma := lab.Chroma()
+	if chroma < 2 {
+		return Lab{L: 100 - lab.L}.RGBA()
+	}
+	k := -1.0
+	if chroma < 30 {
+		k = -30 / chroma
+	}
+	return Lab{L: lab.L, A: lab.A * k, B: lab.B * k}.RGBA()
+}
+
+// sample converts the pixels of r to Lab on a grid of about limit points,
+// skipping mostly transparent ones.
+func sample(img image.Image, r image.Rectangle, limit int) []Lab {
+	if r.Empty() {
+		return nil
+	}
+	step := max(1, int(math.Ceil(math.Sqrt(float64(r.Dx())*float64(r.Dy())/float64(limit)))))
+	out := make([]Lab, 0, (r.Dx()/step+1)*(r.Dy()/step+1))
+	for y := r.Min.Y; y < r.Max.Y; y += step {
+		for x := r.Min.X; x < r.Max.X; x += step {
+			n := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if n.A < 128 {
+				continue
+			}
+			out = append(out, rgbToLab(n.R, n.G, n.B))
+		}
+	}
+	return out
+}
+
+// medianCut splits the samples into at most n boxes, always cutting the
+// box with the largest spread along its widest axis at the median, and
+// returns the box means.
+func medianCut(samples []Lab, n int) []Lab {
+	type box struct {
+		pts  []Lab
+		axis int
+		span float64
+	}
+	measure := func(pts []Lab) box {
+		lo := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+		hi := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+		for _, p := range pts {
+			for i, v := range [3]float64{p.L, p.A, p.B} {
+				lo[i] = math.Min(lo[i], v)
+				hi[i] = math.Max(hi[i], v)
+			}
+		}
+		bx := box{pts: pts}
+		for i := range lo {
+			if d := hi[i] - lo[i]; d > bx.span {
+				bx.axis, bx.span = i, d
+			}
+		}
+		return bx
+	}
+
+	boxes := []box{measure(samples)}
+	for len(boxes) < n {
+		k := -1
+		for i, bx := range boxes {
+			if len(bx.pts) > 1 && bx.span > 1 && (k < 0 || bx.span > boxes[k].span) {
+				k = i
+			}
+		}
+		if k < 0 {
+			break // nothing left worth splitting
+		}
+		bx := boxes[k]
+		sort.Slice(bx.pts, func(i, j int) bool { return axis(bx.pts[i], bx.axis) < axis(bx.pts[j], bx.axis) })
+		mid := len(bx.pts) / 2
+		boxes[k] = measure(bx.pts[:mid])
+		boxes = append(boxes, measure(bx.pts[mid:]))
+	}
+
+	centres := make([]Lab, len(boxes))
+	for i, bx := range boxes {
+		centres[i] = mean(bx.pts)
+	}
+	return centres
+}
+
+// assign gives every sample to its nearest centre and returns the
+// resulting clusters as swatches, most common first.
+func assign(samples, centres []Lab) []Swatch {
+	sums := make([]Lab, len(centres))
+	counts := make([]int, len(centres))
+	for _, p := range samples {
+		k := nearest(p, centres)
+		sums[k].L += p.L
+		sums[k].A += p.A
+		sums[k].B += p.B
+		counts[k]++
+	}
+	out := make([]Swatch, 0, len(centres))
+	for k, n := range counts {
+		if n == 0 {
+			continue
+		}
+		f := float64(n)
+		lab := Lab{L: sums[k].L / f, A: sums[k].A / f, B: sums[k].B / f}
+		c := lab.RGBA()
+		out = append(out, Swatch{Color: c, Hex: hex(c), Lab: lab, Share: f / float64(len(samples))})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Share > out[j].Share })
+	return out
+}
+
+func nearest(p Lab, centres []Lab) int {
+	k, best := 0, math.Inf(1)
+	for i, c := range centres {
+		if d := p.dist2(c); d < best {
+			k, best = i, d
+		}
+	}
+	return k
+}
+
+func mean(pts []Lab) Lab {
+	var m Lab
+	for _, p := range pts {
+		m.L += p.L
+		m.A += p.A
+		m.B += p.B
+	}
+	f := float64(len(pts))
+	return Lab{L: m.L / f, A: m.A / f, B: m.B / f}
+}
+
+func axis(p Lab, i int) float64 {
+	switch i {
+	case 1:
+		return p.A
+	case 2:
+		return p.B
+	}
+	return p.L
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
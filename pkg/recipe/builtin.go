@@ -0,0 +1,330 @@
+package recipe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/HumbleLines/imgpipe/pkg/adjust"
+	"github.com/HumbleLines/imgpipe/pkg/border"
+	"github.com/HumbleLines/imgpipe/pkg/crop"
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/filter"
+	"github.com/HumbleLines/imgpipe/pkg/grade"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parse"
+	"github.com/HumbleLines/imgpipe/pkg/redact"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/rotate"
+	"github.com/HumbleLines/imgpipe/pkg/watermark"
+)
+
+// The built-in operations. Parameter names are the lower-case option
+// names, with underscores between words.
+func init() {
+	Register("auto-orient", buildAutoOrient)
+	Register("compress", buildCompress)
+	Register("convert", buildConvert)
+	Register("resize", buildResize)
+	Register("crop", buildCrop)
+	Register("rotate", buildRotate)
+	Register("border", buildBorder)
+	Register("watermark", buildWatermark)
+	Register("adjust", buildAdjust)
+	Register("filter", buildFilter)
+	Register("grade", buildGrade)
+	Register("redact", buildRedact)
+}
+
+func buildAutoOrient(p *Params) (imageops.Handler, error) {
+	return rotate.AutoOrientHandler(quality(p)), nil
+}
+
+func buildCompress(p *Params) (imageops.Handler, error) {
+	q := quality(p)
+	return stage("compress", "jpeg", q, same), nil
+}
+
+func buildConvert(p *Params) (imageops.Handler, error) {
+	format := strings.ToLower(p.String("format", ""))
+	q := quality(p)
+	switch format {
+	case "jpg", "jpeg", "png":
+	case "":
+		return nil, errors.New("format is required")
+	default:
+		return nil, imgerr.Mark(imgerr.ErrUnsupportedFormat, fmt.Errorf("unsupported format %q (want jpeg or png)", format))
+	}
+	return stage("convert", format, q, same), nil
+}
+
+func buildResize(p *Params) (imageops.Handler, error) {
+	opt := resize.Options{
+		Mode:    Enum(p, "mode", "fit", parse.ResizeModes),
+		Width:   p.Int("width", 0),
+		Height:  p.Int("height", 0),
+		Quality: quality(p),
+	}
+	if err := positive([]string{"width", "height"}, opt.Width, opt.Height); err != nil {
+		return nil, err
+	}
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+	return stage("resize", "jpeg", opt.Quality, func(src image.Image) image.Image {
+		return resize.Apply(src, opt)
+	}), nil
+}
+
+func buildCrop(p *Params) (imageops.Handler, error) {
+	opt := crop.Options{
+		X:       p.Int("x", 0),
+		Y:       p.Int("y", 0),
+		Width:   p.Int("width", 0),
+		Height:  p.Int("height", 0),
+		Quality: quality(p),
+	}
+	if ratio := p.String("ratio", ""); ratio != "" {
+		if _, err := fmt.Sscanf(ratio, "%d:%d", &opt.RatioW, &opt.RatioH); err != nil || opt.RatioW <= 0 || opt.RatioH <= 0 {
+			return nil, fmt.Errorf("ratio: want W:H, got %q", ratio)
+		}
+		opt.Mode = crop.ModeCenterRatio
+	} else {
+		opt.Mode = crop.ModeRect
+		if opt.Width <= 0 || opt.Height <= 0 {
+			return nil, errors.New("give width and height, or ratio")
+		}
+	}
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+	return stage("crop", "jpeg", opt.Quality, func(src image.Image) image.Image {
+		return crop.Apply(src, opt)
+	}), nil
+}
+
+func buildRotate(p *Params) (imageops.Handler, error) {
+	opt := rotate.Options{Quality: quality(p)}
+	var err error
+	if opt.Mode, err = parse.Enum("degrees", degrees(p), parse.Rotations); err != nil {
+		return nil, err
+	}
+	return stage("rotate", "jpeg", opt.Quality, func(src image.Image) image.Image {
+		return rotate.Apply(src, opt.Mode)
+	}), nil
+}
+
+func buildBorder(p *Params) (imageops.Handler, error) {
+	opt := border.Options{
+		Mode:      Enum(p, "mode", "outset", parse.BorderModes),
+		Thickness: p.Int("thickness", 10),
+		Radius:    p.Int("radius", 0),
+		Format:    p.String("format", ""),
+		Quality:   quality(p),
+	}
+	if v := p.Ints("sides", 4); v != nil {
+		opt.Sides = border.Sides{Top: v[0], Right: v[1], Bottom: v[2], Left: v[3]}
+	}
+	shadowColor := p.Color("shadow_color", color.RGBA{A: 0x80})
+	if v := p.Ints("shadow", 3); v != nil {
+		opt.Shadow = &border.Shadow{OffsetX: v[0], OffsetY: v[1], Blur: v[2], Color: shadowColor}
+	}
+	col := p.String("color", "#ffffff")
+	if src, ok := parse.ColorSources[strings.ToLower(col)]; ok {
+		opt.ColorFrom = src
+	} else {
+		var err error
+		if opt.Color, err = parse.Color(col); err != nil {
+			return nil, fmt.Errorf("color: %w", err)
+		}
+	}
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+	return imageops.Op("border", func(in []byte) ([]byte, error) {
+		src, _, err := decode.Decode(in)
+		if err != nil {
+			return nil, err
+		}
+		if err := border.CheckSize(src.Bounds().Size(), opt); err != nil {
+			return nil, err
+		}
+		return border.Encode(border.Apply(src, opt), opt)
+	}), nil
+}
+
+func buildWatermark(p *Params) (imageops.Handler, error) {
+	text := p.String("text", "")
+	mark := p.Path("image")
+	fontPath := p.Path("font")
+	size, relWidth, angle := p.Float("size", 0), p.Float("rel_width", 0.2), p.Float("angle", -30)
+	textColor := p.Color("color", color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	margin := p.Int("margin", 16)
+	base := watermark.Layer{
+		Anchor:  Enum(p, "anchor", "bottom-right", parse.Anchors),
+		Margin:  watermark.Margin{X: margin, Y: margin},
+		Opacity: p.Float("opacity", 0.6),
+		Blend:   Enum(p, "blend", "normal", parse.Blends),
+	}
+	if p.Bool("tile", false) {
+		base.Tile = &watermark.TileOptions{Angle: angle}
+	}
+	spec := watermark.Spec{Quality: quality(p)}
+	if text == "" && mark == "" {
+		return nil, errors.New("give text and/or image")
+	}
+	if base.Opacity < 0 || base.Opacity > 1 {
+		return nil, errors.New("opacity must be between 0 and 1")
+	}
+	if mark != "" {
+		b, err := readFile("image", mark)
+		if err != nil {
+			return nil, err
+		}
+		l := base
+		l.Image, l.RelWidth = b, relWidth
+		spec.Layers = append(spec.Layers, l)
+	}
+	if text != "" {
+		l := base
+		l.Text, l.FontPt, l.Color = text, size, textColor
+		if fontPath != "" {
+			f, err := watermark.LoadFont(fontPath)
+			if err != nil {
+				return nil, fmt.Errorf("font: %w", err)
+			}
+			l.Fonts = watermark.FontSet{f}
+		}
+		spec.Layers = append(spec.Layers, l)
+	}
+	return watermark.Handler(spec), nil
+}
+
+func buildAdjust(p *Params) (imageops.Handler, error) {
+	return adjust.Handler(adjust.Options{
+		Exposure:   p.Float("exposure", 0),
+		Brightness: p.Float("brightness", 0),
+		Contrast:   p.Float("contrast", 0),
+		Gamma:      p.Float("gamma", 0),
+		Saturation: p.Float("saturation", 0),
+		Vibrance:   p.Float("vibrance", 0),
+		Hue:        p.Float("hue", 0),
+		Quality:    quality(p),
+	}), nil
+}
+
+func buildFilter(p *Params) (imageops.Handler, error) {
+	opt := filter.Options{
+		Radius:    p.Float("radius", 0),
+		Amount:    p.Float("amount", 0),
+		Threshold: p.Int("threshold", 0),
+		Quality:   quality(p),
+	}
+	if !p.Has("kind") {
+		return nil, errors.New("kind is required")
+	}
+	opt.Kind = Enum(p, "kind", "", parse.Filters)
+	return filter.Handler(opt), nil
+}
+
+func buildGrade(p *Params) (imageops.Handler, error) {
+	opt := grade.Options{
+		Amount:    p.Float("amount", 0),
+		Shadow:    p.Color("shadow", color.RGBA{A: 255}),
+		Highlight: p.Color("highlight", color.RGBA{R: 255, G: 255, B: 255, A: 255}),
+		Level:     p.Float("level", 0),
+		Quality:   quality(p),
+	}
+	cube := p.Path("cube")
+	if !p.Has("kind") {
+		return nil, errors.New("kind is required")
+	}
+	opt.Kind = Enum(p, "kind", "", parse.Looks)
+	if cube != "" {
+		var err error
+		if opt.Cube, err = grade.LoadCube(cube); err != nil {
+			return nil, fmt.Errorf("cube: %w", err)
+		}
+	}
+	if opt.Kind == grade.LUT && opt.Cube == nil {
+		return nil, errors.New("kind lut needs cube")
+	}
+	return grade.Handler(opt), nil
+}
+
+func buildRedact(p *Params) (imageops.Handler, error) {
+	opt := redact.Options{
+		Method:        Enum(p, "method", "pixelate", parse.RedactMethods),
+		Strength:      p.Float("strength", 0),
+		Color:         p.Color("color", color.RGBA{A: 255}),
+		Feather:       p.Int("feather", 0),
+		StripMetadata: p.Bool("strip_metadata", false),
+		Quality:       quality(p),
+	}
+	for i, v := range p.List("regions") {
+		r, err := region(v)
+		if err != nil {
+			return nil, fmt.Errorf("regions[%d]: %w", i, err)
+		}
+		opt.Regions = append(opt.Regions, r)
+	}
+	if len(opt.Regions) == 0 {
+		return nil, errors.New("regions is required")
+	}
+	return redact.Handler(opt), nil
+}
+
+// stage turns f, a transformation of the decoded image, into a pipeline
+// stage: the input is decoded through package decode and the result
+// encoded as format, "png" or JPEG at quality q.
+func stage(op, format string, q int, f func(image.Image) image.Image) imageops.Handler {
+	return imageops.Op(op, func(in []byte) ([]byte, error) {
+		src, _, err := decode.Decode(in)
+		if err != nil {
+			return nil, err
+		}
+		buf := new(bytes.Buffer)
+		if img := f(src); format == "png" {
+			err = png.Encode(buf, img)
+		} else {
+			err = jpeg.Encode(buf, img, &jpeg.Options{Quality: q})
+		}
+		return buf.Bytes(), imgerr.Encode(err)
+	})
+}
+
+// same is the transformation of the operations that only re-encode.
+func same(src image.Image) image.Image { return src }
+
+// region reads [x, y, width, height] or a polygon [[x, y], [x, y], ...].
+func region(v any) (redact.Region, error) {
+	l, ok := v.([]any)
+	if !ok || len(l) == 0 {
+		return redact.Region{}, errors.New("want [x, y, width, height] or a list of [x, y] points")
+	}
+	if _, nested := l[0].([]any); !nested {
+		r, err := ints(l, 4)
+		if err != nil {
+			return redact.Region{}, err
+		}
+		return redact.Region{Rect: image.Rect(r[0], r[1], r[0]+r[2], r[1]+r[3])}, nil
+	}
+	if len(l) < 3 {
+		return redact.Region{}, errors.New("a polygon needs at least three points")
+	}
+	var poly []image.Point
+	for _, pt := range l {
+		xy, err := ints(pt, 2)
+		if err != nil {
+			return redact.Region{}, err
+		}
+		poly = append(poly, image.Pt(xy[0], xy[1]))
+	}
+	return redact.Region{Polygon: poly}, nil
+}
@@ -0,0 +1,56 @@
+package recipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// parseJSON decodes a JSON recipe document. JSON carries no line numbers,
+// so steps report Line 0.
+func parseJSON(data []byte) (*object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			return nil, &SyntaxError{Line: 1 + bytes.Count(data[:se.Offset], []byte("\n")), Msg: se.Error()}
+		}
+		return nil, &SyntaxError{Msg: err.Error()}
+	}
+	doc, ok := fromJSON(v).(*object)
+	if !ok {
+		return nil, &SyntaxError{Msg: "top level must map recipe names to lists of steps"}
+	}
+	return doc, nil
+}
+
+// fromJSON converts decoded JSON into the values the YAML and TOML readers
+// produce: *object for mappings, int64 or float64 for numbers.
+func fromJSON(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		obj := newObject(0)
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			obj.set(k, fromJSON(x[k]))
+		}
+		return obj
+	case []any:
+		for i := range x {
+			x[i] = fromJSON(x[i])
+		}
+		return x
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n
+		}
+		f, _ := x.Float64()
+		return f
+	}
+	return v
+}
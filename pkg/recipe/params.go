@@ -0,0 +1,248 @@
+package recipe
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parse"
+)
+
+// Params gives a Builder typed access to the parameters of a step. The
+// first conversion problem is remembered and reported by the build, as is
+// any parameter the builder never asked for (usually a typo).
+type Params struct {
+	m    map[string]any
+	dir  string
+	used map[string]bool
+	err  error
+}
+
+func newParams(m map[string]any, dir string) *Params {
+	return &Params{m: m, dir: dir, used: map[string]bool{}}
+}
+
+// Has reports whether the step sets key.
+func (p *Params) Has(key string) bool {
+	p.used[key] = true
+	_, ok := p.m[key]
+	return ok
+}
+
+// Errorf records an error about key; only the first one is kept.
+func (p *Params) Errorf(key, format string, a ...any) {
+	if p.err == nil {
+		p.err = imgerr.Invalid(key, format, a...)
+	}
+}
+
+func (p *Params) get(key string) (any, bool) {
+	p.used[key] = true
+	v, ok := p.m[key]
+	return v, ok
+}
+
+// String returns key as a string, or def when unset.
+func (p *Params) String(key, def string) string {
+	v, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	s, ok := v.(string)
+	if !ok {
+		p.Errorf(key, "want a string, got %s", describe(v))
+		return def
+	}
+	return s
+}
+
+// Path returns key as a file name, or "" when unset. A relative name is
+// resolved against the directory of the recipe file (see Recipe.Dir).
+func (p *Params) Path(key string) string {
+	s := p.String(key, "")
+	if s == "" || p.dir == "" || filepath.IsAbs(s) {
+		return s
+	}
+	return filepath.Join(p.dir, s)
+}
+
+// Float returns key as a number, or def when unset.
+func (p *Params) Float(key string, def float64) float64 {
+	v, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	f, ok := number(v)
+	if !ok {
+		p.Errorf(key, "want a number, got %s", describe(v))
+		return def
+	}
+	return f
+}
+
+// Int returns key as a whole number, or def when unset.
+func (p *Params) Int(key string, def int) int {
+	v, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	f, ok := number(v)
+	if !ok || f != math.Trunc(f) {
+		p.Errorf(key, "want an integer, got %s", describe(v))
+		return def
+	}
+	return int(f)
+}
+
+// Bool returns key as a boolean, or def when unset.
+func (p *Params) Bool(key string, def bool) bool {
+	v, ok := p.get(key)
+	if !ok {
+		return def
+	}
+	b, ok := v.(bool)
+	if !ok {
+		p.Errorf(key, "want true or false, got %s", describe(v))
+		return def
+	}
+	return b
+}
+
+// Ints returns key as exactly n integers, given either as a list or as a
+// comma-separated string ("0,6,12"); a single number is repeated n times.
+// It returns nil when key is unset.
+func (p *Params) Ints(key string, n int) []int {
+	v, ok := p.get(key)
+	if !ok {
+		return nil
+	}
+	out, err := ints(v, n)
+	if err != nil {
+		p.Errorf(key, "%v", err)
+		return nil
+	}
+	return out
+}
+
+// Color returns key as a colour ("#rrggbb" or "#rrggbbaa"), or def when
+// unset.
+func (p *Params) Color(key string, def color.RGBA) color.RGBA {
+	s := p.String(key, "")
+	if s == "" {
+		return def
+	}
+	c, err := parse.Color(s)
+	if err != nil {
+		p.Errorf(key, "%v", err)
+		return def
+	}
+	return c
+}
+
+// List returns key as a list, or nil when unset.
+func (p *Params) List(key string) []any {
+	v, ok := p.get(key)
+	if !ok {
+		return nil
+	}
+	l, ok := v.([]any)
+	if !ok {
+		p.Errorf(key, "want a list, got %s", describe(v))
+	}
+	return l
+}
+
+// Enum resolves the string parameter key through table; def is used when
+// key is unset.
+func Enum[T any](p *Params, key, def string, table map[string]T) T {
+	v, err := parse.Enum(key, p.String(key, def), table)
+	if err != nil {
+		p.err = firstErr(p.err, err)
+	}
+	return v
+}
+
+// check returns the first recorded error, or an error naming the first
+// parameter the builder did not use.
+func (p *Params) check() error {
+	if p.err != nil {
+		return p.err
+	}
+	var unknown []string
+	for k := range p.m {
+		if !p.used[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return imgerr.Mark(imgerr.ErrInvalidOptions, fmt.Errorf("unknown parameter %q", unknown[0]))
+}
+
+func firstErr(a, b error) error {
+	if a != nil {
+		return a
+	}
+	return b
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func ints(v any, n int) ([]int, error) {
+	switch l := v.(type) {
+	case string:
+		return parse.Ints(l, n)
+	case []any:
+		if len(l) != n {
+			return nil, fmt.Errorf("want %d numbers, got %d", n, len(l))
+		}
+		out := make([]int, n)
+		for i, e := range l {
+			f, ok := number(e)
+			if !ok || f != math.Trunc(f) {
+				return nil, fmt.Errorf("want integers, got %s", describe(e))
+			}
+			out[i] = int(f)
+		}
+		return out, nil
+	}
+	if f, ok := number(v); ok && f == math.Trunc(f) {
+		out := make([]int, n)
+		for i := range out {
+			out[i] = int(f)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("want %d integers, got %s", n, describe(v))
+}
+
+func describe(v any) string {
+	switch x := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", x)
+	case []any:
+		return "a list"
+	case *object:
+		return "a mapping"
+	case nil:
+		return "null"
+	}
+	s := fmt.Sprint(v)
+	return strings.TrimSpace(s)
+}
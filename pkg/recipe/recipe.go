@@ -0,0 +1,291 @@
+// Package recipe runs pipelines described in configuration files instead of
+// Go code. A recipe file holds one or more named recipes; each recipe is a
+// list of steps, and each step names an operation plus its parameters:
+//
+//	thumbnail:
+//	  - op: auto-orient
+//	  - op: resize
+//	    mode: fill
+//	    width: 800
+//	    height: 450
+//	  - op: watermark
+//	    text: "© {exif.Artist}"
+//	    anchor: bottom-right
+//	  - op: convert
+//	    format: png
+//
+// The same document can be written as JSON ({"thumbnail": [{"op": ...}]})
+// or TOML ([[thumbnail]] tables). Operation names resolve through a
+// registry (see Register and Ops); problems are reported as *StepError
+// naming the recipe, the step and, when known, the source line.
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+)
+
+// Step is one operation of a recipe. It marshals to JSON without its line,
+// so equal steps give equal cache keys wherever they are written.
+type Step struct {
+	Op     string         `json:"op"`               // registered operation name
+	Params map[string]any `json:"params,omitempty"` // everything but "op"
+	Line   int            `json:"-"`                // source line, 0 when unknown (JSON)
+}
+
+// Recipe is a named, ordered list of steps. Relative file names in its
+// parameters (watermark images, fonts, cubes) resolve against Dir, which
+// Load sets to the directory of the recipe file; when empty they resolve
+// against the working directory.
+type Recipe struct {
+	Name  string
+	Steps []Step
+	Dir   string
+}
+
+// Book holds the recipes of one file by name.
+type Book map[string]*Recipe
+
+// Names returns the recipe names in sorted order.
+func (b Book) Names() []string {
+	names := make([]string, 0, len(b))
+	for n := range b {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StepError reports a problem with one step of a recipe.
+type StepError struct {
+	Recipe string
+	Step   int // 1-based
+	Op     string
+	Line   int // 0 when unknown
+	Err    error
+}
+
+func (e *StepError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "recipe %q: step %d", e.Recipe, e.Step)
+	if e.Op != "" {
+		fmt.Fprintf(&b, " (%s)", e.Op)
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, " at line %d", e.Line)
+	}
+	b.WriteString(": ")
+	if oe, ok := e.Err.(*imgerr.OpError); ok {
+		// the step is named already, and so is the operation unless the
+		// recipe calls it something else
+		msg := oe.Err.Error()
+		if oe.Op != "" && oe.Op != e.Op && !strings.HasPrefix(msg, oe.Op+": ") {
+			msg = oe.Op + ": " + msg
+		}
+		b.WriteString(msg)
+	} else {
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *StepError) Unwrap() error { return e.Err }
+
+// SyntaxError reports a malformed recipe file.
+type SyntaxError struct {
+	Line int // 0 when unknown
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("recipe: line %d: %s", e.Line, e.Msg)
+	}
+	return "recipe: " + e.Msg
+}
+
+// Load reads a recipe file; the format follows the extension (.yaml, .yml,
+// .json or .toml). Files named by its steps are looked up relative to the
+// recipe file.
+func Load(path string) (Book, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	b, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, r := range b {
+		r.Dir = filepath.Dir(path)
+	}
+	return b, nil
+}
+
+// Parse decodes a recipe document in format "yaml", "json" or "toml".
+// An empty format guesses from the first significant character: '{' is
+// JSON, '[' TOML, anything else YAML. Steps are checked for shape only;
+// call Validate or Compile to check them against the registry.
+func Parse(data []byte, format string) (Book, error) {
+	if format == "" {
+		format = sniff(data)
+	}
+	var (
+		doc *object
+		err error
+	)
+	switch format {
+	case "json":
+		doc, err = parseJSON(data)
+	case "yaml", "yml":
+		doc, err = parseYAML(data)
+	case "toml":
+		doc, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("recipe: unknown format %q (want yaml, json or toml)", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toBook(doc)
+}
+
+func sniff(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		switch line[0] {
+		case '{':
+			return "json"
+		case '[':
+			return "toml"
+		}
+		return "yaml"
+	}
+	return "yaml"
+}
+
+// object is a decoded mapping together with the line it started on.
+type object struct {
+	line int
+	keys []string // in document order
+	m    map[string]any
+}
+
+func newObject(line int) *object {
+	return &object{line: line, m: map[string]any{}}
+}
+
+func (o *object) set(key string, v any) bool {
+	if _, dup := o.m[key]; dup {
+		return false
+	}
+	o.keys = append(o.keys, key)
+	o.m[key] = v
+	return true
+}
+
+func toBook(doc *object) (Book, error) {
+	if doc == nil || len(doc.keys) == 0 {
+		return nil, &SyntaxError{Msg: "no recipes defined"}
+	}
+	book := Book{}
+	for _, name := range doc.keys {
+		list, ok := doc.m[name].([]any)
+		if !ok {
+			return nil, &SyntaxError{Line: lineOf(doc.m[name]), Msg: fmt.Sprintf("recipe %q must be a list of steps", name)}
+		}
+		r := &Recipe{Name: name}
+		for i, item := range list {
+			st, ok := item.(*object)
+			if !ok {
+				return nil, &StepError{Recipe: name, Step: i + 1, Err: errors.New("step must be a mapping with an \"op\" key")}
+			}
+			op, _ := st.m["op"].(string)
+			if op == "" {
+				return nil, &StepError{Recipe: name, Step: i + 1, Line: st.line, Err: errors.New("missing \"op\"")}
+			}
+			params := make(map[string]any, len(st.m))
+			for k, v := range st.m {
+				if k != "op" {
+					params[k] = v
+				}
+			}
+			r.Steps = append(r.Steps, Step{Op: op, Params: params, Line: st.line})
+		}
+		if len(r.Steps) == 0 {
+			return nil, &SyntaxError{Line: lineOf(doc.m[name]), Msg: fmt.Sprintf("recipe %q has no steps", name)}
+		}
+		book[name] = r
+	}
+	return book, nil
+}
+
+func lineOf(v any) int {
+	if o, ok := v.(*object); ok {
+		return o.line
+	}
+	return 0
+}
+
+// Compile builds the recipe into a pipeline. Every step is checked; the
+// returned error joins one *StepError per offending step. Errors raised
+// while the pipeline runs are wrapped in a *StepError as well.
+func (r *Recipe) Compile() (*imageops.Pipeline, error) {
+	p := imageops.NewPipeline()
+	var errs []error
+	for i, st := range r.Steps {
+		h, err := build(st, r.Dir)
+		if err != nil {
+			errs = append(errs, &StepError{Recipe: r.Name, Step: i + 1, Op: st.Op, Line: st.Line, Err: err})
+			continue
+		}
+		p.Add(r.wrap(i, st, h))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return p, nil
+}
+
+func (r *Recipe) wrap(i int, st Step, h imageops.Handler) imageops.Handler {
+	return func(in []byte) ([]byte, error) {
+		out, err := h(in)
+		if err != nil {
+			// tag the step here so the pipeline leaves the error alone
+			err = imgerr.AtStep(i+1, err)
+			return nil, &StepError{Recipe: r.Name, Step: i + 1, Op: st.Op, Line: st.Line, Err: err}
+		}
+		return out, nil
+	}
+}
+
+// Run compiles the recipe and runs it on in.
+func (r *Recipe) Run(in []byte) ([]byte, error) {
+	p, err := r.Compile()
+	if err != nil {
+		return nil, err
+	}
+	return p.Run(in)
+}
+
+// Validate compiles every recipe of the book and joins their errors.
+func (b Book) Validate() error {
+	var errs []error
+	for _, name := range b.Names() {
+		if _, err := b[name].Compile(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
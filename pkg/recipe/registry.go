@@ -0,0 +1,107 @@
+package recipe
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+)
+
+// Builder turns the parameters of a step into a pipeline stage. It reads
+// them through p; conversion errors and unused parameters are reported
+// after it returns, so a builder only has to check value ranges and
+// combinations, and should read every parameter before it fails. Files
+// named by parameters should be read here, so a bad path fails validation
+// rather than the first run.
+type Builder func(p *Params) (imageops.Handler, error)
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Builder{}
+)
+
+// Register makes an operation available to recipes under name, replacing
+// any previous registration.
+func Register(name string, b Builder) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[name] = b
+}
+
+// Ops returns the registered operation names in sorted order.
+func Ops() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for n := range registry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func build(st Step, dir string) (imageops.Handler, error) {
+	mu.RLock()
+	b, ok := registry[st.Op]
+	mu.RUnlock()
+	if !ok {
+		return nil, imgerr.Mark(imgerr.ErrInvalidOptions, fmt.Errorf("unknown op %q (want one of %s)", st.Op, strings.Join(Ops(), ", ")))
+	}
+	p := newParams(st.Params, dir)
+	h, err := b(p)
+	if cerr := p.check(); cerr != nil {
+		return nil, cerr
+	}
+	if err != nil {
+		// whatever a builder rejects is a problem with the parameters
+		if !imgerr.Classified(err) {
+			err = imgerr.Mark(imgerr.ErrInvalidOptions, err)
+		}
+		return nil, err
+	}
+	return h, nil
+}
+
+// quality reads the shared "quality" parameter (default 85).
+func quality(p *Params) int {
+	q := p.Int("quality", 85)
+	if q < 1 || q > 100 {
+		p.Errorf("quality", "must be between 1 and 100")
+	}
+	return q
+}
+
+// positive reports an error unless every value is above zero.
+func positive(names []string, vals ...int) error {
+	for i, v := range vals {
+		if v <= 0 {
+			return fmt.Errorf("%s must be positive", names[i])
+		}
+	}
+	return nil
+}
+
+// readFile loads a file named by a parameter.
+func readFile(key, path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return b, nil
+}
+
+// degrees accepts 90 as well as "90".
+func degrees(p *Params) string {
+	if v, ok := p.m["degrees"]; ok {
+		if f, ok := number(v); ok {
+			p.used["degrees"] = true
+			return strconv.Itoa(int(f))
+		}
+	}
+	return p.String("degrees", "90")
+}
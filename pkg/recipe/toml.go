@@ -0,0 +1,99 @@
+package recipe
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML decodes a TOML recipe document, where each recipe is an array
+// of tables, one [[recipe]] table per step. Recipes keep document order;
+// steps written as [[recipe]] tables get the line of their header.
+func parseTOML(data []byte) (*object, error) {
+	var v map[string]any
+	md, err := toml.Decode(string(data), &v)
+	if err != nil {
+		var pe toml.ParseError
+		if errors.As(err, &pe) {
+			return nil, &SyntaxError{Line: pe.Position.Line, Msg: pe.Message}
+		}
+		return nil, &SyntaxError{Msg: err.Error()}
+	}
+	doc := newObject(1)
+	for _, k := range md.Keys() {
+		if len(k) == 1 {
+			if _, ok := doc.m[k[0]]; !ok {
+				doc.set(k[0], fromTOML(v[k[0]]))
+			}
+		}
+	}
+	tomlLines(doc, md, data)
+	return doc, nil
+}
+
+// tomlLines gives each step table the line of its [[header]]. The decoder
+// does not report positions, so headers are matched to the array tables in
+// order; when the two do not pair up the steps keep line 0.
+func tomlLines(doc *object, md toml.MetaData, data []byte) {
+	var headers []int
+	for n, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "[[") {
+			headers = append(headers, n+1)
+		}
+	}
+	var tables []toml.Key
+	for _, k := range md.Keys() {
+		if md.Type(k...) == "ArrayTable" {
+			tables = append(tables, k)
+		}
+	}
+	if len(tables) != len(headers) {
+		return
+	}
+	seen := map[string]int{}
+	for i, k := range tables {
+		if len(k) != 1 {
+			continue
+		}
+		list, _ := doc.m[k[0]].([]any)
+		if j := seen[k[0]]; j < len(list) {
+			if st, ok := list[j].(*object); ok {
+				st.line = headers[i]
+			}
+		}
+		seen[k[0]]++
+	}
+}
+
+// fromTOML converts decoded TOML into the values the other readers
+// produce: *object for tables, []any for arrays. Keys inside a step are
+// sorted, as for JSON.
+func fromTOML(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		obj := newObject(0)
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			obj.set(k, fromTOML(x[k]))
+		}
+		return obj
+	case []map[string]any:
+		list := make([]any, len(x))
+		for i := range x {
+			list[i] = fromTOML(x[i])
+		}
+		return list
+	case []any:
+		for i := range x {
+			x[i] = fromTOML(x[i])
+		}
+		return x
+	}
+	return v
+}
@@ -0,0 +1,141 @@
+package recipe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML decodes a YAML recipe document. Every document of a stream
+// adds its recipes to the book; mappings keep their source line so steps
+// can be reported by position.
+func parseYAML(data []byte) (*object, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var doc *object
+	for {
+		var n yaml.Node
+		if err := dec.Decode(&n); errors.Is(err, io.EOF) {
+			return doc, nil
+		} else if err != nil {
+			return nil, yamlError(err)
+		}
+		if len(n.Content) == 0 {
+			continue
+		}
+		v, err := fromYAML(n.Content[0])
+		if err != nil {
+			return nil, err
+		}
+		top, ok := v.(*object)
+		if !ok {
+			return nil, &SyntaxError{Line: n.Content[0].Line, Msg: "top level must map recipe names to lists of steps"}
+		}
+		if doc == nil {
+			doc = top
+			continue
+		}
+		for _, k := range top.keys {
+			if !doc.set(k, top.m[k]) {
+				return nil, &SyntaxError{Line: lineOf(top.m[k]), Msg: fmt.Sprintf("recipe %q defined twice", k)}
+			}
+		}
+	}
+}
+
+// yamlError turns a decoder error into a *SyntaxError, keeping the line
+// the decoder reports ("yaml: line 3: ...").
+func yamlError(err error) error {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	var line int
+	if _, serr := fmt.Sscanf(msg, "line %d:", &line); serr == nil {
+		msg = strings.TrimSpace(msg[strings.Index(msg, ":")+1:])
+	}
+	return &SyntaxError{Line: line, Msg: msg}
+}
+
+// fromYAML converts a node into the values the other readers produce:
+// *object for mappings, []any for sequences, int64 or float64 for numbers.
+// Aliases are followed and merge keys (<<) are applied.
+func fromYAML(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return fromYAML(n.Alias)
+	case yaml.SequenceNode:
+		list := make([]any, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := fromYAML(c)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case yaml.MappingNode:
+		obj := newObject(n.Line)
+		var merges []*object
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, vn := n.Content[i], n.Content[i+1]
+			v, err := fromYAML(vn)
+			if err != nil {
+				return nil, err
+			}
+			if k.Kind == yaml.ScalarNode && k.Tag == "!!merge" {
+				if merges, err = appendMerge(merges, v, k.Line); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if k.Kind != yaml.ScalarNode {
+				return nil, &SyntaxError{Line: k.Line, Msg: "mapping keys must be plain values"}
+			}
+			if !obj.set(k.Value, v) {
+				return nil, &SyntaxError{Line: k.Line, Msg: fmt.Sprintf("duplicate key %q", k.Value)}
+			}
+		}
+		// explicit keys win over merged ones, earlier merges over later
+		for _, m := range merges {
+			for _, k := range m.keys {
+				obj.set(k, m.m[k])
+			}
+		}
+		return obj, nil
+	case yaml.ScalarNode:
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return nil, &SyntaxError{Line: n.Line, Msg: err.Error()}
+		}
+		switch x := v.(type) {
+		case int:
+			return int64(x), nil
+		case uint64:
+			if x <= math.MaxInt64 {
+				return int64(x), nil
+			}
+			return float64(x), nil
+		}
+		return v, nil
+	}
+	return nil, &SyntaxError{Line: n.Line, Msg: "unsupported YAML node"}
+}
+
+func appendMerge(merges []*object, v any, line int) ([]*object, error) {
+	switch x := v.(type) {
+	case *object:
+		return append(merges, x), nil
+	case []any:
+		for _, e := range x {
+			o, ok := e.(*object)
+			if !ok {
+				return nil, &SyntaxError{Line: line, Msg: "<< wants a mapping or a list of mappings"}
+			}
+			merges = append(merges, o)
+		}
+		return merges, nil
+	}
+	return nil, &SyntaxError{Line: line, Msg: "<< wants a mapping or a list of mappings"}
+}
@@ -0,0 +1,181 @@
+// Package redact hides regions of an image (faces, licence plates, ...)
+// with blur, pixelation or a solid fill. The regions come from the caller,
+// e.g. a separate detector.
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/exif"
+	"github.com/HumbleLines/imgpipe/pkg/filter"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/mask"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithRedact = "redact"
+
+// Method controls how a region is hidden.
+type Method int
+
+const (
+	// Blur : strong gaussian blur. Fine for faces in editorial use, but a
+	// weak blur can sometimes be reversed; prefer Pixelate or Fill for text.
+	Blur Method = iota + 1
+	// Pixelate : large mosaic blocks.
+	Pixelate
+	// Fill : solid colour.
+	Fill
+)
+
+// Region is one area to hide: a rectangle, or a polygon when Polygon has
+// at least three points (Rect is then ignored).
+type Region struct {
+	Rect    image.Rectangle
+	Polygon []image.Point
+}
+
+// MaxStrength is the largest Strength: the blur sigma, which sizes the
+// kernel and the blurred margin, or the pixelate block size.
+const MaxStrength = filter.MaxRadius
+
+// Options declares the regions, the method and output handling.
+type Options struct {
+	Regions  []Region
+	Method   Method     // 0 -> Blur
+	Strength float64    // Blur: sigma in pixels (0 -> 12); Pixelate: block size (0 -> 16); at most MaxStrength
+	Color    color.RGBA // Fill colour, always drawn opaque (zero -> black)
+	Feather  int        // soft edge width in pixels; 0 = hard edge
+	Quality  int        // JPEG quality 1-100, 0 = 85; PNG input stays PNG
+
+	// StripMetadata drops all EXIF from the output. Without it the source
+	// EXIF is kept minus the IFD1 preview, which would otherwise show the
+	// unredacted picture, the MakerNote, where cameras keep further
+	// previews, and the GPS position. Other tags are copied as they are.
+	StripMetadata bool
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports a missing or empty region, a polygon of one or two
+// points, an unknown method, negative Strength or Feather, a Strength
+// above MaxStrength or not a number and a Feather above 256. Without
+// strict mode (see package validate) empty regions hide nothing, such a
+// polygon falls back to Rect, an unknown method blurs, negative and NaN
+// values take their defaults and larger ones count as the maximum.
+func (opt Options) Validate() error {
+	if len(opt.Regions) == 0 {
+		return imgerr.Invalid("Regions", "no regions")
+	}
+	for i, r := range opt.Regions {
+		switch n := len(r.Polygon); {
+		case n > 0 && n < 3:
+			return imgerr.Invalid(fmt.Sprintf("Regions[%d].Polygon", i), "needs at least three points, got %d", n)
+		case n == 0 && r.Rect.Empty():
+			return imgerr.Invalid(fmt.Sprintf("Regions[%d].Rect", i), "empty rectangle %v", r.Rect)
+		}
+	}
+	if opt.Method < 0 || opt.Method > Fill {
+		return imgerr.Invalid("Method", "unknown method %d", opt.Method)
+	}
+	if opt.Feather > mask.MaxBlur {
+		return imgerr.Invalid("Feather", "must be at most %d, got %d", mask.MaxBlur, opt.Feather)
+	}
+	return validate.First(
+		validate.Range("Strength", opt.Strength, 0, MaxStrength),
+		validate.NotNegative("Feather", opt.Feather),
+		validate.Quality(opt.quality()),
+	)
+}
+
+// quality is the JPEG quality to encode with.
+func (opt Options) quality() int {
+	if opt.Quality == 0 {
+		return 85
+	}
+	return opt.Quality
+}
+
+// defaultLogInfo builds a simple log line.
+func defaultLogInfo() string {
+	return fmt.Sprintf("redact:done:image_at %s", time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// handlerRedact returns a closure redacting the regions per Options.
+func handlerRedact(opt *Options) imageops.Handler {
+	invalid := opt.Policy.Check(actionWithRedact, opt.Validate())
+	return imageops.Op("redact", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		src, format, err := decode.Decode(in)
+		if err != nil {
+			return nil, err
+		}
+		img := Apply(src, *opt)
+
+		out := new(bytes.Buffer)
+		if format == "png" {
+			err = png.Encode(out, img)
+		} else {
+			err = jpeg.Encode(out, img, &jpeg.Options{Quality: max(1, min(100, opt.quality()))})
+		}
+		if err != nil {
+			return nil, imgerr.Encode(err)
+		}
+		if opt.StripMetadata {
+			return out.Bytes(), nil
+		}
+		return keepEXIF(in, out.Bytes())
+	})
+}
+
+// keepEXIF copies the source EXIF, without its preview, MakerNote and GPS
+// position, into out.
+func keepEXIF(in, out []byte) ([]byte, error) {
+	raw, err := exif.Locate(in)
+	if errors.Is(err, exif.ErrNoEXIF) {
+		return out, nil
+	}
+	if err == nil {
+		raw, err = exif.StripThumbnail(raw)
+	}
+	if err == nil {
+		raw, err = exif.StripPrivate(raw)
+	}
+	if err != nil {
+		// unreadable EXIF: safer to drop it than to copy it blindly
+		return out, nil
+	}
+	return exif.Embed(out, raw)
+}
+
+// Handler returns the redaction as a stage for imageops.Pipeline.
+func Handler(opt Options) imageops.Handler {
+	return handlerRedact(&opt)
+}
+
+// Redact wires normal log + redaction pipeline.
+func Redact(in []byte, opt Options) ([]byte, error) {
+	normalLog := &logger.MetaPayload{
+		Ob2: logger.LogInfo(actionWithRedact, defaultLogInfo()),
+	}
+	_, _ = logger.LogMetaHandler(normalLog, nil)
+
+	return imageops.NewPipeline().
+		Add(handlerRedact(&opt)).
+		Run(in)
+}
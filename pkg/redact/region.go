@@ -0,0 +1,171 @@
+package redact
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+
+	"github.com/HumbleLines/imgpipe/pkg/filter"
+	"github.com/HumbleLines/imgpipe/pkg/internal/mask"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+)
+
+// Apply redacts a decoded image and returns the result as a new image.
+func Apply(src image.Image, opt Options) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	parallel.Rows(b, func(band image.Rectangle) {
+		draw.Draw(dst, band, src, band.Min, draw.Src)
+	})
+
+	step := mask.BlurStep(opt.Feather)
+	cover := coverage(opt.Regions, b, 3*step)
+	if cover == nil {
+		return dst
+	}
+	if step > 0 {
+		// feather outwards only: the regions themselves stay fully covered
+		soft := mask.Blur(cover, step)
+		for i, v := range cover.Pix {
+			soft.Pix[i] = max(soft.Pix[i], v)
+		}
+		cover = soft
+	}
+	area := cover.Bounds()
+
+	strength := min(opt.Strength, MaxStrength)
+	var effect image.Image
+	switch opt.Method {
+	case Pixelate:
+		size := 16
+		if strength >= 0.5 {
+			size = int(strength + 0.5)
+		}
+		effect = pixelate(dst, area, size)
+	case Fill:
+		// always opaque: a see-through fill would leave the content readable
+		c := color.NRGBAModel.Convert(opt.Color).(color.NRGBA)
+		effect = image.NewUniform(color.RGBA{R: c.R, G: c.G, B: c.B, A: 255})
+	default: // Blur
+		sigma := strength
+		if !(sigma > 0) {
+			sigma = 12
+		}
+		// blur a margin around the area too, so its edges are not clamped
+		pad := area.Inset(-int(math.Ceil(3 * sigma))).Intersect(b)
+		effect = filter.GaussianBlur(dst.SubImage(pad), sigma)
+	}
+	draw.DrawMask(dst, area, effect, area.Min, cover, area.Min, draw.Over)
+	return dst
+}
+
+// coverage rasterises the regions into an anti-aliased mask covering
+// their union (grown by pad and clipped to b). Returns nil if empty.
+func coverage(regions []Region, b image.Rectangle, pad int) *image.Alpha {
+	var area image.Rectangle
+	for _, r := range regions {
+		area = area.Union(r.bounds())
+	}
+	area = area.Inset(-pad).Intersect(b)
+	if area.Empty() {
+		return nil
+	}
+	m := image.NewAlpha(area)
+	for _, r := range regions {
+		if len(r.Polygon) >= 3 {
+			fillPolygon(m, r.Polygon)
+			continue
+		}
+		draw.Draw(m, r.Rect.Canon(), image.Opaque, image.Point{}, draw.Src)
+	}
+	return m
+}
+
+func (r Region) bounds() image.Rectangle {
+	if len(r.Polygon) < 3 {
+		return r.Rect.Canon()
+	}
+	bb := image.Rectangle{Min: r.Polygon[0], Max: r.Polygon[0]}
+	for _, p := range r.Polygon[1:] {
+		bb.Min.X, bb.Min.Y = min(bb.Min.X, p.X), min(bb.Min.Y, p.Y)
+		bb.Max.X, bb.Max.Y = max(bb.Max.X, p.X), max(bb.Max.Y, p.Y)
+	}
+	return bb
+}
+
+// subRows is the vertical supersampling of polygon edges.
+const subRows = 4
+
+// fillPolygon adds the polygon (even-odd rule) to m with anti-aliased edges.
+func fillPolygon(m *image.Alpha, poly []image.Point) {
+	b := m.Bounds()
+	cov := make([]float64, b.Dx())
+	var xs []float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		clear(cov)
+		for s := 0; s < subRows; s++ {
+			sy := float64(y) + (float64(s)+0.5)/subRows
+			xs = xs[:0]
+			for i := range poly {
+				p, q := poly[i], poly[(i+1)%len(poly)]
+				y0, y1 := float64(p.Y), float64(q.Y)
+				if (sy < y0) == (sy < y1) {
+					continue // edge does not cross this scanline
+				}
+				t := (sy - y0) / (y1 - y0)
+				xs = append(xs, float64(p.X)+t*float64(q.X-p.X))
+			}
+			sort.Float64s(xs)
+			for i := 0; i+1 < len(xs); i += 2 {
+				addSpan(cov, xs[i]-float64(b.Min.X), xs[i+1]-float64(b.Min.X))
+			}
+		}
+		row := m.Pix[m.PixOffset(b.Min.X, y):]
+		for x, c := range cov {
+			if v := uint8(math.Min(255, c*255/subRows+0.5)); v > row[x] {
+				row[x] = v
+			}
+		}
+	}
+}
+
+// addSpan adds the coverage of [x0, x1) to the pixels it overlaps.
+func addSpan(cov []float64, x0, x1 float64) {
+	x0 = math.Max(0, x0)
+	x1 = math.Min(float64(len(cov)), x1)
+	for px := int(x0); px < len(cov) && float64(px) < x1; px++ {
+		cov[px] += math.Min(x1, float64(px+1)) - math.Max(x0, float64(px))
+	}
+}
+
+// pixelate returns the area of img as blocks of size x size averages,
+// aligned to the area's top-left corner.
+func pixelate(img *image.RGBA, area image.Rectangle, size int) *image.RGBA {
+	out := image.NewRGBA(area)
+	for by := area.Min.Y; by < area.Max.Y; by += size {
+		for bx := area.Min.X; bx < area.Max.X; bx += size {
+			blk := image.Rect(bx, by, bx+size, by+size).Intersect(area)
+			var sum [4]int
+			for y := blk.Min.Y; y < blk.Max.Y; y++ {
+				p := img.Pix[img.PixOffset(blk.Min.X, y):img.PixOffset(blk.Max.X, y)]
+				for i := 0; i < len(p); i += 4 {
+					sum[0] += int(p[i])
+					sum[1] += int(p[i+1])
+					sum[2] += int(p[i+2])
+					sum[3] += int(p[i+3])
+				}
+			}
+			n := blk.Dx() * blk.Dy()
+			c := color.RGBA{
+				R: uint8((sum[0] + n/2) / n),
+				G: uint8((sum[1] + n/2) / n),
+				B: uint8((sum[2] + n/2) / n),
+				A: uint8((sum[3] + n/2) / n),
+			}
+			draw.Draw(out, blk, image.NewUniform(c), image.Point{}, draw.Src)
+		}
+	}
+	return out
+}
@@ -2,17 +2,20 @@ package resize
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"image"
 	"image/draw"
 	"image/jpeg"
+	"math"
 	"time"
 
 	xdraw "golang.org/x/image/draw"
 
+	"github.com/HumbleLines/imgpipe/pkg/decode"
 	"github.com/HumbleLines/imgpipe/pkg/imageops"
-	"github.com/HumbleLines/imgpipe/pkg/stego"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
 	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
 )
 
@@ -37,6 +40,24 @@ type Options struct {
 	Width   int // target box width
 	Height  int // target box height
 	Quality int // JPEG quality
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports a mode other than the three above and sizes that are
+// not positive. Without strict mode (see package validate) an unknown
+// mode re-encodes the image unchanged and sizes below 1 count as 1.
+func (opt Options) Validate() error {
+	if opt.Mode < ModeStretch || opt.Mode > ModeFill {
+		return imgerr.Invalid("Mode", "unknown mode %d", opt.Mode)
+	}
+	return validate.First(
+		validate.Positive("Width", opt.Width),
+		validate.Positive("Height", opt.Height),
+		validate.Quality(opt.Quality),
+	)
 }
 
 // defaultLogInfo builds a simple log line.
@@ -46,92 +67,87 @@ func defaultLogInfo() string {
 
 // handlerResize returns a closure performing the resize per Options.
 func handlerResize(opt *Options) imageops.Handler {
-	return func(in []byte) ([]byte, error) {
-		src, _, err := image.Decode(bytes.NewReader(in))
+	invalid := opt.Policy.Check(actionWithResize, opt.Validate())
+	return imageops.Op("resize", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		src, _, err := decode.Decode(in)
 		if err != nil {
 			return nil, err
 		}
-		sb := src.Bounds()
-		sw, sh := sb.Dx(), sb.Dy()
-
-		// clamp target
-		W := max(1, opt.Width)
-		H := max(1, opt.Height)
-
-		var dstImg *image.RGBA
-
-		switch opt.Mode {
-		case ModeStretch:
-			// direct stretch to (W,H)
-			dstImg = image.NewRGBA(image.Rect(0, 0, W, H))
-			xdraw.CatmullRom.Scale(dstImg, dstImg.Bounds(), src, sb, xdraw.Over, nil)
-
-		case ModeFit:
-			// keep aspect, fit inside (W,H)
-			scale := minFloat(float64(W)/float64(sw), float64(H)/float64(sh))
-			tw := max(1, int(float64(sw)*scale))
-			th := max(1, int(float64(sh)*scale))
-			// The target canvas size is tw x th (centered edge filling is an additional requirement, only shrink to the appropriate size here)
-			dstImg = image.NewRGBA(image.Rect(0, 0, tw, th))
-			xdraw.CatmullRom.Scale(dstImg, dstImg.Bounds(), src, sb, xdraw.Over, nil)
-
-		case ModeFill:
-			// keep aspect, fill (W,H) then crop center
-			scale := maxFloat(float64(W)/float64(sw), float64(H)/float64(sh))
-			ww := max(1, int(float64(sw)*scale))
-			hh := max(1, int(float64(sh)*scale))
-
-			// Zoom in to at least cover (W,H)
-			tmp := image.NewRGBA(image.Rect(0, 0, ww, hh))
-			xdraw.CatmullRom.Scale(tmp, tmp.Bounds(), src, sb, xdraw.Over, nil)
-
-			// Then cut off the excess area in the center (W,H)
-			offX := (ww - W) / 2
-			offY := (hh - H) / 2
-			crop := image.Rect(offX, offY, offX+W, offY+H)
-
-			dstImg = image.NewRGBA(image.Rect(0, 0, W, H))
-			draw.Draw(dstImg, dstImg.Bounds(), tmp, crop.Min, draw.Src)
-
-		default:
-			// unknown mode -> passthrough via re-encode
-			dstImg = image.NewRGBA(sb)
-			draw.Draw(dstImg, sb, src, sb.Min, draw.Src)
-		}
+		dstImg := Apply(src, *opt)
 
 		out := new(bytes.Buffer)
 		err = jpeg.Encode(out, dstImg, &jpeg.Options{Quality: max(1, min(100, opt.Quality))})
-		return out.Bytes(), err
+		return out.Bytes(), imgerr.Encode(err)
+	})
+}
+
+// Apply resizes a decoded image per Options (Quality is not used).
+func Apply(src image.Image, opt Options) *image.RGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	// clamp target
+	W := max(1, opt.Width)
+	H := max(1, opt.Height)
+
+	var dstImg *image.RGBA
+
+	switch opt.Mode {
+	case ModeStretch:
+		// direct stretch to (W,H)
+		dstImg = image.NewRGBA(image.Rect(0, 0, W, H))
+		parallel.Scale(xdraw.CatmullRom, dstImg, dstImg.Bounds(), src, sb)
+
+	case ModeFit:
+		// keep aspect, fit inside (W,H)
+		scale := minFloat(float64(W)/float64(sw), float64(H)/float64(sh))
+		tw := max(1, int(float64(sw)*scale))
+		th := max(1, int(float64(sh)*scale))
+		// The target canvas size is tw x th (centered edge filling is an additional requirement, only shrink to the appropriate size here)
+		dstImg = image.NewRGBA(image.Rect(0, 0, tw, th))
+		parallel.Scale(xdraw.CatmullRom, dstImg, dstImg.Bounds(), src, sb)
+
+	case ModeFill:
+		// keep aspect, fill (W,H) then crop center; the crop is taken in
+		// source space so only the visible part is scaled and nothing
+		// larger than (W,H) is allocated
+		scale := maxFloat(float64(W)/float64(sw), float64(H)/float64(sh))
+		cw := max(1, min(sw, int(math.Round(float64(W)/scale))))
+		ch := max(1, min(sh, int(math.Round(float64(H)/scale))))
+		off := sb.Min.Add(image.Pt((sw-cw)/2, (sh-ch)/2))
+
+		dstImg = image.NewRGBA(image.Rect(0, 0, W, H))
+		parallel.Scale(xdraw.CatmullRom, dstImg, dstImg.Bounds(), src, image.Rectangle{Min: off, Max: off.Add(image.Pt(cw, ch))})
+
+	default:
+		// unknown mode -> passthrough via re-encode (see Validate)
+		dstImg = image.NewRGBA(image.Rect(0, 0, sw, sh))
+		draw.Draw(dstImg, dstImg.Bounds(), src, sb.Min, draw.Src)
 	}
+	return dstImg
 }
 
-// complexResizeChain composes resize + jitter + meta-audit, consistent with other modules.
+// complexResizeChain composes resize + jitter, consistent with other modules.
 func complexResizeChain(opt *Options) imageops.Handler {
 	chain := handlerResize(opt)
 	chain = imageops.WithRandomJitter(chain)
-	chain = imageops.WithMetaAudit(chain)
 	return chain
 }
 
-// Resize wires normal log + optional embedded meta + composed pipeline.
+// Resize wires normal log + composed pipeline.
 func Resize(in []byte, opt Options) ([]byte, error) {
 	// 1) normal log for this action
 	normalLog := &logger.MetaPayload{
 		Ob2: logger.LogInfo(actionWithResize, defaultLogInfo()),
 	}
 
-	// 2) optional embedded meta from image
-	var meta *logger.MetaPayload
-	if s, _ := stego.ExtractMetaBytesAuto(in); s != "" {
-		m := &logger.MetaPayload{}
-		_ = json.Unmarshal([]byte(s), m)
-		meta = m
-	}
-
-	// 3) dispatch logs (normal + meta)
-	_, _ = logger.LogMetaHandler(normalLog, meta)
+	// 2) dispatch the log
+	_, _ = logger.LogMetaHandler(normalLog, nil)
 
-	// 4) run chain
+	// 3) run chain
 	return imageops.NewPipeline().
 		Add(complexResizeChain(&opt)).
 		Run(in)
@@ -0,0 +1,101 @@
+package rotate
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/exif"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithOrient = "auto-orient"
+
+func orientLogInfo() string {
+	return fmt.Sprintf("auto-orient:done:image_at %s", time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// handlerOrient turns the pixels upright according to the EXIF orientation.
+// Upright images (orientation 1 or no EXIF) pass through untouched; others
+// are re-encoded (PNG stays PNG) without EXIF, so the orientation cannot be
+// applied a second time by a viewer.
+func handlerOrient(quality int) imageops.Handler {
+	return imageops.Op("auto-orient", func(in []byte) ([]byte, error) {
+		tags, _ := exif.Decode(in)
+		o := tags.Orientation()
+		if o == 1 {
+			return in, nil
+		}
+		src, format, err := decode.Decode(in)
+		if err != nil {
+			return nil, err
+		}
+		dst := Orient(src, o)
+
+		out := new(bytes.Buffer)
+		if format == "png" {
+			err = png.Encode(out, dst)
+		} else {
+			err = jpeg.Encode(out, dst, &jpeg.Options{Quality: clamp(quality, 1, 100)})
+		}
+		return out.Bytes(), imgerr.Encode(err)
+	})
+}
+
+// AutoOrientHandler returns auto-orientation as a stage for imageops.Pipeline.
+func AutoOrientHandler(quality int) imageops.Handler {
+	return handlerOrient(quality)
+}
+
+// AutoOrient wires normal log + auto-orientation pipeline.
+func AutoOrient(in []byte, quality int) ([]byte, error) {
+	normalLog := &logger.MetaPayload{
+		Ob2: logger.LogInfo(actionWithOrient, orientLogInfo()),
+	}
+	_, _ = logger.LogMetaHandler(normalLog, nil)
+
+	return imageops.NewPipeline().
+		Add(handlerOrient(quality)).
+		Run(in)
+}
+
+// Orient applies EXIF orientation o (1-8) to src: the mirrored and rotated
+// variants become an upright image. Unknown values copy src unchanged.
+func Orient(src image.Image, o int) *image.RGBA {
+	sb := src.Bounds()
+	w, h := sb.Dx(), sb.Dy()
+
+	var to func(x, y int) (int, int)
+	swap := false
+	switch o {
+	case 2: // mirrored horizontally
+		to = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3: // rotated 180
+		to = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4: // mirrored vertically
+		to = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5: // transposed
+		to, swap = func(x, y int) (int, int) { return y, x }, true
+	case 6: // needs 90 clockwise
+		to, swap = func(x, y int) (int, int) { return h - 1 - y, x }, true
+	case 7: // transversed
+		to, swap = func(x, y int) (int, int) { return h - 1 - y, w - 1 - x }, true
+	case 8: // needs 270 clockwise
+		to, swap = func(x, y int) (int, int) { return y, w - 1 - x }, true
+	default:
+		return toRGBA(src)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if swap {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+	rotateRows(dst, src, to)
+	return dst
+}
@@ -2,15 +2,17 @@ package rotate
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"image"
 	"image/draw"
 	"image/jpeg"
 	"time"
 
+	"github.com/HumbleLines/imgpipe/pkg/decode"
 	"github.com/HumbleLines/imgpipe/pkg/imageops"
-	"github.com/HumbleLines/imgpipe/pkg/stego"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
 	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
 )
 
@@ -30,6 +32,19 @@ const (
 type Options struct {
 	Mode    Mode
 	Quality int // 1-100
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports an unknown mode. Without strict mode (see package
+// validate) it re-encodes the image unrotated.
+func (opt Options) Validate() error {
+	if opt.Mode < Rotate90CW || opt.Mode > Rotate270CW {
+		return imgerr.Invalid("Mode", "unknown mode %d", opt.Mode)
+	}
+	return validate.Quality(opt.Quality)
 }
 
 func defaultLogInfo() string {
@@ -37,77 +52,100 @@ func defaultLogInfo() string {
 }
 
 func handlerRotate(opt *Options) imageops.Handler {
-	return func(in []byte) ([]byte, error) {
-		src, _, err := image.Decode(bytes.NewReader(in))
+	invalid := opt.Policy.Check(actionWithRotate, opt.Validate())
+	return imageops.Op("rotate", func(in []byte) ([]byte, error) {
+		if invalid != nil {
+			return nil, invalid
+		}
+		src, _, err := decode.Decode(in)
 		if err != nil {
 			return nil, err
 		}
-		sb := src.Bounds()
-		sw, sh := sb.Dx(), sb.Dy()
-
-		var dst *image.RGBA
-		switch opt.Mode {
-		case Rotate90CW:
-			dst = image.NewRGBA(image.Rect(0, 0, sh, sw))
-			for y := 0; y < sh; y++ {
-				for x := 0; x < sw; x++ {
-					dst.Set(sh-1-y, x, src.At(sb.Min.X+x, sb.Min.Y+y))
-				}
-			}
-		case Rotate180:
-			dst = image.NewRGBA(image.Rect(0, 0, sw, sh))
-			for y := 0; y < sh; y++ {
-				for x := 0; x < sw; x++ {
-					dst.Set(sw-1-x, sh-1-y, src.At(sb.Min.X+x, sb.Min.Y+y))
-				}
-			}
-		case Rotate270CW:
-			dst = image.NewRGBA(image.Rect(0, 0, sh, sw))
-			for y := 0; y < sh; y++ {
-				for x := 0; x < sw; x++ {
-					dst.Set(y, sw-1-x, src.At(sb.Min.X+x, sb.Min.Y+y))
-				}
-			}
-		default:
-			// passthrough re-encode
-			dst = image.NewRGBA(sb)
-			draw.Draw(dst, sb, src, sb.Min, draw.Src)
-		}
+		dst := Apply(src, opt.Mode)
 
 		buf := new(bytes.Buffer)
 		if err := jpeg.Encode(buf, dst, &jpeg.Options{Quality: clamp(opt.Quality, 1, 100)}); err != nil {
-			return nil, err
+			return nil, imgerr.Encode(err)
 		}
 		return buf.Bytes(), nil
+	})
+}
+
+// Apply rotates a decoded image clockwise per mode; unknown modes copy
+// src unchanged.
+func Apply(src image.Image, mode Mode) *image.RGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	var dst *image.RGBA
+	switch mode {
+	case Rotate90CW:
+		dst = image.NewRGBA(image.Rect(0, 0, sh, sw))
+		rotateRows(dst, src, func(x, y int) (int, int) { return sh - 1 - y, x })
+	case Rotate180:
+		dst = image.NewRGBA(image.Rect(0, 0, sw, sh))
+		rotateRows(dst, src, func(x, y int) (int, int) { return sw - 1 - x, sh - 1 - y })
+	case Rotate270CW:
+		dst = image.NewRGBA(image.Rect(0, 0, sh, sw))
+		rotateRows(dst, src, func(x, y int) (int, int) { return y, sw - 1 - x })
+	default:
+		// passthrough re-encode (see Validate)
+		dst = toRGBA(src)
 	}
+	return dst
 }
 
 func complexRotateChain(opt *Options) imageops.Handler {
 	chain := handlerRotate(opt)
 	chain = imageops.WithRandomJitter(chain)
-	chain = imageops.WithMetaAudit(chain)
 	return chain
 }
 
-// Rotate runs logging + optional embedded meta + rotation pipeline.
+// Rotate runs logging + rotation pipeline.
 func Rotate(in []byte, opt Options) ([]byte, error) {
 	normalLog := &logger.MetaPayload{
 		Ob2: logger.LogInfo(actionWithRotate, defaultLogInfo()),
 	}
 
-	var meta *logger.MetaPayload
-	if s, _ := stego.ExtractMetaBytesAuto(in); s != "" {
-		m := &logger.MetaPayload{}
-		_ = json.Unmarshal([]byte(s), m)
-		meta = m
-	}
-	_, _ = logger.LogMetaHandler(normalLog, meta)
+	_, _ = logger.LogMetaHandler(normalLog, nil)
 
 	return imageops.NewPipeline().
 		Add(complexRotateChain(&opt)).
 		Run(in)
 }
 
+// rotateRows copies every pixel of src to dst at the position returned by
+// to(x, y), with x and y relative to src's origin. Source rows are
+// processed in parallel bands, each converting one row at a time into a
+// small RGBA buffer (draw has fast paths for the decoder's YCbCr, Gray and
+// NRGBA images), so no full-size copy of src is made. Each source pixel has
+// exactly one destination, so bands never write the same bytes.
+func rotateRows(dst *image.RGBA, src image.Image, to func(x, y int) (int, int)) {
+	sb := src.Bounds()
+	w := sb.Dx()
+	parallel.Rows(image.Rect(0, 0, w, sb.Dy()), func(band image.Rectangle) {
+		row := image.NewRGBA(image.Rect(0, 0, w, 1))
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			draw.Draw(row, row.Bounds(), src, image.Pt(sb.Min.X, sb.Min.Y+y), draw.Src)
+			for x, si := 0, 0; x < w; x, si = x+1, si+4 {
+				dx, dy := to(x, y)
+				di := dst.PixOffset(dx, dy)
+				copy(dst.Pix[di:di+4], row.Pix[si:si+4])
+			}
+		}
+	})
+}
+
+// toRGBA copies src into a new RGBA image with its origin at (0,0).
+func toRGBA(src image.Image) *image.RGBA {
+	sb := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+	parallel.Rows(rgba.Bounds(), func(band image.Rectangle) {
+		draw.Draw(rgba, band, src, sb.Min.Add(band.Min), draw.Src)
+	})
+	return rgba
+}
+
 func clamp(v, lo, hi int) int {
 	if v < lo {
 		return lo
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"image"
+	"strings"
+
+	"github.com/HumbleLines/imgpipe/pkg/crop"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parse"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/rotate"
+)
+
+// opBuilder reads an operation's parameters from q (recording errors
+// there) and returns the transformation. maxSide bounds requested sizes.
+type opBuilder func(q *query, maxSide int) func(image.Image) image.Image
+
+// ops are the operation endpoints, by path.
+var ops = map[string]opBuilder{
+	"resize":  resizeOp,
+	"crop":    cropOp,
+	"rotate":  rotateOp,
+	"convert": convertOp,
+}
+
+// GET /resize?w=400&h=300&mode=fit|fill|stretch (default fit)
+func resizeOp(q *query, maxSide int) func(image.Image) image.Image {
+	w, h := q.int("w", 0), q.int("h", 0)
+	mode := enum(q, "mode", "fit", parse.ResizeModes)
+	switch {
+	case w <= 0 || h <= 0:
+		q.fail("w", "w and h are required and must be positive")
+	case w > maxSide || h > maxSide:
+		q.fail("w", "w and h must not exceed %d", maxSide)
+	}
+	return func(src image.Image) image.Image {
+		return resize.Apply(src, resize.Options{Mode: mode, Width: w, Height: h})
+	}
+}
+
+// GET /crop?x=10&y=10&w=200&h=100 or /crop?ratio=16:9 (centered)
+func cropOp(q *query, _ int) func(image.Image) image.Image {
+	opt := crop.Options{Mode: crop.ModeRect}
+	if r := q.str("ratio", ""); r != "" {
+		if q.str("w", "") != "" || q.str("h", "") != "" {
+			q.fail("ratio", "give either ratio or x, y, w and h")
+		}
+		rs, err := parse.Ints(strings.Replace(r, ":", ",", 1), 2)
+		if err != nil || !strings.Contains(r, ":") || rs[0] <= 0 || rs[1] <= 0 {
+			q.fail("ratio", "want W:H with positive numbers, got %q", r)
+		} else {
+			opt = crop.Options{Mode: crop.ModeCenterRatio, RatioW: rs[0], RatioH: rs[1]}
+		}
+	} else {
+		opt.X, opt.Y = q.int("x", 0), q.int("y", 0)
+		opt.Width, opt.Height = q.int("w", 0), q.int("h", 0)
+		if opt.X < 0 || opt.Y < 0 || opt.Width <= 0 || opt.Height <= 0 {
+			q.fail("w", "want x, y >= 0 and positive w and h, or ratio")
+		}
+	}
+	return func(src image.Image) image.Image {
+		return crop.Apply(src, opt)
+	}
+}
+
+// GET /rotate?deg=90|180|270|-90
+func rotateOp(q *query, _ int) func(image.Image) image.Image {
+	// the EXIF orientations that need the given clockwise rotation
+	o := enum(q, "deg", "", map[string]int{"90": 6, "180": 3, "270": 8, "-90": 8})
+	return func(src image.Image) image.Image {
+		return rotate.Orient(src, o)
+	}
+}
+
+// GET /convert?fmt=png re-encodes only.
+func convertOp(*query, int) func(image.Image) image.Image {
+	return func(src image.Image) image.Image { return src }
+}
+
+// enum reads a named choice; missing keys take def, "" requires the key.
+func enum[T any](q *query, key, def string, table map[string]T) T {
+	s := q.str(key, def)
+	if s == "" {
+		q.fail(key, "is required")
+		var zero T
+		return zero
+	}
+	v, err := parse.Enum(key, s, table)
+	if err != nil {
+		q.fail(key, "%v", err)
+	}
+	return v
+}
@@ -0,0 +1,572 @@
+// Package server exposes the operations over HTTP, with transformation
+// parameters in the URL:
+//
+//	GET  /resize?src=photos/a.jpg&w=400&h=300&mode=fill&fmt=png
+//	POST /rotate?deg=90            (image in the request body)
+//	GET  /info?src=photos/a.jpg    (JSON: format, width, height, bytes)
+//
+// Sources are files below Options.Root (GET) or the request body (POST,
+// when Options.AllowUpload is set). Without fmt the output format follows
+// the Accept header. Responses carry an ETag derived from the source bytes
+// and the parameters, so conditional requests are answered with 304
+// without processing.
+//
+// With Options.Keys set, only URLs made by Sign are served, so clients
+// cannot ask for arbitrary renditions; Options.Presets and PresetsOnly
+// narrow them further to named parameter sets:
+//
+//	GET /resize?src=a.jpg&preset=thumb&kid=2024&exp=1767225600&sig=...
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/cache"
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithServe = "serve"
+
+// Options configures the server. Zero limits take the defaults below; the
+// width, height and frame limits are those of package decode.
+type Options struct {
+	Root        string // directory served to GET ?src=...; empty disables GET sources
+	AllowUpload bool   // accept the source as a POST body
+
+	MaxBytes  int64 // largest source in bytes; 0 -> 32 MiB
+	MaxPixels int   // largest source in pixels (width*height); 0 -> 50 megapixels
+	MaxSide   int   // largest output width or height; 0 -> 4096
+
+	CacheControl string // Cache-Control for successful responses; "" -> "public, max-age=86400"
+	Quality      int    // default JPEG quality when the URL has no q; 0 -> 85
+
+	// Keys verify signed URLs. When set, requests without a valid sig, or
+	// past their exp, get 403. Keys[0] is the one to sign new URLs with;
+	// keep retired keys listed until the URLs they signed have expired.
+	Keys []Key
+	// Presets name operations with fixed parameters, used as ?preset=name:
+	// {"thumb": "resize?w=400&h=300&mode=fill"}.
+	Presets map[string]string
+	// PresetsOnly rejects operation requests that do not use a preset or
+	// that set anything besides src.
+	PresetsOnly bool
+
+	// Cache, when set, keeps rendered responses by ETag; concurrent
+	// requests for the same rendition are computed once.
+	Cache *cache.Cache
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Server is an http.Handler serving the operations.
+type Server struct {
+	opt     Options
+	root    string // Root with symlinks resolved
+	presets map[string]preset
+	limits  decode.Limits // decode.CurrentLimits with MaxBytes and MaxPixels
+	mux     *http.ServeMux
+}
+
+// Validate reports what New rejects, plus negative limits and a Quality
+// above 100. Without strict mode (see package validate) negative limits
+// take their defaults, while such a Quality fails every request without q.
+func (opt Options) Validate() error {
+	if err := opt.check(); err != nil {
+		return err
+	}
+	return validate.First(
+		validate.NotNegative("MaxBytes", opt.MaxBytes),
+		validate.NotNegative("MaxPixels", opt.MaxPixels),
+		validate.NotNegative("MaxSide", opt.MaxSide),
+		validate.Range("Quality", float64(opt.Quality), 0, 100),
+	)
+}
+
+// check reports the options New cannot start with.
+func (opt Options) check() error {
+	invalid := func(err error) error { return imgerr.Mark(imgerr.ErrInvalidOptions, err) }
+	if opt.Root == "" && !opt.AllowUpload {
+		return invalid(errors.New("server: no source: set Root and/or AllowUpload"))
+	}
+	for _, k := range opt.Keys {
+		if len(k.Secret) == 0 {
+			return invalid(fmt.Errorf("server: key %q has an empty secret", k.ID))
+		}
+	}
+	if opt.PresetsOnly && len(opt.Presets) == 0 {
+		return invalid(errors.New("server: PresetsOnly without Presets"))
+	}
+	side := opt.MaxSide
+	if side <= 0 {
+		side = 4096
+	}
+	if _, err := parsePresets(opt.Presets, side); err != nil {
+		return invalid(err)
+	}
+	return nil
+}
+
+// New validates opt and returns the server.
+func New(opt Options) (*Server, error) {
+	if err := opt.check(); err != nil {
+		return nil, err
+	}
+	if err := opt.Policy.Check(actionWithServe, opt.Validate()); err != nil {
+		return nil, err
+	}
+	if opt.MaxBytes <= 0 {
+		opt.MaxBytes = 32 << 20
+	}
+	if opt.MaxPixels <= 0 {
+		opt.MaxPixels = 50_000_000
+	}
+	if opt.MaxSide <= 0 {
+		opt.MaxSide = 4096
+	}
+	if opt.CacheControl == "" {
+		opt.CacheControl = "public, max-age=86400"
+	}
+	if opt.Quality <= 0 {
+		opt.Quality = 85
+	}
+	presets, err := parsePresets(opt.Presets, opt.MaxSide)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{opt: opt, presets: presets, limits: decode.CurrentLimits(), mux: http.NewServeMux()}
+	s.limits.MaxBytes, s.limits.MaxPixels = opt.MaxBytes, int64(opt.MaxPixels)
+	if opt.Root != "" {
+		root, err := filepath.EvalSymlinks(opt.Root)
+		if err != nil {
+			return nil, fmt.Errorf("server: root: %w", err)
+		}
+		if root, err = filepath.Abs(root); err != nil {
+			return nil, fmt.Errorf("server: root: %w", err)
+		}
+		s.root = filepath.Clean(root)
+	}
+	for name, build := range ops {
+		s.mux.HandleFunc("/"+name, s.transform(name, build))
+	}
+	s.mux.HandleFunc("/info", s.info)
+	return s, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// httpError is an error with the status code to answer it with; other
+// errors are answered with imgerr.HTTPStatus.
+type httpError struct {
+	code int
+	msg  string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+func errorf(code int, format string, a ...any) error {
+	return &httpError{code: code, msg: fmt.Sprintf(format, a...)}
+}
+
+func fail(w http.ResponseWriter, err error) {
+	var he *httpError
+	if !errors.As(err, &he) {
+		he = &httpError{code: imgerr.HTTPStatus(err), msg: err.Error()}
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.Error(w, he.msg, he.code)
+}
+
+func defaultLogInfo(op string) string {
+	return fmt.Sprintf("serve:%s:at %s", op, time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// transform returns the handler of one operation endpoint.
+func (s *Server) transform(name string, build opBuilder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		normalLog := &logger.MetaPayload{
+			Ob2: logger.LogInfo(actionWithServe, defaultLogInfo(name)),
+		}
+		_, _ = logger.LogMetaHandler(normalLog, nil)
+
+		v, err := s.params(r)
+		if err == nil {
+			err = s.expand(name, v)
+		}
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		q := &query{v: v}
+		apply := build(q, s.opt.MaxSide)
+		quality := q.int("q", s.opt.Quality)
+		if quality < 1 || quality > 100 {
+			q.fail("q", "must be between 1 and 100")
+		}
+		fmtParam := strings.ToLower(q.str("fmt", ""))
+		if _, _, err := outputFormat(fmtParam, "*/*", ""); err != nil {
+			q.fail("fmt", "%v", err)
+		}
+		if err := q.check(); err != nil {
+			fail(w, err)
+			return
+		}
+
+		in, err := s.source(r, v.Get("src"))
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		srcFormat, err := s.checkSize(in)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		format, negotiated, err := outputFormat(fmtParam, r.Header.Get("Accept"), srcFormat)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		if negotiated {
+			w.Header().Add("Vary", "Accept")
+		}
+		etag := etagOf(in, name, q.canonical(), fmt.Sprintf("%s/%d", format, quality))
+		if s.notModified(w, r, etag) {
+			return
+		}
+
+		render := func() ([]byte, error) {
+			src, _, err := decode.DecodeWith(in, s.limits)
+			if err != nil {
+				return nil, err
+			}
+			return encode(apply(src), format, quality)
+		}
+		var out []byte
+		if s.opt.Cache != nil {
+			out, err = s.opt.Cache.Do(etag, render)
+		} else {
+			out, err = render()
+		}
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		s.send(w, r, "image/"+format, etag, out)
+	}
+}
+
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.params(r); err != nil {
+		fail(w, err)
+		return
+	}
+	in, err := s.source(r, r.URL.Query().Get("src"))
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	// only the header is read, so no limits apply
+	cfg, format, err := decode.Check(in, decode.Limits{})
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	etag := etagOf(in, "info", "", "json")
+	if s.notModified(w, r, etag) {
+		return
+	}
+	b, _ := json.Marshal(map[string]any{"format": format, "width": cfg.Width, "height": cfg.Height, "bytes": len(in)})
+	s.send(w, r, "application/json", etag, append(b, '\n'))
+}
+
+// params returns the query of r after checking its signature, without
+// the signing parameters.
+func (s *Server) params(r *http.Request) (url.Values, error) {
+	v := r.URL.Query()
+	if len(s.opt.Keys) > 0 {
+		if err := verify(s.opt.Keys, r.URL.Path, v, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	v.Del(paramSig)
+	v.Del(paramKeyID)
+	v.Del(paramExpiry)
+	return v, nil
+}
+
+// source returns the request's image: ?src= below Root for GET and HEAD,
+// the body for POST.
+func (s *Server) source(r *http.Request, src string) ([]byte, error) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if s.root == "" {
+			return nil, errorf(http.StatusMethodNotAllowed, "GET sources are disabled; POST the image")
+		}
+		return s.readFile(src)
+	case http.MethodPost:
+		if !s.opt.AllowUpload {
+			return nil, errorf(http.StatusMethodNotAllowed, "uploads are disabled")
+		}
+		b, err := io.ReadAll(io.LimitReader(r.Body, s.opt.MaxBytes+1))
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "reading body: %v", err)
+		}
+		if int64(len(b)) > s.opt.MaxBytes {
+			return nil, errorf(http.StatusRequestEntityTooLarge, "source larger than %d bytes", s.opt.MaxBytes)
+		}
+		return b, nil
+	}
+	return nil, errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+}
+
+// readFile reads src below the root, refusing paths (or symlinks) that
+// lead outside it.
+func (s *Server) readFile(src string) ([]byte, error) {
+	if src == "" {
+		return nil, errorf(http.StatusBadRequest, "src is required")
+	}
+	rel := filepath.FromSlash(strings.TrimPrefix(src, "/"))
+	if !filepath.IsLocal(rel) {
+		return nil, errorf(http.StatusBadRequest, "src must be a path below the root")
+	}
+	p, err := filepath.EvalSymlinks(filepath.Join(s.root, rel))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errorf(http.StatusNotFound, "%s not found", src)
+		}
+		return nil, errorf(http.StatusBadRequest, "bad src: %v", err)
+	}
+	if r, err := filepath.Rel(s.root, p); err != nil || r == "." || !filepath.IsLocal(r) {
+		return nil, errorf(http.StatusNotFound, "%s not found", src)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, errorf(http.StatusNotFound, "%s not found", src)
+	}
+	defer f.Close()
+	if st, err := f.Stat(); err != nil || st.IsDir() {
+		return nil, errorf(http.StatusNotFound, "%s not found", src)
+	}
+	// read through the open handle, so a file growing after the open still
+	// stops at MaxBytes
+	b, err := io.ReadAll(io.LimitReader(f, s.opt.MaxBytes+1))
+	if err != nil {
+		return nil, errorf(http.StatusInternalServerError, "reading %s: %v", src, err)
+	}
+	if int64(len(b)) > s.opt.MaxBytes {
+		return nil, errorf(http.StatusRequestEntityTooLarge, "source larger than %d bytes", s.opt.MaxBytes)
+	}
+	return b, nil
+}
+
+// checkSize rejects sources whose header breaks the limits, before
+// anything is decoded, and returns the source format.
+func (s *Server) checkSize(in []byte) (string, error) {
+	_, format, err := decode.Check(in, s.limits)
+	return format, err
+}
+
+func etagOf(in []byte, op, params, format string) string {
+	h := sha256.New()
+	src := sha256.Sum256(in)
+	h.Write(src[:])
+	fmt.Fprintf(h, "\x00%s\x00%s\x00%s", op, params, format)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified answers 304 when If-None-Match lists etag.
+func (s *Server) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" {
+		return false
+	}
+	for _, t := range strings.Split(inm, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", s.opt.CacheControl)
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) send(w http.ResponseWriter, r *http.Request, ctype, etag string, b []byte) {
+	h := w.Header()
+	h.Set("Content-Type", ctype)
+	h.Set("Content-Length", strconv.Itoa(len(b)))
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", s.opt.CacheControl)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(b)
+	}
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	var err error
+	if format == "png" {
+		err = png.Encode(buf, img)
+	} else {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
+	}
+	return buf.Bytes(), err
+}
+
+// outputFormat picks "jpeg" or "png": fmt when given, else the Accept
+// header, preferring the source format on ties. negotiated reports
+// whether Accept was consulted (the response then varies on it).
+func outputFormat(fmtParam, accept, src string) (format string, negotiated bool, err error) {
+	switch fmtParam {
+	case "jpg", "jpeg":
+		return "jpeg", false, nil
+	case "png":
+		return "png", false, nil
+	case "", "auto":
+	default:
+		return "", false, errorf(http.StatusBadRequest, "unsupported format %q (want jpeg, png or auto)", fmtParam)
+	}
+	prefs := []string{"jpeg", "png"}
+	if src == "png" {
+		prefs = []string{"png", "jpeg"}
+	}
+	if strings.TrimSpace(accept) == "" {
+		return prefs[0], true, nil
+	}
+	best, bestQ := "", 0.0
+	for _, f := range prefs {
+		if q := acceptQ(accept, "image/"+f); q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	if best == "" {
+		return "", true, errorf(http.StatusNotAcceptable, "can produce image/jpeg or image/png only")
+	}
+	return best, true, nil
+}
+
+// acceptQ returns the quality the Accept header gives to mime, taken
+// from the most specific matching range.
+func acceptQ(accept, mime string) float64 {
+	typ := mime[:strings.IndexByte(mime, '/')]
+	q, spec := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		rng := strings.ToLower(strings.TrimSpace(fields[0]))
+		s := -1
+		switch rng {
+		case mime:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= spec {
+			continue
+		}
+		v := 1.0
+		for _, p := range fields[1:] {
+			k, val, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+					v = f
+				}
+			}
+		}
+		q, spec = v, s
+	}
+	return q
+}
+
+// query reads typed URL parameters, remembering the first error.
+type query struct {
+	v   map[string][]string
+	err error
+}
+
+func (q *query) fail(key, format string, a ...any) {
+	if q.err == nil {
+		q.err = errorf(http.StatusBadRequest, "%s: %s", key, fmt.Sprintf(format, a...))
+	}
+}
+
+func (q *query) str(key, def string) string {
+	if vs, ok := q.v[key]; ok && len(vs) > 0 {
+		return vs[0]
+	}
+	return def
+}
+
+func (q *query) int(key string, def int) int {
+	s := q.str(key, "")
+	if s == "" {
+		return def
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		q.fail(key, "want an integer, got %q", s)
+		return def
+	}
+	return n
+}
+
+func (q *query) float(key string, def float64) float64 {
+	s := q.str(key, "")
+	if s == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		q.fail(key, "want a number, got %q", s)
+		return def
+	}
+	return f
+}
+
+func (q *query) check() error { return q.err }
+
+// canonical renders the parameters in a stable order, for the ETag.
+func (q *query) canonical() string {
+	keys := make([]string, 0, len(q.v))
+	for k := range q.v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range q.v[k] {
+			fmt.Fprintf(&b, "%s=%s&", k, v)
+		}
+	}
+	return b.String()
+}
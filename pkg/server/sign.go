@@ -0,0 +1,169 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key is a URL signing secret. ID, when set, travels in the URL as kid
+// so the server can pick the key without trying each one.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Reserved parameters; they never reach an operation or the ETag.
+const (
+	paramSig    = "sig"
+	paramKeyID  = "kid"
+	paramExpiry = "exp"
+	paramPreset = "preset"
+)
+
+// Sign returns path?query with kid, exp (unless expires is zero) and sig
+// added, signed with key. The server verifies the path and every
+// parameter, so none can be changed or added afterwards.
+func Sign(key Key, path string, params url.Values, expires time.Time) string {
+	v := url.Values{}
+	for k, vs := range params {
+		if k != paramSig {
+			v[k] = append([]string(nil), vs...)
+		}
+	}
+	if key.ID != "" {
+		v.Set(paramKeyID, key.ID)
+	}
+	if !expires.IsZero() {
+		v.Set(paramExpiry, strconv.FormatInt(expires.Unix(), 10))
+	}
+	v.Set(paramSig, signature(key.Secret, path, v))
+	return path + "?" + v.Encode()
+}
+
+// signature is the HMAC-SHA256 of the path and the sorted parameters
+// other than sig.
+func signature(secret []byte, path string, v url.Values) string {
+	rest := url.Values{}
+	for k, vs := range v {
+		if k != paramSig {
+			rest[k] = vs
+		}
+	}
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(path + "?" + rest.Encode()))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// verify checks the signature and expiry of a request against the keys.
+func verify(keys []Key, path string, v url.Values, now time.Time) error {
+	sig := v.Get(paramSig)
+	if sig == "" {
+		return errorf(http.StatusForbidden, "unsigned request")
+	}
+	candidates := keys
+	if kid := v.Get(paramKeyID); kid != "" {
+		candidates = nil
+		for _, k := range keys {
+			if k.ID == kid {
+				candidates = append(candidates, k)
+			}
+		}
+		if candidates == nil {
+			return errorf(http.StatusForbidden, "unknown key %q", kid)
+		}
+	}
+	ok := false
+	for _, k := range candidates {
+		if hmac.Equal([]byte(sig), []byte(signature(k.Secret, path, v))) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return errorf(http.StatusForbidden, "bad signature")
+	}
+	if e := v.Get(paramExpiry); e != "" {
+		exp, err := strconv.ParseInt(e, 10, 64)
+		if err != nil {
+			return errorf(http.StatusForbidden, "bad exp %q", e)
+		}
+		if now.Unix() > exp {
+			return errorf(http.StatusForbidden, "link expired at %s", time.Unix(exp, 0).UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// preset is a named operation with fixed parameters.
+type preset struct {
+	op     string
+	params url.Values
+}
+
+// parsePresets checks every preset ("resize?w=400&h=300") against its
+// operation.
+func parsePresets(m map[string]string, maxSide int) (map[string]preset, error) {
+	out := map[string]preset{}
+	for name, spec := range m {
+		op, raw, _ := strings.Cut(strings.TrimPrefix(spec, "/"), "?")
+		build, ok := ops[op]
+		if !ok {
+			return nil, fmt.Errorf("server: preset %q: unknown operation %q", name, op)
+		}
+		params, err := url.ParseQuery(raw)
+		if err != nil {
+			return nil, fmt.Errorf("server: preset %q: %w", name, err)
+		}
+		for _, k := range []string{"src", paramSig, paramKeyID, paramExpiry, paramPreset} {
+			if params.Has(k) {
+				return nil, fmt.Errorf("server: preset %q: %s cannot be preset", name, k)
+			}
+		}
+		q := &query{v: params}
+		build(q, maxSide)
+		if err := q.check(); err != nil {
+			return nil, fmt.Errorf("server: preset %q: %w", name, err)
+		}
+		out[name] = preset{op: op, params: params}
+	}
+	return out, nil
+}
+
+// expand applies ?preset= to the parameters of a request to op. With
+// PresetsOnly, requests must name a preset and may add nothing but src.
+func (s *Server) expand(op string, v url.Values) error {
+	name := v.Get(paramPreset)
+	if name == "" {
+		if s.opt.PresetsOnly {
+			return errorf(http.StatusForbidden, "only presets are allowed")
+		}
+		return nil
+	}
+	p, ok := s.presets[name]
+	if !ok {
+		return errorf(http.StatusBadRequest, "unknown preset %q", name)
+	}
+	if p.op != op {
+		return errorf(http.StatusBadRequest, "preset %q is a %s, not a %s", name, p.op, op)
+	}
+	v.Del(paramPreset)
+	for k := range v {
+		if s.opt.PresetsOnly && k != "src" {
+			return errorf(http.StatusForbidden, "only presets are allowed: %s cannot be set", k)
+		}
+		if p.params.Has(k) {
+			return errorf(http.StatusBadRequest, "%s is fixed by preset %q", k, name)
+		}
+	}
+	for k, vs := range p.params {
+		v[k] = vs
+	}
+	return nil
+}
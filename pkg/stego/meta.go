@@ -8,12 +8,14 @@ import (
 	"image/png"
 	"os"
 	"strconv"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
 )
 
 // ExtractMetaBytesAuto attempts to extract a binary-encoded metadata string from image bytes.
 // Only works for images encoded with matching format and offset.
 func ExtractMetaBytesAuto(imgBytes []byte) (string, error) {
-	img, _, err := image.Decode(bytes.NewReader(imgBytes))
+	img, _, err := decode.Decode(imgBytes)
 	if err != nil {
 		return "", err
 	}
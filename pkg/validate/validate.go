@@ -0,0 +1,84 @@
+// Package validate decides what the operations do with options that fail
+// their Validate method. By default they log a warning once, when the
+// operation is built, and carry on with the documented fallback (an
+// unknown mode passes the image through, a zero size becomes 1, an
+// out-of-range quality is clamped, ...); with a strict Policy they fail
+// with the error, which matches imgerr.ErrInvalidOptions:
+//
+//	_, err := resize.Resize(in, resize.Options{
+//		Mode: resize.ModeStretch, Height: 300,
+//		Policy: validate.Policy{Strict: true},
+//	})
+//	// err: resize: Width: must be positive, got 0
+package validate
+
+import (
+	"log"
+
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+)
+
+// Policy is set per operation, through its Options. The zero value warns
+// on the standard logger and falls back.
+type Policy struct {
+	Strict bool             // fail instead of falling back
+	Warn   func(msg string) // receives the warnings; nil -> the standard logger
+}
+
+// Check applies the policy to err, the result of op's Validate: in strict
+// mode err is returned, otherwise it is reported to Warn and nil is
+// returned. Operations call it once, when they are built, not per image.
+func (p Policy) Check(op string, err error) error {
+	if err == nil || p.Strict {
+		return err
+	}
+	msg := op + ": " + err.Error() + "; using the fallback"
+	if p.Warn != nil {
+		p.Warn(msg)
+	} else {
+		log.Print("imgpipe: warning: ", msg)
+	}
+	return nil
+}
+
+// Quality checks a JPEG quality.
+func Quality(q int) error {
+	if q < 1 || q > 100 {
+		return imgerr.Invalid("Quality", "must be between 1 and 100, got %d", q)
+	}
+	return nil
+}
+
+// Positive checks a size that must be above zero.
+func Positive(field string, v int) error {
+	if v <= 0 {
+		return imgerr.Invalid(field, "must be positive, got %d", v)
+	}
+	return nil
+}
+
+// NotNegative checks a value that may be zero but not below.
+func NotNegative[T int | int64 | float64](field string, v T) error {
+	if v < 0 {
+		return imgerr.Invalid(field, "must not be negative, got %v", v)
+	}
+	return nil
+}
+
+// Range checks that lo <= v <= hi.
+func Range(field string, v, lo, hi float64) error {
+	if !(v >= lo && v <= hi) {
+		return imgerr.Invalid(field, "must be between %g and %g, got %g", lo, hi, v)
+	}
+	return nil
+}
+
+// First returns the first non-nil error.
+func First(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package variant produces a set of named outputs (sizes, crops, formats)
+// from one upload while decoding it only once, e.g. the renditions behind
+// a responsive srcset.
+package variant
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/crop"
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/exif"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/rotate"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithVariant = "variant"
+
+// Variant is one named output. Crop runs before Resize; either may be nil.
+// Their Quality fields are ignored in favour of Variant.Quality.
+type Variant struct {
+	Name    string
+	Crop    *crop.Options
+	Resize  *resize.Options
+	Format  string // "jpeg" (default) or "png"
+	Quality int    // JPEG quality; 0 -> 85
+}
+
+// Options lists the variants to produce.
+type Options struct {
+	Variants []Variant
+	// AutoOrient turns the source upright per its EXIF orientation before
+	// any variant is cut, so every output shares the correct orientation.
+	AutoOrient bool
+	// Workers bounds variants encoded at once; 0 -> runtime.GOMAXPROCS(0).
+	Workers int
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports what FromImage rejects, plus the options it would
+// otherwise correct: a crop or resize that fails its own Validate, a
+// Quality outside 1~100 other than 0 and negative Workers. Without strict
+// mode (see package validate) only the former fail.
+func (opt Options) Validate() error {
+	if err := check(opt.Variants); err != nil {
+		return err
+	}
+	for _, v := range opt.Variants {
+		var err error
+		if v.Crop != nil {
+			c := *v.Crop
+			c.Quality = 100 // unused, see Variant
+			err = c.Validate()
+		}
+		if v.Resize != nil && err == nil {
+			r := *v.Resize
+			r.Quality = 100
+			err = r.Validate()
+		}
+		if v.Quality != 0 && err == nil {
+			err = validate.Quality(v.Quality)
+		}
+		if err != nil {
+			return fmt.Errorf("variant %q: %w", v.Name, err)
+		}
+	}
+	return validate.NotNegative("Workers", opt.Workers)
+}
+
+// Output is one produced variant.
+type Output struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int    `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	Data   []byte `json:"-"`
+}
+
+// Source describes the decoded input.
+type Source struct {
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int    `json:"bytes"`
+}
+
+// Manifest lists the outputs in the order of Options.Variants; it is
+// ready to be stored as JSON next to them.
+type Manifest struct {
+	Source   Source   `json:"source"`
+	Variants []Output `json:"variants"`
+}
+
+// Get returns the output called name, or nil.
+func (m *Manifest) Get(name string) *Output {
+	for i := range m.Variants {
+		if m.Variants[i].Name == name {
+			return &m.Variants[i]
+		}
+	}
+	return nil
+}
+
+func defaultLogInfo(n int) string {
+	return fmt.Sprintf("variant:done:%d_variants_at %s", n, time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// Generate decodes in once and produces every variant concurrently.
+func Generate(in []byte, opt Options) (*Manifest, error) {
+	normalLog := &logger.MetaPayload{
+		Ob2: logger.LogInfo(actionWithVariant, defaultLogInfo(len(opt.Variants))),
+	}
+	_, _ = logger.LogMetaHandler(normalLog, nil)
+
+	if err := check(opt.Variants); err != nil {
+		return nil, err
+	}
+	src, format, err := decode.Decode(in)
+	if err != nil {
+		return nil, err
+	}
+	if opt.AutoOrient {
+		if tags, _ := exif.Decode(in); tags.Orientation() != 1 {
+			src = rotate.Orient(src, tags.Orientation())
+		}
+	}
+	outs, err := FromImage(src, opt)
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	return &Manifest{
+		Source:   Source{Format: format, Width: b.Dx(), Height: b.Dy(), Bytes: len(in)},
+		Variants: outs,
+	}, nil
+}
+
+// FromImage produces every variant of an already decoded image.
+// AutoOrient is not applied here.
+func FromImage(src image.Image, opt Options) ([]Output, error) {
+	if err := check(opt.Variants); err != nil {
+		return nil, err
+	}
+	if err := opt.Policy.Check(actionWithVariant, opt.Validate()); err != nil {
+		return nil, err
+	}
+	workers := opt.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	outs := make([]Output, len(opt.Variants))
+	errs := make([]error, len(opt.Variants))
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, v := range opt.Variants {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			outs[i], errs[i] = render(src, v)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("variant %q: %w", v.Name, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return outs, nil
+}
+
+// check validates names and formats before any work is done; its errors
+// match imgerr.ErrInvalidOptions or imgerr.ErrUnsupportedFormat.
+func check(vs []Variant) error {
+	if len(vs) == 0 {
+		return imgerr.Mark(imgerr.ErrInvalidOptions, errors.New("variant: no variants"))
+	}
+	seen := map[string]bool{}
+	for i, v := range vs {
+		switch {
+		case v.Name == "":
+			return imgerr.Mark(imgerr.ErrInvalidOptions, fmt.Errorf("variant %d: empty name", i))
+		case seen[v.Name]:
+			return imgerr.Mark(imgerr.ErrInvalidOptions, fmt.Errorf("variant %q: duplicate name", v.Name))
+		}
+		seen[v.Name] = true
+		if _, err := format(v.Format); err != nil {
+			return fmt.Errorf("variant %q: %w", v.Name, err)
+		}
+		if r := v.Resize; r != nil && (r.Width <= 0 || r.Height <= 0) {
+			return imgerr.Mark(imgerr.ErrInvalidOptions, fmt.Errorf("variant %q: resize width and height must be positive", v.Name))
+		}
+	}
+	return nil
+}
+
+func format(f string) (string, error) {
+	switch strings.ToLower(f) {
+	case "", "jpg", "jpeg":
+		return "jpeg", nil
+	case "png":
+		return "png", nil
+	}
+	return "", imgerr.Mark(imgerr.ErrUnsupportedFormat, fmt.Errorf("unsupported format %q (want jpeg or png)", f))
+}
+
+func render(src image.Image, v Variant) (Output, error) {
+	img := src
+	if v.Crop != nil {
+		img = crop.Apply(img, *v.Crop)
+	}
+	if v.Resize != nil {
+		img = resize.Apply(img, *v.Resize)
+	}
+	f, _ := format(v.Format)
+
+	buf := new(bytes.Buffer)
+	var err error
+	if f == "png" {
+		err = png.Encode(buf, img)
+	} else {
+		q := v.Quality
+		if q == 0 {
+			q = 85
+		}
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: max(1, min(100, q))})
+	}
+	if err != nil {
+		return Output{}, imgerr.Encode(err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	b := img.Bounds()
+	return Output{
+		Name:   v.Name,
+		Format: f,
+		Width:  b.Dx(),
+		Height: b.Dy(),
+		Bytes:  buf.Len(),
+		SHA256: hex.EncodeToString(sum[:]),
+		Data:   buf.Bytes(),
+	}, nil
+}
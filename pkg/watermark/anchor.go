@@ -0,0 +1,65 @@
+// Package watermark pkg/watermark/anchor.go
+package watermark
+
+import "image"
+
+// Anchor selects one of the nine reference positions on the target image.
+// The zero value keeps the legacy absolute X/Y placement.
+type Anchor int
+
+const (
+	AnchorNone Anchor = iota // use absolute X/Y
+	AnchorTopLeft
+	AnchorTop
+	AnchorTopRight
+	AnchorLeft
+	AnchorCenter
+	AnchorRight
+	AnchorBottomLeft
+	AnchorBottom
+	AnchorBottomRight
+)
+
+// Margin is the distance kept between the watermark and the anchored edges.
+// Pixel and relative parts are added; PctX is a fraction (0~1) of the target
+// width, PctY of the target height. Margins are ignored on centred axes.
+type Margin struct {
+	X, Y       int
+	PctX, PctY float64
+}
+
+// resolve converts the margin to pixels for a canvas of the given size.
+func (m Margin) resolve(canvas image.Point) image.Point {
+	return image.Pt(
+		m.X+int(float64(canvas.X)*m.PctX+0.5),
+		m.Y+int(float64(canvas.Y)*m.PctY+0.5),
+	)
+}
+
+// place returns the top-left corner for an item of the given size anchored
+// inside canvas. For AnchorNone the caller's absolute position is used.
+func (a Anchor) place(canvas image.Rectangle, size image.Point, m Margin, abs image.Point) image.Point {
+	if a == AnchorNone {
+		return abs
+	}
+	mg := m.resolve(canvas.Size())
+
+	var x, y int
+	switch a {
+	case AnchorTopLeft, AnchorLeft, AnchorBottomLeft:
+		x = canvas.Min.X + mg.X
+	case AnchorTopRight, AnchorRight, AnchorBottomRight:
+		x = canvas.Max.X - size.X - mg.X
+	default:
+		x = canvas.Min.X + (canvas.Dx()-size.X)/2
+	}
+	switch a {
+	case AnchorTopLeft, AnchorTop, AnchorTopRight:
+		y = canvas.Min.Y + mg.Y
+	case AnchorBottomLeft, AnchorBottom, AnchorBottomRight:
+		y = canvas.Max.Y - size.Y - mg.Y
+	default:
+		y = canvas.Min.Y + (canvas.Dy()-size.Y)/2
+	}
+	return image.Pt(x, y)
+}
@@ -0,0 +1,150 @@
+// Package watermark pkg/watermark/blend.go
+package watermark
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+)
+
+// BlendMode selects how a watermark is composited onto the image.
+// The photographic modes follow the W3C Compositing and Blending formulas
+// and are applied with source-over alpha compositing.
+type BlendMode int
+
+const (
+	BlendNormal     BlendMode = iota // Porter-Duff source-over (default)
+	BlendAtop                        // Porter-Duff source-atop: only where the image is opaque
+	BlendMultiply                    // darkens; white is neutral (subtle "emboss" marks)
+	BlendScreen                      // lightens; black is neutral
+	BlendOverlay                     // multiply or screen depending on the image
+	BlendSoftLight                   // gentle overlay
+	BlendDifference                  // absolute difference, stays visible on any tone
+	BlendLuminosity                  // mark luminance with the image's hue and saturation
+)
+
+// blendDraw composites src (at sp) onto dst inside r using mode.
+func blendDraw(dst *image.RGBA, r image.Rectangle, src *image.RGBA, sp image.Point, mode BlendMode) {
+	delta := r.Min.Sub(sp) // dst point = src point + delta
+	r = r.Intersect(dst.Bounds()).Intersect(src.Bounds().Add(delta))
+	if r.Empty() {
+		return
+	}
+	sp = r.Min.Sub(delta)
+	if mode == BlendNormal {
+		draw.Draw(dst, r, src, sp, draw.Over)
+		return
+	}
+
+	parallel.Rows(r, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			di := dst.PixOffset(band.Min.X, y)
+			si := src.PixOffset(band.Min.X-delta.X, y-delta.Y)
+			for x := band.Min.X; x < band.Max.X; x++ {
+				blendPixel(dst.Pix[di:di+4], src.Pix[si:si+4], mode)
+				di += 4
+				si += 4
+			}
+		}
+	})
+}
+
+// blendPixel blends one premultiplied source pixel into d.
+func blendPixel(d, s []uint8, mode BlendMode) {
+	as := float64(s[3]) / 255
+	if as == 0 {
+		return
+	}
+	ab := float64(d[3]) / 255
+
+	var cs, cb, csu, cbu [3]float64 // premultiplied and straight colours
+	for i := 0; i < 3; i++ {
+		cs[i] = float64(s[i]) / 255
+		cb[i] = float64(d[i]) / 255
+		csu[i] = cs[i] / as
+		if ab > 0 {
+			cbu[i] = cb[i] / ab
+		}
+	}
+
+	if mode == BlendAtop {
+		for i := 0; i < 3; i++ {
+			d[i] = to8(cs[i]*ab + cb[i]*(1-as))
+		}
+		return
+	}
+
+	var mix [3]float64
+	if mode == BlendLuminosity {
+		mix = setLum(cbu, lum(csu))
+	} else {
+		for i := 0; i < 3; i++ {
+			mix[i] = blendChannel(cbu[i], csu[i], mode)
+		}
+	}
+	ao := as + ab*(1-as)
+	for i := 0; i < 3; i++ {
+		d[i] = to8(cs[i]*(1-ab) + cb[i]*(1-as) + as*ab*mix[i])
+	}
+	d[3] = to8(ao)
+}
+
+func blendChannel(b, s float64, mode BlendMode) float64 {
+	switch mode {
+	case BlendMultiply:
+		return b * s
+	case BlendScreen:
+		return b + s - b*s
+	case BlendOverlay:
+		// hard-light with the layers swapped
+		if b <= 0.5 {
+			return 2 * b * s
+		}
+		return 1 - 2*(1-b)*(1-s)
+	case BlendSoftLight:
+		if s <= 0.5 {
+			return b - (1-2*s)*b*(1-b)
+		}
+		var d float64
+		if b <= 0.25 {
+			d = ((16*b-12)*b + 4) * b
+		} else {
+			d = math.Sqrt(b)
+		}
+		return b + (2*s-1)*(d-b)
+	case BlendDifference:
+		return math.Abs(b - s)
+	}
+	return s
+}
+
+func lum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+// setLum shifts c to luminance l, clipping back into gamut.
+func setLum(c [3]float64, l float64) [3]float64 {
+	d := l - lum(c)
+	for i := range c {
+		c[i] += d
+	}
+	l = lum(c)
+	n := math.Min(c[0], math.Min(c[1], c[2]))
+	x := math.Max(c[0], math.Max(c[1], c[2]))
+	for i := range c {
+		if n < 0 {
+			c[i] = l + (c[i]-l)*l/(l-n)
+		}
+		if x > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+func to8(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, v*255+0.5)))
+}
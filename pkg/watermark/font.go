@@ -0,0 +1,262 @@
+// Package watermark pkg/watermark/font.go
+package watermark
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Font is a parsed TrueType/OpenType font. Parsed fonts are immutable and
+// may be shared freely; the faces built from them are not (see FontSet.Face).
+type Font struct {
+	key string
+	sf  *opentype.Font
+}
+
+// FontSet is a primary font followed by fallbacks. Glyphs missing from the
+// primary are taken from the first fallback that has them (e.g. a CJK font
+// behind a Latin brand font). A nil or empty set means Go Regular.
+type FontSet []*Font
+
+// maxFacePools bounds the number of set/size combinations whose faces are
+// kept; the oldest combination is dropped first.
+const maxFacePools = 64
+
+var (
+	fontMu    sync.Mutex
+	fontCache = map[string]*Font{}    // key -> parsed font
+	fileCache = map[string]fontFile{} // absolute path -> last load
+
+	faceMu    sync.Mutex
+	faceCache = map[string]*sync.Pool{} // set key + size -> pool of font.Face
+	faceOrder []string                  // faceCache keys, oldest first
+
+	defaultOnce sync.Once
+	defaultFont *Font
+	defaultErr  error
+)
+
+type fontFile struct {
+	mod  time.Time
+	size int64
+	font *Font
+}
+
+// LoadFont reads and parses a .ttf/.otf file. Fonts are cached by path and
+// re-read when the file's modification time or size changes, so repeated
+// calls are cheap.
+func LoadFont(path string) (*Font, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	fontMu.Lock()
+	c, ok := fileCache[abs]
+	fontMu.Unlock()
+	if ok && c.mod.Equal(fi.ModTime()) && c.size == fi.Size() {
+		return c.font, nil
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ParseFont(data)
+	if err != nil {
+		return nil, err
+	}
+	fontMu.Lock()
+	fileCache[abs] = fontFile{mod: fi.ModTime(), size: fi.Size(), font: f}
+	fontMu.Unlock()
+	return f, nil
+}
+
+// ParseFont parses font bytes. Fonts are cached by content hash, so passing
+// the same bytes again does not re-parse them.
+func ParseFont(data []byte) (*Font, error) {
+	sum := sha256.Sum256(data)
+	key := "sha256:" + hex.EncodeToString(sum[:])
+	if f := cachedFont(key); f != nil {
+		return f, nil
+	}
+	return parseCached(key, data)
+}
+
+// DefaultFont returns the embedded Go Regular font.
+func DefaultFont() (*Font, error) {
+	defaultOnce.Do(func() {
+		defaultFont, defaultErr = parseCached("builtin:goregular", goregular.TTF)
+	})
+	return defaultFont, defaultErr
+}
+
+func cachedFont(key string) *Font {
+	fontMu.Lock()
+	defer fontMu.Unlock()
+	return fontCache[key]
+}
+
+func parseCached(key string, data []byte) (*Font, error) {
+	sf, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse font: %w", err)
+	}
+	fontMu.Lock()
+	defer fontMu.Unlock()
+	if f, ok := fontCache[key]; ok {
+		return f, nil
+	}
+	f := &Font{key: key, sf: sf}
+	fontCache[key] = f
+	return f, nil
+}
+
+// Face returns a face for the set at size points (72 DPI) and a release
+// function that hands it back to the cache. font.Face values are not safe
+// for concurrent use, so every caller gets its own face and must call
+// release when done drawing. Sizes are rounded to a quarter point.
+func (s FontSet) Face(size float64) (font.Face, func(), error) {
+	if !(size > 0) || math.IsInf(size, 0) {
+		return nil, nil, fmt.Errorf("font size must be a positive number, got %v", size)
+	}
+	size = max(math.Round(size*4)/4, 0.25)
+	fonts := []*Font(s)
+	if len(fonts) == 0 {
+		f, err := DefaultFont()
+		if err != nil {
+			return nil, nil, err
+		}
+		fonts = []*Font{f}
+	}
+
+	keys := make([]string, len(fonts))
+	for i, f := range fonts {
+		keys[i] = f.key
+	}
+	key := strings.Join(keys, "|") + "@" + strconv.FormatFloat(size, 'f', -1, 64)
+
+	pool := facePool(key)
+	if face, ok := pool.Get().(font.Face); ok {
+		return face, func() { pool.Put(face) }, nil
+	}
+
+	face, err := newFace(fonts, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	return face, func() { pool.Put(face) }, nil
+}
+
+func facePool(key string) *sync.Pool {
+	faceMu.Lock()
+	defer faceMu.Unlock()
+	if p, ok := faceCache[key]; ok {
+		return p
+	}
+	if len(faceOrder) >= maxFacePools {
+		delete(faceCache, faceOrder[0])
+		faceOrder = faceOrder[1:]
+	}
+	p := &sync.Pool{}
+	faceCache[key] = p
+	faceOrder = append(faceOrder, key)
+	return p
+}
+
+func newFace(fonts []*Font, size float64) (font.Face, error) {
+	ff := &fallbackFace{}
+	for _, f := range fonts {
+		face, err := opentype.NewFace(f.sf, &opentype.FaceOptions{
+			Size:    size,
+			DPI:     72,
+			Hinting: font.HintingFull,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ff.faces = append(ff.faces, face)
+		ff.fonts = append(ff.fonts, f.sf)
+	}
+	if len(ff.faces) == 1 {
+		return ff.faces[0], nil
+	}
+	return ff, nil
+}
+
+// fallbackFace routes every rune to the first face whose font has a glyph
+// for it, falling back to the primary face (and its .notdef box).
+type fallbackFace struct {
+	faces []font.Face
+	fonts []*sfnt.Font
+	buf   sfnt.Buffer
+}
+
+func (f *fallbackFace) pick(r rune) font.Face {
+	for i, sf := range f.fonts {
+		if x, err := sf.GlyphIndex(&f.buf, r); err == nil && x != 0 {
+			return f.faces[i]
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	var err error
+	for _, face := range f.faces {
+		if e := face.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.pick(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.pick(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.pick(r).GlyphAdvance(r)
+}
+
+// Kern only applies within one face; pairs spanning two fonts get none.
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	if a := f.pick(r0); a == f.pick(r1) {
+		return a.Kern(r0, r1)
+	}
+	return 0
+}
+
+// Metrics are the primary face's, with line extents widened so fallback
+// glyphs (often taller CJK outlines) fit.
+func (f *fallbackFace) Metrics() font.Metrics {
+	m := f.faces[0].Metrics()
+	for _, face := range f.faces[1:] {
+		fm := face.Metrics()
+		m.Height = max(m.Height, fm.Height)
+		m.Ascent = max(m.Ascent, fm.Ascent)
+		m.Descent = max(m.Descent, fm.Descent)
+	}
+	return m
+}
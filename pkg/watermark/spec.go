@@ -0,0 +1,216 @@
+// Package watermark pkg/watermark/spec.go
+package watermark
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	logger "github.com/HumbleLines/imgpipe/utils/arcmeta"
+)
+
+// Action name for logging
+const actionWithWatermark = "watermark"
+
+// Layer is one text or image watermark. Set Text for a text layer, or
+// Image (encoded bytes) / Mark (decoded) for an image layer.
+type Layer struct {
+	Text  string      // text, may contain {placeholders} (see TemplateContext)
+	Image []byte      // encoded mark, PNG with alpha recommended
+	Mark  image.Image // decoded mark; takes precedence over Image
+
+	// text appearance
+	Fonts  FontSet     // primary font plus fallbacks; nil -> Go Regular
+	FontPt float64     // font size in points; 0 -> ~ image width / 20
+	Color  color.Color // text colour; nil -> white
+	Style  TextStyle   // alignment, stroke, shadow, background box
+
+	// image appearance
+	Scale    float64 // equal scaling of the mark; 0 -> 1 (original size)
+	RelWidth float64 // mark width as a fraction of the image width (0~1); overrides Scale
+
+	// placement
+	Anchor     Anchor       // one of the nine positions; AnchorNone -> RelX/RelY
+	Margin     Margin       // distance from the anchored edges
+	RelX, RelY float64      // centre of the layer (0~1) when Anchor is AnchorNone
+	Offset     image.Point  // extra pixel shift applied after placement
+	Baseline   bool         // text: RelY places the first baseline instead of the centre
+	Tile       *TileOptions // repeat across the whole image; placement is ignored
+
+	Opacity float64   // 0~1; 0 -> 1 (opaque)
+	Blend   BlendMode // compositing mode; default source-over
+}
+
+// Spec describes a complete watermark pass: layers are drawn in order on a
+// single decode of the image and encoded once.
+type Spec struct {
+	Layers  []Layer
+	Vars    map[string]string // values for {placeholders} in text layers
+	Quality int               // JPEG quality; 0 -> 85
+	Now     time.Time         // time used by {now}; zero -> time.Now()
+
+	// Policy decides what happens when Validate fails (see package
+	// validate).
+	Policy validate.Policy `json:"-"`
+}
+
+// Validate reports a layer whose Style.Stroke is outside 0~MaxStroke or
+// whose Tile spacing is negative. Without strict mode (see package
+// validate) the stroke is clamped and a negative spacing means the default.
+func (spec Spec) Validate() error {
+	for i, l := range spec.Layers {
+		if s := l.Style.Stroke; s < 0 || s > MaxStroke {
+			return imgerr.Invalid(fmt.Sprintf("Layers[%d].Style.Stroke", i), "must be between 0 and %d, got %d", MaxStroke, s)
+		}
+		if t := l.Tile; t != nil {
+			if t.SpacingX < 0 {
+				return imgerr.Invalid(fmt.Sprintf("Layers[%d].Tile.SpacingX", i), "must not be negative, got %d", t.SpacingX)
+			}
+			if t.SpacingY < 0 {
+				return imgerr.Invalid(fmt.Sprintf("Layers[%d].Tile.SpacingY", i), "must not be negative, got %d", t.SpacingY)
+			}
+		}
+	}
+	return nil
+}
+
+func defaultLogInfo() string {
+	return fmt.Sprintf("watermark:done:image_at %s", time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// Handler returns a processor that can be plugged into imageops.Pipeline:
+// in -> decode -> draw every layer -> encode (JPEG).
+// Image layers given as bytes are decoded once, up front, within the
+// limits of package decode.
+func Handler(spec Spec) func([]byte) ([]byte, error) {
+	quality := spec.Quality
+	if quality <= 0 || quality > 100 {
+		quality = 85
+	}
+	layers := make([]Layer, len(spec.Layers))
+	prepErr := spec.Policy.Check(actionWithWatermark, spec.Validate())
+	for i, l := range spec.Layers {
+		if l.Mark == nil && len(l.Image) > 0 {
+			m, _, err := decode.Decode(l.Image)
+			if err != nil && prepErr == nil {
+				prepErr = fmt.Errorf("layer %d: mark: %w", i, err)
+			}
+			l.Mark = m
+		}
+		layers[i] = l
+	}
+
+	return func(in []byte) ([]byte, error) {
+		if prepErr != nil {
+			return nil, imgerr.Wrap(actionWithWatermark, prepErr)
+		}
+		out, err := render(in, spec, layers, quality)
+		return out, imgerr.Wrap(actionWithWatermark, err)
+	}
+}
+
+// render decodes in, draws the prepared layers and encodes the result.
+func render(in []byte, spec Spec, layers []Layer, quality int) ([]byte, error) {
+	src, format, err := decode.Decode(in)
+	if err != nil {
+		return nil, err
+	}
+	dst := cloneRGBA(src)
+
+	ctx := NewTemplateContext(in, src, format, spec.Vars)
+	ctx.Now = spec.Now
+	for i, l := range layers {
+		if err := l.drawOn(dst, ctx); err != nil {
+			return nil, fmt.Errorf("layer %d: %w", i, err)
+		}
+	}
+	return encodeJPEG(dst, quality)
+}
+
+// Watermark is the public entry: it logs the action and runs spec over the
+// image. Returns the processed JPEG bytes.
+func Watermark(in []byte, spec Spec) ([]byte, error) {
+	normalLog := &logger.MetaPayload{
+		Ob2: logger.LogInfo(actionWithWatermark, defaultLogInfo()),
+	}
+	_, _ = logger.LogMetaHandler(normalLog, nil)
+
+	return Handler(spec)(in)
+}
+
+// drawOn renders the layer onto dst.
+func (l Layer) drawOn(dst *image.RGBA, ctx TemplateContext) error {
+	opacity := opacityOf(l.Opacity)
+
+	var item *image.RGBA
+	var size image.Point
+	dotY := -1 // first baseline inside item, text only
+	switch {
+	case l.Text != "":
+		text, err := ExpandText(l.Text, ctx)
+		if err != nil {
+			return err
+		}
+		pt := l.FontPt
+		if pt <= 0 {
+			pt = math.Round(math.Max(12, float64(dst.Bounds().Dx())/20.0))
+		}
+		face, release, err := l.Fonts.Face(pt)
+		if err != nil {
+			return err
+		}
+		defer release()
+		col := l.Color
+		if col == nil {
+			col = color.White
+		}
+		lbl := RenderLabel(text, face, premulColor(col, opacity), opacity, 0, l.Style)
+		item, size = lbl.Img, lbl.Img.Bounds().Size()
+		dotY = lbl.Dot.Y - lbl.Img.Bounds().Min.Y
+	case l.Mark != nil:
+		scale := l.Scale
+		if scale <= 0 {
+			scale = 1
+		}
+		m := prepareMark(l.Mark, dst.Bounds().Dx(), scale, l.RelWidth, opacity)
+		if m == nil {
+			return nil
+		}
+		item, size = m, m.Bounds().Size()
+	default:
+		return nil
+	}
+
+	if l.Tile != nil {
+		drawTiled(dst, item, *l.Tile, l.Blend)
+		return nil
+	}
+
+	b := dst.Bounds()
+	centre := image.Pt(
+		b.Min.X+int(float64(b.Dx())*clamp01(l.RelX))-size.X/2,
+		b.Min.Y+int(float64(b.Dy())*clamp01(l.RelY))-size.Y/2,
+	)
+	if l.Baseline && dotY >= 0 {
+		centre.Y = b.Min.Y + int(float64(b.Dy())*clamp01(l.RelY)) - dotY
+	}
+	pos := l.Anchor.place(b, size, l.Margin, centre).Add(l.Offset)
+	blendDraw(dst, image.Rectangle{Min: pos, Max: pos.Add(size)}, item, item.Bounds().Min, l.Blend)
+	return nil
+}
+
+// encodeJPEG encodes img at the given quality.
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, imgerr.Encode(err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,234 @@
+// Package watermark pkg/watermark/style.go
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/HumbleLines/imgpipe/pkg/internal/mask"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+)
+
+// Align controls horizontal alignment of multi-line text within its block.
+type Align int
+
+const (
+	AlignLeft Align = iota
+	AlignCenter
+	AlignRight
+)
+
+// Shadow is a drop shadow cast by the text (and its stroke).
+type Shadow struct {
+	OffsetX, OffsetY int         // pixels, positive = right/down
+	Blur             int         // approximate gaussian radius in pixels; 0 = hard shadow
+	Color            color.Color // nil or fully transparent = no shadow
+}
+
+// Box is a filled background behind the text block.
+type Box struct {
+	Padding int         // pixels between text and box edge
+	Radius  int         // corner radius in pixels; 0 = square corners
+	Color   color.Color // fill colour
+}
+
+// MaxStroke is the widest outline in pixels; wider strokes are clamped.
+const MaxStroke = 64
+
+// TextStyle decorates watermark text. The zero value draws plain,
+// left-aligned text with line height taken from the font metrics.
+// Style colours are scaled by the owning options' Opacity.
+type TextStyle struct {
+	Align       Align
+	LineHeight  float64     // multiple of the font's line height; 0 = 1
+	Stroke      int         // outline width in pixels, at most MaxStroke; 0 = none
+	StrokeColor color.Color // outline colour (default black)
+	Shadow      *Shadow     // optional drop shadow
+	Box         *Box        // optional background box
+}
+
+// Label is text rendered with its decorations, ready to composite.
+type Label struct {
+	Img   *image.RGBA
+	Dot   image.Point // left end of the first baseline inside Img
+	Width int         // width of the text block, without decorations
+}
+
+// lineSkip resolves the distance between baselines: an explicit override
+// wins, otherwise the face's line height scaled by st.LineHeight.
+func (st TextStyle) lineSkip(face font.Face, override int) int {
+	if override > 0 {
+		return override
+	}
+	lh := st.LineHeight
+	if lh <= 0 {
+		lh = 1
+	}
+	return max(1, int(math.Round(float64(face.Metrics().Height)/64*lh)))
+}
+
+// RenderLabel draws text (\n-separated lines) with style onto a transparent
+// image just large enough to hold it. fill is the final text colour; style
+// colours are scaled by opacity. lineSkip <= 0 derives the line height from
+// the face metrics.
+func RenderLabel(text string, face font.Face, fill color.Color, opacity float64, lineSkip int, st TextStyle) Label {
+	return renderLabel(text, face, fill, opacity, st.lineSkip(face, lineSkip), st)
+}
+
+func renderLabel(text string, face font.Face, fill color.Color, opacity float64, skip int, st TextStyle) Label {
+	st.Stroke = min(max(0, st.Stroke), MaxStroke)
+	lines := strings.Split(text, "\n")
+	met := face.Metrics()
+	ascent, descent := met.Ascent.Ceil(), met.Descent.Ceil()
+
+	d := &font.Drawer{Face: face}
+	widths := make([]int, len(lines))
+	bw := 0
+	for i, ln := range lines {
+		widths[i] = d.MeasureString(ln).Ceil()
+		bw = max(bw, widths[i])
+	}
+	bh := ascent + descent + (len(lines)-1)*skip
+	if bw <= 0 || bh <= 0 {
+		return Label{Img: image.NewRGBA(image.Rectangle{})}
+	}
+
+	// block-relative rectangles; the union becomes the label canvas
+	block := image.Rect(0, 0, bw, bh)
+	stroked := block.Inset(-st.Stroke)
+	canvas := stroked
+	var boxRect, shadowRect image.Rectangle
+	if st.Box != nil {
+		boxRect = stroked.Inset(-max(0, st.Box.Padding))
+		canvas = canvas.Union(boxRect)
+	}
+	if hasColor(shadowColor(st.Shadow)) {
+		shadowRect = stroked.Add(image.Pt(st.Shadow.OffsetX, st.Shadow.OffsetY)).Inset(-3 * mask.BlurStep(st.Shadow.Blur))
+		canvas = canvas.Union(shadowRect)
+	}
+	off := canvas.Min.Mul(-1)
+	img := image.NewRGBA(image.Rect(0, 0, canvas.Dx(), canvas.Dy()))
+
+	// glyph coverage for the whole block
+	glyphs := image.NewAlpha(img.Bounds())
+	d.Dst, d.Src = glyphs, image.Opaque
+	for i, ln := range lines {
+		x := 0
+		switch st.Align {
+		case AlignCenter:
+			x = (bw - widths[i]) / 2
+		case AlignRight:
+			x = bw - widths[i]
+		}
+		d.Dot = fixed.P(off.X+x, off.Y+ascent+i*skip)
+		d.DrawString(ln)
+	}
+	outline := glyphs
+	if st.Stroke > 0 {
+		outline = dilate(glyphs, st.Stroke)
+	}
+
+	// paint back to front: box, shadow, stroke, fill
+	if st.Box != nil && hasColor(st.Box.Color) {
+		r := boxRect.Add(off)
+		draw.DrawMask(img, r, image.NewUniform(premulColor(st.Box.Color, opacity)), image.Point{},
+			mask.RoundedRect(r.Size(), st.Box.Radius), image.Point{}, draw.Over)
+	}
+	if sc := shadowColor(st.Shadow); hasColor(sc) {
+		sm := image.NewAlpha(img.Bounds())
+		draw.Draw(sm, sm.Bounds().Add(image.Pt(st.Shadow.OffsetX, st.Shadow.OffsetY)), outline, image.Point{}, draw.Src)
+		if r := mask.BlurStep(st.Shadow.Blur); r > 0 {
+			sm = mask.Blur(sm, r)
+		}
+		draw.DrawMask(img, img.Bounds(), image.NewUniform(premulColor(sc, opacity)), image.Point{}, sm, image.Point{}, draw.Over)
+	}
+	if st.Stroke > 0 {
+		sc := st.StrokeColor
+		if sc == nil {
+			sc = color.Black
+		}
+		draw.DrawMask(img, img.Bounds(), image.NewUniform(premulColor(sc, opacity)), image.Point{}, outline, image.Point{}, draw.Over)
+	}
+	draw.DrawMask(img, img.Bounds(), image.NewUniform(fill), image.Point{}, glyphs, image.Point{}, draw.Over)
+
+	return Label{Img: img, Dot: off.Add(image.Pt(0, ascent)), Width: bw}
+}
+
+func shadowColor(s *Shadow) color.Color {
+	if s == nil {
+		return nil
+	}
+	return s.Color
+}
+
+func hasColor(c color.Color) bool {
+	if c == nil {
+		return false
+	}
+	_, _, _, a := c.RGBA()
+	return a > 0
+}
+
+// dilate grows the mask by r pixels with a disc-shaped structuring element.
+// The disc is split into one horizontal run per row offset, so each output
+// row is the maximum of 2r+1 sliding-window maxima: O(r) per pixel, with
+// rows spread over the worker pool.
+func dilate(m *image.Alpha, r int) *image.Alpha {
+	b := m.Bounds()
+	w := b.Dx()
+	span := make([]int, r+1) // half-width of the disc at each row offset
+	for dy := range span {
+		span[dy] = int(math.Sqrt(float64(r*r - dy*dy)))
+	}
+	out := image.NewAlpha(b)
+	parallel.Rows(b, func(band image.Rectangle) {
+		run := make([]uint8, w)
+		queue := make([]int, 0, w)
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			dst := out.Pix[out.PixOffset(b.Min.X, y):][:w]
+			for dy := -r; dy <= r; dy++ {
+				yy := y + dy
+				if yy < b.Min.Y || yy >= b.Max.Y {
+					continue
+				}
+				src := m.Pix[m.PixOffset(b.Min.X, yy):][:w]
+				windowMax(run, src, span[abs(dy)], queue)
+				for x, v := range run {
+					dst[x] = max(dst[x], v)
+				}
+			}
+		}
+	})
+	return out
+}
+
+// windowMax sets dst[x] to the maximum of src[x-s .. x+s], clipped to src,
+// keeping a queue of candidate indices with decreasing values.
+func windowMax(dst, src []uint8, s int, queue []int) {
+	q, head, next := queue[:0], 0, 0
+	for x := range dst {
+		for ; next < len(src) && next <= x+s; next++ {
+			for len(q) > head && src[q[len(q)-1]] <= src[next] {
+				q = q[:len(q)-1]
+			}
+			q = append(q, next)
+		}
+		for q[head] < x-s {
+			head++
+		}
+		dst[x] = src[q[head]]
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
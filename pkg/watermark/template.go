@@ -0,0 +1,186 @@
+// Package watermark pkg/watermark/template.go
+package watermark
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/exif"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+)
+
+// TemplateContext supplies the values for {placeholders} in watermark text.
+//
+// Placeholders are {name} or {name:spec}; {{ and }} produce literal braces.
+// Braces that do not form a known placeholder are kept as they are, so
+// plain text such as "{draft}" or "a } b" needs no escaping.
+// Names resolve in this order:
+//   - width, height, format, bytes: the image being processed
+//   - now: the current time (Now when set)
+//   - exif.<Field>: an EXIF field such as exif.Artist or exif.DateTimeOriginal;
+//     missing fields expand to ""
+//   - anything else: Vars, the caller-supplied values
+//
+// spec is a Go time layout for times (now, exif date fields) and a single
+// fmt verb for other values: %05d or %x for width, height and bytes, %.8s
+// or %q for text. A verb that does not suit the value is an error.
+type TemplateContext struct {
+	Width, Height int
+	Format        string // decoded format, e.g. "jpeg"
+	Bytes         int    // encoded input size
+	EXIF          exif.Tags
+	Vars          map[string]string
+	Now           time.Time // zero means time.Now()
+}
+
+// NewTemplateContext builds a context for img, decoded from in.
+func NewTemplateContext(in []byte, img image.Image, format string, vars map[string]string) TemplateContext {
+	tags, _ := exif.Decode(in)
+	b := img.Bounds()
+	return TemplateContext{
+		Width:  b.Dx(),
+		Height: b.Dy(),
+		Format: format,
+		Bytes:  len(in),
+		EXIF:   tags,
+		Vars:   vars,
+	}
+}
+
+// ExpandText replaces the placeholders in text using ctx. Unknown names and
+// unbalanced braces pass through unchanged; a bad spec for a known name is
+// an error.
+func ExpandText(text string, ctx TemplateContext) (string, error) {
+	if !strings.ContainsAny(text, "{}") {
+		return text, nil
+	}
+	if ctx.Now.IsZero() {
+		ctx.Now = time.Now()
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '{' && strings.HasPrefix(text[i:], "{{"):
+			sb.WriteByte('{')
+			i++
+		case c == '}' && strings.HasPrefix(text[i:], "}}"):
+			sb.WriteByte('}')
+			i++
+		case c == '{':
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				sb.WriteByte(c)
+				continue
+			}
+			v, ok, err := ctx.resolve(text[i+1 : i+end])
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				// not a placeholder: keep the brace, expand what follows
+				sb.WriteByte(c)
+				continue
+			}
+			sb.WriteString(v)
+			i += end
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+// resolve expands the placeholder ph; ok is false for unknown names.
+func (ctx TemplateContext) resolve(ph string) (s string, ok bool, err error) {
+	name, spec, _ := strings.Cut(ph, ":")
+	name = strings.TrimSpace(name)
+
+	var v any
+	switch {
+	case name == "width":
+		v = ctx.Width
+	case name == "height":
+		v = ctx.Height
+	case name == "format":
+		v = ctx.Format
+	case name == "bytes":
+		v = ctx.Bytes
+	case name == "now":
+		v = ctx.Now
+	case strings.HasPrefix(name, "exif."):
+		field := strings.TrimPrefix(name, "exif.")
+		if t, ok := ctx.EXIF.Time(field); ok {
+			v = t
+		} else {
+			v = ctx.EXIF[field]
+		}
+	default:
+		s, ok := ctx.Vars[name]
+		if !ok {
+			return "", false, nil
+		}
+		v = s
+	}
+	s, err = formatValue(name, v, spec)
+	return s, true, err
+}
+
+func formatValue(name string, v any, spec string) (string, error) {
+	if t, ok := v.(time.Time); ok {
+		if spec == "" {
+			spec = "2006-01-02"
+		}
+		return t.Format(spec), nil
+	}
+	if spec == "" {
+		return fmt.Sprint(v), nil
+	}
+	if !strings.HasPrefix(spec, "%") {
+		return "", imgerr.Invalid("Text", "format %q is not valid for {%s}", spec, name)
+	}
+	if err := checkVerb(spec, v); err != nil {
+		return "", imgerr.Invalid("Text", "format %q is not valid for {%s}: %v", spec, name, err)
+	}
+	return fmt.Sprintf(spec, v), nil
+}
+
+// checkVerb reports a spec that does not hold exactly one fmt verb, or
+// whose verb does not suit v, so that fmt never renders "%!d(string=...)".
+func checkVerb(spec string, v any) error {
+	var verb byte
+	n := 0
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			continue
+		}
+		if i++; i < len(spec) && spec[i] == '%' {
+			continue
+		}
+		for i < len(spec) && strings.IndexByte("+-# 0123456789.", spec[i]) >= 0 {
+			i++
+		}
+		if i == len(spec) {
+			return fmt.Errorf("incomplete verb")
+		}
+		verb = spec[i]
+		n++
+	}
+	if n != 1 {
+		return fmt.Errorf("want one verb, got %d", n)
+	}
+	kind, verbs := "string", "sqxXv"
+	switch v.(type) {
+	case int, int64:
+		kind, verbs = "number", "bcdoOqxXUv"
+	case float64:
+		kind, verbs = "decimal", "beEfFgGxXv"
+	}
+	if strings.IndexByte(verbs, verb) < 0 {
+		return fmt.Errorf("%%%c does not format a %s", verb, kind)
+	}
+	return nil
+}
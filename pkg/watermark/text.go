@@ -5,29 +5,34 @@ import (
 	"bytes"
 	"image"
 	"image/color"
-	"image/draw"
 	"image/png"
 )
 
-// TextConfig controls watermark style & placement.
+// TextConfig controls watermark style & placement for imageops.WatermarkText.
+// New code should prefer Spec/Layer, which covers the same ground.
 type TextConfig struct {
 	Text    string     // watermark text
-	Opacity float64    // 0.0 ~ 1.0
+	Opacity float64    // 0.0 ~ 1.0; 0 -> 1 (opaque)
 	RelX    float64    // relative X (0~1), 0.5=center
 	RelY    float64    // relative Y (0~1), e.g. 0.9 = near bottom
 	FontPt  float64    // font size in points; if 0 -> auto scale by image size
+	Fonts   FontSet    // primary font plus fallbacks; nil -> Go Regular
 	Color   color.RGBA // text color (A ignored; use Opacity)
 	Padding int        // extra pixel offset from computed anchor
+
+	// Style sets alignment, stroke and background box. Style.Shadow nil
+	// keeps the default soft shadow (Opacity >= 0.2); &Shadow{} disables it.
+	Style TextStyle
+
+	Tile *TileOptions // repeat the text across the image when set; RelX/RelY are ignored
+
+	Vars map[string]string // values for {placeholders} in Text, see TemplateContext
 }
 
-// Sanitize clamps values into a safe range.
+// Sanitize clamps values into a safe range; an Opacity of 0 or less
+// becomes 1, as for every Opacity in this package.
 func (c *TextConfig) Sanitize() {
-	if c.Opacity < 0 {
-		c.Opacity = 0
-	}
-	if c.Opacity > 1 {
-		c.Opacity = 1
-	}
+	c.Opacity = opacityOf(c.Opacity)
 	if c.RelX < 0 {
 		c.RelX = 0
 	}
@@ -45,14 +50,6 @@ func (c *TextConfig) Sanitize() {
 	}
 }
 
-// rgbaCopy returns an RGBA copy so we can draw on it safely.
-func rgbaCopy(src image.Image) *image.RGBA {
-	b := src.Bounds()
-	dst := image.NewRGBA(b)
-	draw.Draw(dst, b, src, b.Min, draw.Src)
-	return dst
-}
-
 // encodePNG is just a tiny helper if you want PNG in other places.
 func encodePNG(img image.Image) ([]byte, error) {
 	var buf bytes.Buffer
@@ -0,0 +1,131 @@
+// Package watermark pkg/watermark/tile.go
+package watermark
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+)
+
+// TileOptions repeats a watermark over the whole image on a rotated grid,
+// so it cannot be cropped out. Opacity comes from the owning options.
+type TileOptions struct {
+	Angle    float64 // grid rotation in degrees, counter-clockwise (e.g. 30)
+	SpacingX int     // gap between tiles in a row (pixels, >= 0); 0 = half the tile width
+	SpacingY int     // gap between rows (pixels, >= 0); 0 = half the tile height
+	Stagger  float64 // per-row shift as a fraction of the horizontal pitch (0~1), 0.5 = brick
+}
+
+// DrawTiled composites unit repeatedly over dst according to t.
+// The grid is laid out large enough to cover dst at any angle and rotated
+// about the image centre; each tile that lands on dst is drawn with draw.Over.
+// Tile origins are at least 16 pixels apart whatever the unit and spacing.
+func DrawTiled(dst *image.RGBA, unit image.Image, t TileOptions) {
+	drawTiled(dst, unit, t, BlendNormal)
+}
+
+// drawTiled is DrawTiled with a blend mode. Non-normal modes render the
+// rotated grid into a transparent layer first, then blend it in one pass.
+func drawTiled(dst *image.RGBA, unit image.Image, t TileOptions, mode BlendMode) {
+	if mode != BlendNormal {
+		layer := image.NewRGBA(dst.Bounds())
+		drawTiled(layer, unit, t, BlendNormal)
+		blendDraw(dst, dst.Bounds(), layer, layer.Bounds().Min, mode)
+		return
+	}
+	ub := unit.Bounds()
+	if ub.Empty() || dst.Bounds().Empty() {
+		return
+	}
+	gapX, gapY := t.SpacingX, t.SpacingY
+	if gapX <= 0 {
+		gapX = max(1, ub.Dx()/2)
+	}
+	if gapY <= 0 {
+		gapY = max(1, ub.Dy()/2)
+	}
+	pitchX, pitchY := max(ub.Dx()+gapX, minPitch), max(ub.Dy()+gapY, minPitch)
+
+	// the grid spans the destination's diagonal plus one pitch of slack so
+	// rotated edges never show through; each band walks only the grid
+	// cells it can see and draws them straight from the unit, so neither a
+	// grid-sized layer nor a list of tiles is kept
+	db := dst.Bounds()
+	diag := int(math.Ceil(math.Hypot(float64(db.Dx()), float64(db.Dy()))))
+	gw, gh := diag+2*pitchX, diag+2*pitchY
+
+	// a transparent 1px margin keeps the tile edges anti-aliased
+	padded := image.NewRGBA(image.Rect(0, 0, ub.Dx()+2, ub.Dy()+2))
+	draw.Draw(padded, ub.Sub(ub.Min).Add(image.Pt(1, 1)), unit, ub.Min, draw.Src)
+	pb := padded.Bounds()
+
+	// rotate about the centres: dst = R * (grid - cg) + cd
+	rad := t.Angle * math.Pi / 180
+	sin, cos := math.Sincos(rad)
+	cgx, cgy := float64(gw)/2, float64(gh)/2
+	cdx := float64(db.Min.X) + float64(db.Dx())/2
+	cdy := float64(db.Min.Y) + float64(db.Dy())/2
+	m := f64.Aff3{
+		cos, sin, cdx - (cos*cgx + sin*cgy),
+		-sin, cos, cdy - (-sin*cgx + cos*cgy),
+	}
+	// and back: grid = R^T * (dst - cd) + cg
+	inv := f64.Aff3{
+		cos, -sin, cgx - (cos*cdx - sin*cdy),
+		sin, cos, cgy - (sin*cdx + cos*cdy),
+	}
+
+	stagger := clamp01(t.Stagger)
+	parallel.Rows(db, func(band image.Rectangle) {
+		sub := dst.SubImage(band).(*image.RGBA)
+		// grid cells whose padded tile can reach this band
+		g := affineBounds(inv, band)
+		row0 := max(0, floorDiv(g.Min.Y+1-pb.Dy(), pitchY))
+		for row, y := row0, row0*pitchY; y < gh && y-1 < g.Max.Y; row, y = row+1, y+pitchY {
+			shift := int(math.Mod(float64(row)*stagger, 1) * float64(pitchX))
+			x := shift - pitchX
+			if k := floorDiv(g.Min.X+1-pb.Dx()-x, pitchX); k > 0 {
+				x += k * pitchX
+			}
+			for ; x < gw && x-1 < g.Max.X; x += pitchX {
+				tm := m
+				ox, oy := float64(x-1), float64(y-1)
+				tm[2] += cos*ox + sin*oy
+				tm[5] += -sin*ox + cos*oy
+				if affineBounds(tm, pb).Overlaps(band) {
+					draw.BiLinear.Transform(sub, tm, padded, pb, draw.Over, nil)
+				}
+			}
+		}
+	})
+}
+
+// minPitch is the smallest distance between tile origins, so a tiny unit
+// cannot turn into millions of draws.
+const minPitch = 16
+
+// floorDiv is a / b rounded towards negative infinity (b > 0).
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+// affineBounds returns the integer rectangle covering r mapped through m.
+func affineBounds(m f64.Aff3, r image.Rectangle) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range [4]image.Point{r.Min, {r.Max.X, r.Min.Y}, {r.Min.X, r.Max.Y}, r.Max} {
+		x := m[0]*float64(p.X) + m[1]*float64(p.Y) + m[2]
+		y := m[3]*float64(p.X) + m[4]*float64(p.Y) + m[5]
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
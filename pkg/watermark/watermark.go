@@ -2,18 +2,17 @@
 package watermark
 
 import (
-	"bytes"
 	"image"
 	"image/color"
-	"image/jpeg"
 	"math"
-	"strings"
 
 	"golang.org/x/image/draw"
 
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/internal/parallel"
+
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
 )
 
 // --------- Basic tools---------
@@ -29,13 +28,33 @@ func clamp01(v float64) float64 {
 	return v
 }
 
+// opacityOf applies the convention shared by every Opacity field in this
+// package: 0 (the zero value) means fully opaque, values in (0, 1] are used
+// as given and larger ones are clamped to 1. A watermark is never drawn
+// invisible; leave it out instead.
+func opacityOf(v float64) float64 {
+	if !(v > 0) {
+		return 1
+	}
+	return min(v, 1)
+}
+
 // toRGBA ensures that *image.RGBA is obtained so that it can be written and drawn
+// (an *image.RGBA input is returned as is and drawn on in place)
 func toRGBA(img image.Image) *image.RGBA {
 	if r, ok := img.(*image.RGBA); ok {
 		return r
 	}
-	rgba := image.NewRGBA(img.Bounds())
-	draw.Draw(rgba, rgba.Bounds(), img, image.Point{}, draw.Src)
+	return cloneRGBA(img)
+}
+
+// cloneRGBA always returns a fresh RGBA copy so we can draw on it safely.
+func cloneRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	rgba := image.NewRGBA(b)
+	parallel.Rows(b, func(band image.Rectangle) {
+		draw.Draw(rgba, band, img, band.Min, draw.Src)
+	})
 	return rgba
 }
 
@@ -58,70 +77,107 @@ func premulColor(c color.Color, opacity float64) color.Color {
 func ScaleAlpha(img image.Image, opacity float64) *image.RGBA {
 	opacity = clamp01(opacity)
 	src := toRGBA(img)
+	out := image.NewRGBA(src.Bounds())
+	scaleAlphaInto(out, src, opacity)
+	return out
+}
+
+// scaleAlphaInto writes src with its alpha channel multiplied by opacity
+// into dst (same bounds). Rows are processed in parallel bands.
+func scaleAlphaInto(dst, src *image.RGBA, opacity float64) {
 	b := src.Bounds()
-	out := image.NewRGBA(b)
-
-	for y := b.Min.Y; y < b.Max.Y; y++ {
-		for x := b.Min.X; x < b.Max.X; x++ {
-			R, G, B, A := src.At(x, y).RGBA()
-			out.SetRGBA(x, y, color.RGBA{
-				R: uint8(R >> 8),
-				G: uint8(G >> 8),
-				B: uint8(B >> 8),
-				A: uint8(float64(A>>8)*opacity + 0.5),
-			})
+	parallel.Rows(b, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			si := src.PixOffset(b.Min.X, y)
+			di := dst.PixOffset(b.Min.X, y)
+			for x := b.Min.X; x < b.Max.X; x++ {
+				dst.Pix[di+0] = src.Pix[si+0]
+				dst.Pix[di+1] = src.Pix[si+1]
+				dst.Pix[di+2] = src.Pix[si+2]
+				dst.Pix[di+3] = uint8(float64(src.Pix[si+3])*opacity + 0.5)
+				si += 4
+				di += 4
+			}
 		}
-	}
-	return out
+	})
 }
 
 // TextOptions Control text watermarks
 type TextOptions struct {
-	X, Y     int         // Top left corner anchor point (baseline vertex, determined by font)
-	Color    color.Color // color
-	Opacity  float64     // 0~1
-	Face     font.Face   // Font (using basicfont when empty)
-	LineSkip int         // Multi-line spacing pixels
+	X, Y     int          // Left end of the first baseline
+	Color    color.Color  // color
+	Opacity  float64      // 0~1; 0 -> 1 (opaque)
+	Face     font.Face    // Font (using Fonts, then basicfont, when empty)
+	Fonts    FontSet      // Font files with fallbacks, used when Face is nil
+	Size     float64      // Point size for Fonts (default 13)
+	LineSkip int          // Multi-line spacing pixels; 0 = from font metrics
+	Style    TextStyle    // Alignment, stroke, shadow and background box
+	Tile     *TileOptions // Repeat the text across the image when set; X/Y are ignored
+
+	Vars  map[string]string // Values for {placeholders}, expanded by TextWatermarkHandler
+	Blend BlendMode         // Compositing mode; default source-over
 }
 
-// AddTextWatermark Draw text on the image (support multiple lines,\n-separated)
+// AddTextWatermark Draw text on the image (support multiple lines,\n-separated).
+// When Fonts cannot give a face at Size the text is drawn with basicfont;
+// AddTextWatermarkErr reports that instead.
 func AddTextWatermark(img image.Image, text string, opt TextOptions) *image.RGBA {
+	dst, err := AddTextWatermarkErr(img, text, opt)
+	if err != nil {
+		opt.Fonts = nil
+		dst, _ = AddTextWatermarkErr(img, text, opt)
+	}
+	return dst
+}
+
+// AddTextWatermarkErr is AddTextWatermark that fails when Fonts cannot give
+// a face at Size.
+func AddTextWatermarkErr(img image.Image, text string, opt TextOptions) (*image.RGBA, error) {
 	dst := toRGBA(img)
 	if opt.Color == nil {
 		opt.Color = color.RGBA{R: 255, G: 255, B: 255, A: 255}
 	}
+	if opt.Face == nil && len(opt.Fonts) > 0 {
+		size := opt.Size
+		if size <= 0 {
+			size = 13
+		}
+		face, release, err := opt.Fonts.Face(size)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		opt.Face = face
+	}
 	if opt.Face == nil {
 		opt.Face = basicfont.Face7x13
 	}
-	if opt.LineSkip == 0 {
-		opt.LineSkip = 16
-	}
-	col := premulColor(opt.Color, clamp01(opt.Opacity))
+	opacity := opacityOf(opt.Opacity)
+	col := premulColor(opt.Color, opacity)
+	lbl := renderLabel(text, opt.Face, col, opacity, opt.Style.lineSkip(opt.Face, opt.LineSkip), opt.Style)
 
-	d := &font.Drawer{
-		Dst:  dst,
-		Src:  image.NewUniform(col),
-		Face: opt.Face,
+	if opt.Tile != nil {
+		drawTiled(dst, lbl.Img, *opt.Tile, opt.Blend)
+		return dst, nil
 	}
 
-	lines := strings.Split(text, "\n")
-	y := opt.Y
-	for _, ln := range lines {
-		d.Dot = fixed.Point26_6{
-			X: fixed.I(opt.X),
-			Y: fixed.I(y),
-		}
-		d.DrawString(ln)
-		y += opt.LineSkip
-	}
-	return dst
+	pos := image.Pt(opt.X, opt.Y).Sub(lbl.Dot)
+	blendDraw(dst, lbl.Img.Bounds().Add(pos), lbl.Img, image.Point{}, opt.Blend)
+	return dst, nil
 }
 
 // ImageOptions Control image watermark
 type ImageOptions struct {
-	X, Y    int     // Position (top left corner)
+	X, Y    int     // Position (top left corner), used when Anchor is AnchorNone
 	Scale   float64 // Equal scaling (1=original)
-	Opacity float64 // 0~1
+	Opacity float64 // 0~1; 0 -> 1 (opaque)
+
+	Anchor   Anchor  // Reference position on the target; overrides X/Y
+	Margin   Margin  // Distance from the anchored edges
+	RelWidth float64 // Watermark width as a fraction of the target width (0~1); overrides Scale
+
+	Tile  *TileOptions // Repeat the mark across the image when set; placement is ignored
+	Blend BlendMode    // Compositing mode; default source-over
 }
 
 // AddImageWatermark Overlay another small image on the image (scaling and transparency support)
@@ -130,71 +186,97 @@ func AddImageWatermark(img image.Image, mark image.Image, opt ImageOptions) *ima
 	if mark == nil {
 		return dst
 	}
-	opt.Scale = math.Max(opt.Scale, 0.01)
-	opt.Opacity = clamp01(opt.Opacity)
-
-	// Scaling the watermark image first
-	markB := mark.Bounds()
-	w := int(float64(markB.Dx()) * opt.Scale)
-	h := int(float64(markB.Dy()) * opt.Scale)
-	if w <= 0 || h <= 0 {
+	scaled := prepareMark(mark, dst.Bounds().Dx(), opt.Scale, opt.RelWidth, opacityOf(opt.Opacity))
+	if scaled == nil {
 		return dst
 	}
-	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
-	draw.BiLinear.Scale(scaled, scaled.Bounds(), mark, markB, draw.Over, nil)
-
-	// If extra transparency is required, do an Alpha zoom
-	if opt.Opacity < 1 {
-		for y := 0; y < scaled.Bounds().Dy(); y++ {
-			for x := 0; x < scaled.Bounds().Dx(); x++ {
-				R, G, B, A := scaled.At(x, y).RGBA()
-				scaled.SetRGBA(x, y, color.RGBA{
-					R: uint8(R >> 8),
-					G: uint8(G >> 8),
-					B: uint8(B >> 8),
-					A: uint8(float64(A>>8)*opt.Opacity + 0.5),
-				})
-			}
-		}
+
+	if opt.Tile != nil {
+		drawTiled(dst, scaled, *opt.Tile, opt.Blend)
+		return dst
 	}
 
 	// Overlapping to the target map
-	pos := image.Pt(opt.X, opt.Y)
+	pos := opt.Anchor.place(dst.Bounds(), scaled.Bounds().Size(), opt.Margin, image.Pt(opt.X, opt.Y))
 	rect := image.Rectangle{Min: pos, Max: pos.Add(scaled.Bounds().Size())}
-	draw.Draw(dst, rect, scaled, image.Point{}, draw.Over)
+	blendDraw(dst, rect, scaled, image.Point{}, opt.Blend)
 	return dst
 }
 
+// prepareMark scales mark for a target of width targetW and applies
+// opacity. RelWidth (0~1 of the target width) overrides scale so one config
+// suits every image size. Returns nil when the result would be empty.
+func prepareMark(mark image.Image, targetW int, scale, relWidth, opacity float64) *image.RGBA {
+	markB := mark.Bounds()
+	if relWidth > 0 && markB.Dx() > 0 {
+		scale = clamp01(relWidth) * float64(targetW) / float64(markB.Dx())
+	}
+	scale = math.Max(scale, 0.01)
+	w := int(float64(markB.Dx()) * scale)
+	h := int(float64(markB.Dy()) * scale)
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	parallel.Scale(draw.BiLinear, scaled, scaled.Bounds(), mark, markB)
+
+	// If extra transparency is required, fade the (premultiplied) pixels
+	if opacity = clamp01(opacity); opacity < 1 {
+		fadeInto(scaled, opacity)
+	}
+	return scaled
+}
+
+// fadeInto multiplies every premultiplied channel by opacity, which is the
+// correct way to make an RGBA image uniformly more transparent.
+func fadeInto(img *image.RGBA, opacity float64) {
+	b := img.Bounds()
+	parallel.Rows(b, func(band image.Rectangle) {
+		for y := band.Min.Y; y < band.Max.Y; y++ {
+			row := img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)]
+			for i := range row {
+				row[i] = uint8(float64(row[i])*opacity + 0.5)
+			}
+		}
+	})
+}
+
 // --------- Processor compatible with imageops pipeline (bytes -> bytes) ---------
 
 // TextWatermarkHandler Generate a processor that can be plugged into imageops.Pipeline
 // in -> Decoding -> Text Watermark -> Encoding (JPEG)
+//
+// Deprecated: use Handler with a text Layer.
 func TextWatermarkHandler(text string, opt TextOptions, quality int) func([]byte) ([]byte, error) {
 	if quality <= 0 || quality > 100 {
 		quality = 85
 	}
 	return func(in []byte) ([]byte, error) {
 		// 解码
-		src, format, err := image.Decode(bytes.NewReader(in))
+		src, format, err := decode.Decode(in)
+		if err != nil {
+			return nil, err
+		}
+		// expand {placeholders} against this image
+		txt, err := ExpandText(text, NewTemplateContext(in, src, format, opt.Vars))
 		if err != nil {
 			return nil, err
 		}
-		_ = format // Demonstrate exporting directly to JPEG here
 
 		// deal with
-		outImg := AddTextWatermark(src, text, opt)
-
-		// coding
-		var buf bytes.Buffer
-		err = jpeg.Encode(&buf, outImg, &jpeg.Options{Quality: quality})
+		outImg, err := AddTextWatermarkErr(src, txt, opt)
 		if err != nil {
 			return nil, err
 		}
-		return buf.Bytes(), nil
+
+		// coding
+		return encodeJPEG(outImg, quality)
 	}
 }
 
 // ImageWatermarkHandler Generate an image watermark processor
+//
+// Deprecated: use Handler with an image Layer.
 func ImageWatermarkHandler(markBytes []byte, opt ImageOptions, quality int) func([]byte) ([]byte, error) {
 	if quality <= 0 || quality > 100 {
 		quality = 85
@@ -202,23 +284,18 @@ func ImageWatermarkHandler(markBytes []byte, opt ImageOptions, quality int) func
 	// Pre-decoded watermarks to avoid decoding every time
 	var mark image.Image
 	if len(markBytes) > 0 {
-		if m, _, err := image.Decode(bytes.NewReader(markBytes)); err == nil {
+		if m, _, err := decode.Decode(markBytes); err == nil {
 			mark = m
 		}
 	}
 	return func(in []byte) ([]byte, error) {
-		src, _, err := image.Decode(bytes.NewReader(in))
+		src, _, err := decode.Decode(in)
 		if err != nil {
 			return nil, err
 		}
 		outImg := AddImageWatermark(src, mark, opt)
 
-		var buf bytes.Buffer
-		err = jpeg.Encode(&buf, outImg, &jpeg.Options{Quality: quality})
-		if err != nil {
-			return nil, err
-		}
-		return buf.Bytes(), nil
+		return encodeJPEG(outImg, quality)
 	}
 }
 
@@ -229,18 +306,13 @@ func AlphaHandler(opacity float64, quality int) func([]byte) ([]byte, error) {
 		quality = 85
 	}
 	return func(in []byte) ([]byte, error) {
-		src, _, err := image.Decode(bytes.NewReader(in))
+		src, _, err := decode.Decode(in)
 		if err != nil {
 			return nil, err
 		}
 		outImg := ScaleAlpha(src, opacity)
 
-		var buf bytes.Buffer
-		err = jpeg.Encode(&buf, outImg, &jpeg.Options{Quality: quality})
-		if err != nil {
-			return nil, err
-		}
-		return buf.Bytes(), nil
+		return encodeJPEG(outImg, quality)
 	}
 }
 // update 21
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/adjust"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+func TestAdjust_Apply(t *testing.T) {
+	px := func(c color.Color, opt adjust.Options) color.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		img.Set(0, 0, c)
+		return adjust.Apply(img, opt).NRGBAAt(0, 0)
+	}
+	grey := color.NRGBA{R: 128, G: 128, B: 128, A: 255}
+	red := color.NRGBA{R: 200, G: 40, B: 40, A: 255}
+
+	if got := px(red, adjust.Options{}); got != red {
+		t.Fatalf("zero options changed %v to %v", red, got)
+	}
+	if got := px(grey, adjust.Options{Brightness: 0.2}); got.R <= 170 || got.R >= 185 {
+		t.Fatalf("brightness: got %v", got)
+	}
+	if got := px(grey, adjust.Options{Exposure: 1}); got.R < 170 || got.R > 180 {
+		t.Fatalf("exposure +1 of mid-grey should be ~175, got %v", got)
+	}
+	if got := px(color.NRGBA{R: 100, A: 255}, adjust.Options{Contrast: -1}); got.R != 128 || got.G != 128 {
+		t.Fatalf("contrast -1 should flatten to mid-grey, got %v", got)
+	}
+	if got := px(grey, adjust.Options{Gamma: 2}); got.R <= 128 {
+		t.Fatalf("gamma 2 should brighten midtones, got %v", got)
+	}
+	if got := px(red, adjust.Options{Saturation: -1}); got.R != got.G || got.G != got.B {
+		t.Fatalf("saturation -1 should give grey, got %v", got)
+	}
+	if got := px(red, adjust.Options{Hue: 180}); got.R >= got.G || got.R >= got.B {
+		t.Fatalf("hue 180 of red should be cyan-ish, got %v", got)
+	}
+	if got := px(red, adjust.Options{Hue: 360}); got != red {
+		t.Fatalf("hue 360 should be identity, got %v", got)
+	}
+	// vibrance boosts a dull colour more than a vivid one
+	dull := color.NRGBA{R: 140, G: 120, B: 120, A: 255}
+	d, v := px(dull, adjust.Options{Vibrance: 1}), px(red, adjust.Options{Vibrance: 1})
+	spread := func(c color.NRGBA) float64 { return float64(int(c.R) - int(c.G)) }
+	if spread(d)/spread(dull) <= spread(v)/spread(red) || spread(v) <= spread(red) {
+		t.Fatalf("vibrance: dull %v -> %v, vivid %v -> %v", dull, d, red, v)
+	}
+}
+
+// Any pixel format decodes; PNG keeps its transparency.
+func TestAdjust_Formats(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range gray.Pix {
+		gray.Pix[i] = 100
+	}
+	pal := image.NewPaletted(image.Rect(0, 0, 16, 16), color.Palette{color.Transparent, color.NRGBA{R: 255, A: 255}})
+	pal.Pix[0] = 1
+
+	for name, img := range map[string]image.Image{"gray": gray, "paletted": pal} {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatalf("%s: png: %v", name, err)
+		}
+		out, err := adjust.Adjust(buf.Bytes(), adjust.Options{Brightness: 0.1})
+		if err != nil {
+			t.Fatalf("%s: adjust: %v", name, err)
+		}
+		dec, format := tests.AssertDecodable(t, out)
+		if format != "png" {
+			t.Fatalf("%s: expected png output, got %s", name, format)
+		}
+		if name == "paletted" {
+			if _, _, _, a := dec.At(5, 5).RGBA(); a != 0 {
+				t.Fatalf("transparent pixel became opaque")
+			}
+		}
+	}
+
+	// as a pipeline stage on JPEG input
+	in := tests.ToJPEGBytes(t, tests.Gradient(64, 64), 90)
+	out, err := imageops.NewPipeline().
+		Add(adjust.Handler(adjust.Options{Contrast: 0.3, Saturation: 0.2, Quality: 90})).
+		Run(in)
+	if err != nil {
+		t.Fatalf("pipeline: %v", err)
+	}
+	if _, format := tests.AssertDecodable(t, out); format != "jpeg" {
+		t.Fatalf("expected jpeg output, got %s", format)
+	}
+
+	// the zero Quality encodes at 85
+	def, err := adjust.Handler(adjust.Options{Contrast: 0.3})(in)
+	if err != nil {
+		t.Fatalf("default quality: %v", err)
+	}
+	q85, _ := adjust.Handler(adjust.Options{Contrast: 0.3, Quality: 85})(in)
+	if !bytes.Equal(def, q85) {
+		t.Errorf("Quality 0 did not encode at 85")
+	}
+}
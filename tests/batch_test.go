@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/batch"
+	"github.com/HumbleLines/imgpipe/pkg/cli"
+	"github.com/HumbleLines/imgpipe/pkg/grade"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// batchTree lays out an input directory:
+//
+//	in/a.jpg  in/sub/b.jpg  in/sub/c.jpg  in/sub/notes.txt  in/.cache/d.jpg  in/broken.jpg
+func batchTree(t *testing.T) (dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	jpg := tests.ToJPEGBytes(t, tests.Gradient(64, 48), 95)
+	for name, b := range map[string][]byte{
+		"in/a.jpg":         jpg,
+		"in/sub/b.jpg":     jpg,
+		"in/sub/c.jpg":     jpg,
+		"in/sub/notes.txt": []byte("skip me"),
+		"in/.cache/d.jpg":  jpg,
+		"in/broken.jpg":    []byte("not an image"),
+	} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBatch_Run(t *testing.T) {
+	dir := batchTree(t)
+	opt := batch.Options{
+		Inputs:  []string{filepath.Join(dir, "in")},
+		Output:  filepath.Join(dir, "in", "out", "{path}_gray.{ext}"),
+		Handler: grade.Handler(grade.Options{Kind: grade.Grayscale, Quality: 60}),
+		Workers: 3,
+	}
+	sum, err := batch.Run(context.Background(), opt)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if sum.Total != 4 || sum.Succeeded != 3 || sum.Failed != 1 || len(sum.Failures) != 1 ||
+		!strings.HasSuffix(sum.Failures[0].Input, "broken.jpg") {
+		t.Fatalf("unexpected summary %+v", sum)
+	}
+	if sum.BytesSaved != sum.BytesIn-sum.BytesOut || sum.BytesSaved <= 0 {
+		t.Fatalf("bytes: in %d out %d saved %d", sum.BytesIn, sum.BytesOut, sum.BytesSaved)
+	}
+	tests.AssertDecodable(t, tests.MustRead(t, filepath.Join(dir, "in", "out", "sub", "b_gray.jpg")))
+
+	// outputs are up to date now, and the output tree is not taken as input
+	sum, err = batch.Run(context.Background(), opt)
+	if err != nil || sum.Total != 4 || sum.Skipped != 3 || sum.Failed != 1 {
+		t.Fatalf("rerun: %v %+v", err, sum)
+	}
+	opt.Force = true
+	if sum, _ = batch.Run(context.Background(), opt); sum.Succeeded != 3 {
+		t.Fatalf("forced rerun: %+v", sum)
+	}
+
+	// globs pick files by extension, repeated inputs count once, and two
+	// inputs named a.jpg collide on {name}
+	if err := os.WriteFile(filepath.Join(dir, "in", "sub", "a.jpg"), tests.MustRead(t, filepath.Join(dir, "in", "a.jpg")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err = batch.Run(context.Background(), batch.Options{
+		Inputs:  []string{filepath.Join(dir, "in", "*.jpg"), filepath.Join(dir, "in", "sub", "*"), filepath.Join(dir, "in", "sub", "b.jpg")},
+		Output:  filepath.Join(dir, "flat", "{name}.jpg"),
+		Handler: grade.Handler(grade.Options{Kind: grade.Sepia}),
+	})
+	if err != nil || sum.Total != 5 || sum.Failed != 2 || !strings.Contains(fmt.Sprint(sum.Failures), "flat/a.jpg is also the output of") {
+		t.Fatalf("glob: %v %+v", err, sum)
+	}
+
+	if _, err := batch.ParseTemplate("out/{stem}.jpg"); err == nil {
+		t.Fatal("expected an unknown placeholder error")
+	}
+	if _, err := batch.ParseTemplate("out/all.jpg"); err == nil {
+		t.Fatal("expected an error for a template without {path} or {name}")
+	}
+}
+
+// Every failure is counted, but only the first MaxFailures are kept.
+func TestBatch_FailureCap(t *testing.T) {
+	dir := t.TempDir()
+	n := batch.MaxFailures + 5
+	for i := 0; i < n; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("bad%03d.jpg", i)), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum, err := batch.Run(context.Background(), batch.Options{
+		Inputs:  []string{dir},
+		Output:  filepath.Join(t.TempDir(), "{name}.png"),
+		Handler: grade.Handler(grade.Options{Kind: grade.Sepia}),
+	})
+	if err != nil || sum.Failed != n || len(sum.Failures) != batch.MaxFailures {
+		t.Fatalf("got %v, %d failed, %d kept", err, sum.Failed, len(sum.Failures))
+	}
+}
+
+func TestBatch_Resume(t *testing.T) {
+	dir := batchTree(t)
+	journal := filepath.Join(dir, "progress.jsonl")
+	ctx, cancel := context.WithCancel(context.Background())
+	opt := batch.Options{
+		Inputs:  []string{filepath.Join(dir, "in")},
+		Output:  filepath.Join(dir, "out", "{path}.jpg"),
+		Handler: grade.Handler(grade.Options{Kind: grade.Grayscale}),
+		Workers: 1,
+		Journal: journal,
+		Force:   true, // only the journal may skip files
+		OnResult: func(r batch.Result) {
+			if r.Status == batch.StatusOK {
+				cancel() // simulate a crash after the first file
+			}
+		},
+	}
+	sum, err := batch.Run(ctx, opt)
+	if !errors.Is(err, context.Canceled) || !sum.Interrupted || sum.Succeeded == 0 || sum.Total >= 4 {
+		t.Fatalf("interrupted run: %v %+v", err, sum)
+	}
+	done := sum.Succeeded
+
+	opt.OnResult = nil
+	sum, err = batch.Run(context.Background(), opt)
+	if err != nil || sum.Interrupted {
+		t.Fatalf("resumed run: %v %+v", err, sum)
+	}
+	if sum.Resumed != done || sum.Succeeded != 3-done || sum.Failed != 1 || sum.Total != 4 {
+		t.Fatalf("resumed run: %+v (first run finished %d)", sum, done)
+	}
+}
+
+func TestBatch_CLI(t *testing.T) {
+	dir := batchTree(t)
+	rec := filepath.Join(dir, "web.toml")
+	if err := os.WriteFile(rec, []byte("[[web]]\nop = \"resize\"\nwidth = 32\nheight = 32\nmode = \"fill\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, out, stderr := runCLI(nil, "batch", "-f", rec, "-o", filepath.Join(dir, "out", "{path}.jpg"), "-j", "2", filepath.Join(dir, "in"))
+	if code != cli.ExitError || !strings.Contains(stderr, "1 of 4 files failed") {
+		t.Fatalf("batch: exit %d: %s", code, stderr)
+	}
+	var sum batch.Summary
+	if err := json.Unmarshal(out, &sum); err != nil {
+		t.Fatalf("summary: %v\n%s", err, out)
+	}
+	if sum.Succeeded != 3 || sum.Failed != 1 {
+		t.Fatalf("summary: %+v", sum)
+	}
+	if w, h := tests.ImgWH(t, tests.MustRead(t, filepath.Join(dir, "out", "a.jpg"))); w != 32 || h != 32 {
+		t.Fatalf("output: %dx%d", w, h)
+	}
+	if code, _, _ := runCLI(nil, "batch", "-f", rec, "-o", "out/{nope}.jpg", dir); code != cli.ExitUsage {
+		t.Fatalf("bad template: exit %d", code)
+	}
+}
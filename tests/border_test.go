@@ -1,10 +1,13 @@
 package tests
 
 import (
+	"errors"
 	"image/color"
 	"testing"
 
 	"github.com/HumbleLines/imgpipe/pkg/border"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
 	tests "github.com/HumbleLines/imgpipe/tests/utils"
 )
 
@@ -25,5 +28,112 @@ func TestBorder_Outline(t *testing.T) {
 
 	tests.AssertDecodable(t, out)
 }
+
+// Huge shadows and radii are rejected in strict mode and clamped otherwise,
+// so they cannot blow up the canvas.
+func TestBorder_Limits(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(20, 20), 90)
+	strict := validate.Policy{Strict: true}
+	for field, opt := range map[string]border.Options{
+		"Shadow.Blur": {Shadow: &border.Shadow{Blur: 1000000}},
+		"Shadow":      {Shadow: &border.Shadow{OffsetY: -1000000}},
+		"Radius":      {Radius: 1000000},
+		"Thickness":   {Thickness: 1 << 40},
+	} {
+		opt.Mode, opt.Thickness, opt.Policy = border.Outset, max(opt.Thickness, 1), strict
+		_, err := border.Border(in, opt)
+		var oe *imgerr.OptionError
+		if !errors.As(err, &oe) || oe.Field != field {
+			t.Errorf("%s: %v", field, err)
+		}
+	}
+
+	var warnings []string
+	out, err := border.Border(in, border.Options{
+		Mode: border.Outset, Thickness: 1, Radius: 1000000,
+		Shadow: &border.Shadow{Blur: 1000000, Color: color.RGBA{A: 255}},
+		Policy: capture(&warnings),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 22px card plus 3x the largest blur step on each side
+	if w, h := tests.ImgWH(t, out); w != 22+6*128 || h != 22+6*128 || len(warnings) != 1 {
+		t.Errorf("clamped: %dx%d, warnings %q", w, h, warnings)
+	}
+	// each side fits the limits, the output does not
+	if _, err := border.Border(in, border.Options{Mode: border.Outset, Thickness: 10000, Quality: 80}); !errors.Is(err, imgerr.ErrImageTooLarge) {
+		t.Errorf("huge canvas: %v", err)
+	}
+}
+
+// Polaroid-style card: uneven sides, gradient fill, rounded corners and a
+// drop shadow. Transparent areas force PNG output.
+func TestBorder_Styles(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(200, 150), 92)
+
+	out, err := border.Border(in, border.Options{
+		Mode:  border.Outset,
+		Sides: border.Sides{Top: 10, Right: 10, Bottom: 40, Left: 10},
+		Gradient: &border.Gradient{
+			Kind: border.Linear,
+			From: color.RGBA{R: 255, A: 255},
+			To:   color.RGBA{B: 255, A: 255},
+		},
+		Radius: 12,
+		Shadow: &border.Shadow{OffsetX: 4, OffsetY: 6, Blur: 6, Color: color.RGBA{A: 128}},
+	})
+	if err != nil {
+		t.Fatalf("border: %v", err)
+	}
+	tests.MustWriteOut(t, "border_styles.png", out)
+
+	img, format := tests.AssertDecodable(t, out)
+	if format != "png" {
+		t.Fatalf("expected png output, got %s", format)
+	}
+	// card is 220x200; the shadow reaches 9px (3x blur step) around its
+	// offset copy, so the card sits at (5,3) on a 238x218 canvas
+	b := img.Bounds()
+	if b.Dx() != 238 || b.Dy() != 218 {
+		t.Fatalf("unexpected size %v", b)
+	}
+	if _, _, _, a := img.At(b.Min.X, b.Min.Y).RGBA(); a != 0 {
+		t.Fatalf("expected transparent corner, alpha %d", a>>8)
+	}
+	// left edge of the card is red, right edge blue
+	r, _, bl, _ := img.At(5+3, 3+100).RGBA()
+	if r>>8 < 200 || bl>>8 > 60 {
+		t.Fatalf("expected red near the left edge, got r=%d b=%d", r>>8, bl>>8)
+	}
+	r, _, bl, _ = img.At(5+216, 3+100).RGBA()
+	if bl>>8 < 200 || r>>8 > 60 {
+		t.Fatalf("expected blue near the right edge, got r=%d b=%d", r>>8, bl>>8)
+	}
+	// shadow below the card is translucent dark
+	if _, _, _, a := img.At(5+110, 3+200+3).RGBA(); a == 0 || a>>8 > 128 {
+		t.Fatalf("expected soft shadow, alpha %d", a>>8)
+	}
+}
+
+func TestBorder_ColorFrom(t *testing.T) {
+	in := tests.ToJPEGBytes(t, twoTone(), 95)
+
+	out, err := border.Border(in, border.Options{
+		Mode:      border.Outset,
+		Thickness: 10,
+		ColorFrom: border.ColorEdge,
+		Quality:   95,
+	})
+	if err != nil {
+		t.Fatalf("border: %v", err)
+	}
+	img, _ := tests.AssertDecodable(t, out)
+	r, g, b, _ := img.At(3, 3).RGBA()
+	if r>>8 < 200 || g>>8 > 50 || b>>8 > 50 {
+		t.Fatalf("expected red border from the image edge, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+}
+
 // update 44
 // update 45
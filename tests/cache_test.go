@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/adjust"
+	"github.com/HumbleLines/imgpipe/pkg/batch"
+	"github.com/HumbleLines/imgpipe/pkg/border"
+	"github.com/HumbleLines/imgpipe/pkg/cache"
+	"github.com/HumbleLines/imgpipe/pkg/compress"
+	"github.com/HumbleLines/imgpipe/pkg/convert"
+	"github.com/HumbleLines/imgpipe/pkg/crop"
+	"github.com/HumbleLines/imgpipe/pkg/filter"
+	"github.com/HumbleLines/imgpipe/pkg/grade"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/palette"
+	"github.com/HumbleLines/imgpipe/pkg/recipe"
+	"github.com/HumbleLines/imgpipe/pkg/redact"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/rotate"
+	"github.com/HumbleLines/imgpipe/pkg/server"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	"github.com/HumbleLines/imgpipe/pkg/variant"
+	"github.com/HumbleLines/imgpipe/pkg/watermark"
+)
+
+func TestCache_Memory(t *testing.T) {
+	m := cache.NewMemory(100)
+	val := bytes.Repeat([]byte("x"), 29) // 30 bytes with a one-byte key
+	for _, k := range []string{"a", "b", "c"} {
+		_ = m.Set(k, val)
+	}
+	if _, ok, _ := m.Get("a"); !ok { // a becomes the most recently used
+		t.Fatal("a missing")
+	}
+	_ = m.Set("d", val) // 120 > 100: evicts b, the least recently used
+	for k, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, ok, _ := m.Get(k); ok != want {
+			t.Errorf("%s present = %v, want %v", k, ok, want)
+		}
+	}
+	if n, size := m.Len(); n != 3 || size != 90 {
+		t.Errorf("Len = %d, %d", n, size)
+	}
+	_ = m.Set("huge", make([]byte, 200))
+	if _, ok, _ := m.Get("huge"); ok {
+		t.Error("value above the budget was stored")
+	}
+
+	// values are copies
+	got, _, _ := m.Get("a")
+	got[0] = 'y'
+	if again, _, _ := m.Get("a"); again[0] != 'x' {
+		t.Error("Get returned the stored slice")
+	}
+}
+
+func TestCache_Disk(t *testing.T) {
+	dir := t.TempDir()
+	d, err := cache.NewDisk(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val := bytes.Repeat([]byte("x"), 40)
+	_ = d.Set("a", val)
+	time.Sleep(10 * time.Millisecond)
+	_ = d.Set("b", val)
+	time.Sleep(10 * time.Millisecond)
+	if _, ok, _ := d.Get("a"); !ok {
+		t.Fatal("a missing")
+	}
+	_ = d.Set("c", val) // evicts b
+	if _, ok, _ := d.Get("b"); ok {
+		t.Error("b not evicted")
+	}
+	if n, size := d.Len(); n != 2 || size != 80 {
+		t.Errorf("Len = %d, %d", n, size)
+	}
+
+	// reopening indexes what is there, oldest use first
+	d, err = cache.NewDisk(dir, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := d.Len(); n != 1 {
+		t.Errorf("after reopening with a smaller budget: %d entries", n)
+	}
+	if got, ok, _ := d.Get("c"); !ok || !bytes.Equal(got, val) {
+		t.Error("c lost on reopen")
+	}
+	var files int
+	_ = filepath.WalkDir(dir, func(_ string, e os.DirEntry, _ error) error {
+		if !e.IsDir() {
+			files++
+		}
+		return nil
+	})
+	if files != 1 {
+		t.Errorf("%d files on disk", files)
+	}
+}
+
+func TestCache_SharedComputation(t *testing.T) {
+	c := cache.New(cache.NewMemory(1 << 20))
+	var runs atomic.Int32
+	release := make(chan struct{})
+	slow := func(in []byte) ([]byte, error) {
+		runs.Add(1)
+		<-release
+		return append([]byte("out:"), in...), nil
+	}
+	h, err := c.Pipeline(imageops.NewPipeline().Add(slow), map[string]any{"op": "slow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	outs := make([][]byte, 8)
+	for i := range outs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outs[i], _ = h([]byte("src"))
+		}()
+	}
+	for c.Stats().Shared < int64(len(outs)-1) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if n := runs.Load(); n != 1 {
+		t.Errorf("computed %d times", n)
+	}
+	for i, o := range outs {
+		if string(o) != "out:src" {
+			t.Errorf("call %d got %q", i, o)
+		}
+	}
+	// every caller, the one that computed included, owns its slice
+	for i, o := range outs {
+		o[0] = byte('0' + i)
+	}
+	for i, o := range outs {
+		if o[0] != byte('0'+i) {
+			t.Errorf("call %d shares its result", i)
+		}
+	}
+	if out, _ := h([]byte("src")); string(out) != "out:src" || c.Stats().Hits != 1 {
+		t.Errorf("second call: %q, %+v", out, c.Stats())
+	}
+	if out, _ := h([]byte("other")); string(out) != "out:other" || runs.Load() != 2 {
+		t.Errorf("other source: %q after %d runs", out, runs.Load())
+	}
+
+	// errors are returned, not cached
+	fails := 0
+	bad := func() ([]byte, error) { fails++; return nil, errors.New("boom") }
+	for i := 0; i < 2; i++ {
+		if _, err := c.Do("k", bad); err == nil {
+			t.Error("no error")
+		}
+	}
+	if fails != 2 {
+		t.Errorf("failing computation ran %d times", fails)
+	}
+}
+
+func TestCache_Keys(t *testing.T) {
+	src := []byte("image")
+	type opts struct {
+		Op    string `json:"op"`
+		Width int    `json:"width"`
+	}
+	k1, _ := cache.Key(src, opts{"resize", 90})
+	k2, _ := cache.Key(src, map[string]any{"width": 90.0, "op": "resize"})
+	k3, _ := cache.Key(src, opts{"resize", 91})
+	k4, _ := cache.Key([]byte("other"), opts{"resize", 90})
+	if k1 != k2 || k1 == k3 || k1 == k4 {
+		t.Errorf("keys: %s %s %s %s", k1, k2, k3, k4)
+	}
+
+	// the same recipe written in YAML and JSON, on different lines
+	y, err := recipe.Parse([]byte("thumb:\n\n  - op: resize\n    width: 90\n    height: 60\n"), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := recipe.Parse([]byte(`{"thumb": [{"height": 60, "op": "resize", "width": 90}]}`), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ky, _ := cache.Key(src, y["thumb"].Steps)
+	kj, _ := cache.Key(src, j["thumb"].Steps)
+	if ky != kj {
+		t.Error("equal recipes give different keys")
+	}
+	if _, err := cache.Key(src, func() {}); err == nil {
+		t.Error("unmarshalable options: no error")
+	}
+}
+
+// Every operation's options can be keyed, whatever their Policy.
+func TestCache_CanonicalOptions(t *testing.T) {
+	pol := validate.Policy{Strict: true, Warn: func(string) {}}
+	for name, opt := range map[string]any{
+		"adjust":    adjust.Options{Policy: pol},
+		"batch":     batch.Options{Handler: func(in []byte) ([]byte, error) { return in, nil }, OnResult: func(batch.Result) {}, Policy: pol},
+		"border":    border.Options{Policy: pol},
+		"compress":  compress.Options{},
+		"convert":   convert.Options{},
+		"crop":      crop.Options{Policy: pol},
+		"filter":    filter.Options{Policy: pol},
+		"grade":     grade.Options{Policy: pol},
+		"palette":   palette.Options{Policy: pol},
+		"redact":    redact.Options{Policy: pol},
+		"resize":    resize.Options{Policy: pol},
+		"rotate":    rotate.Options{Policy: pol},
+		"server":    server.Options{Policy: pol},
+		"variant":   variant.Options{Policy: pol},
+		"watermark": watermark.Spec{Policy: pol},
+	} {
+		if _, err := cache.Canonical(opt); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	a, _ := cache.Key([]byte("x"), resize.Options{Width: 10})
+	b, _ := cache.Key([]byte("x"), resize.Options{Width: 10, Policy: pol})
+	if a != b {
+		t.Error("the policy changes the key")
+	}
+}
+
+func TestCache_Server(t *testing.T) {
+	c := cache.New(cache.NewMemory(1 << 20))
+	ts, _ := newServer(t, server.Options{Cache: c})
+	var first []byte
+	for i := 0; i < 3; i++ {
+		res, body := get(t, ts.URL+"/resize?src=a.jpg&w=100&h=100")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("status %d: %s", res.StatusCode, body)
+		}
+		if i == 0 {
+			first = body
+		} else if !bytes.Equal(body, first) {
+			t.Error("cached response differs")
+		}
+	}
+	if st := c.Stats(); st.Misses != 1 || st.Hits != 2 {
+		t.Errorf("stats %+v", st)
+	}
+	_, _ = get(t, ts.URL+"/resize?src=a.jpg&w=100&h=100&q=50")
+	if st := c.Stats(); st.Misses != 2 {
+		t.Errorf("different quality served from cache: %+v", st)
+	}
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/cli"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// runCLI runs imgpipe in-process with stdin and returns exit code, stdout, stderr.
+func runCLI(stdin []byte, args ...string) (int, []byte, string) {
+	var out, errb bytes.Buffer
+	code := cli.Run(args, cli.Env{Stdin: bytes.NewReader(stdin), Stdout: &out, Stderr: &errb})
+	return code, out.Bytes(), errb.String()
+}
+
+func TestCLI_Commands(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(160, 120), 90)
+
+	// stdin -> stdout
+	code, out, stderr := runCLI(in, "resize", "-w", "40", "-h", "30", "-mode", "fill")
+	if code != cli.ExitOK {
+		t.Fatalf("resize: exit %d: %s", code, stderr)
+	}
+	if w, h := tests.ImgWH(t, out); w != 40 || h != 30 {
+		t.Fatalf("resize: got %dx%d", w, h)
+	}
+
+	// files, format picked from the output extension
+	dir := t.TempDir()
+	src := filepath.Join(dir, "in.jpg")
+	if err := os.WriteFile(src, in, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "out.png")
+	if code, _, stderr := runCLI(nil, "convert", src, dst); code != cli.ExitOK {
+		t.Fatalf("convert: exit %d: %s", code, stderr)
+	}
+	b, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if _, format := tests.AssertDecodable(t, b); format != "png" {
+		t.Fatalf("convert: got %s", format)
+	}
+
+	for _, args := range [][]string{
+		{"compress", "-q", "60"},
+		{"crop", "-ratio", "1:1"},
+		{"rotate", "-deg", "270"},
+		{"border", "-t", "5", "-color", "edge"},
+		{"watermark", "-text", "{width}x{height}", "-anchor", "top-left", "-blend", "difference"},
+	} {
+		code, out, stderr := runCLI(in, args...)
+		if code != cli.ExitOK {
+			t.Fatalf("%v: exit %d: %s", args, code, stderr)
+		}
+		tests.AssertDecodable(t, out)
+	}
+
+	code, out, stderr = runCLI(in, "info", "-json", "-palette", "3")
+	if code != cli.ExitOK {
+		t.Fatalf("info: exit %d: %s", code, stderr)
+	}
+	var info struct {
+		Format        string
+		Width, Height int
+		Palette       []map[string]any
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		t.Fatalf("info json: %v\n%s", err, out)
+	}
+	if info.Format != "jpeg" || info.Width != 160 || info.Height != 120 || len(info.Palette) == 0 {
+		t.Fatalf("info: unexpected %+v", info)
+	}
+}
+
+// info reads only the header, but still within the decode limits.
+func TestCLI_InfoLimits(t *testing.T) {
+	code, _, stderr := runCLI(bomb(t, 50000, 50000), "info")
+	if code != cli.ExitError || !strings.Contains(stderr, "image too large") {
+		t.Fatalf("bomb: exit %d: %s", code, stderr)
+	}
+	if code, _, _ := runCLI(tests.ToJPEGBytes(t, tests.Gradient(20, 20), 90), "info"); code != cli.ExitOK {
+		t.Fatalf("small image: exit %d", code)
+	}
+}
+
+func TestCLI_ExitCodes(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(32, 32), 90)
+	cases := []struct {
+		name  string
+		stdin []byte
+		args  []string
+		want  int
+	}{
+		{"no command", nil, nil, cli.ExitUsage},
+		{"unknown command", in, []string{"sharpen"}, cli.ExitUsage},
+		{"unknown flag", in, []string{"resize", "-nope"}, cli.ExitUsage},
+		{"bad value", in, []string{"resize", "-w", "10", "-h", "10", "-mode", "zoom"}, cli.ExitUsage},
+		{"missing size", in, []string{"resize"}, cli.ExitUsage},
+		{"convert to stdout needs -to", in, []string{"convert"}, cli.ExitUsage},
+		{"missing input", nil, []string{"compress", filepath.Join(t.TempDir(), "missing.jpg")}, cli.ExitIO},
+		{"not an image", []byte("hello"), []string{"rotate"}, cli.ExitError},
+		{"help", nil, []string{"help", "border"}, cli.ExitOK},
+	}
+	for _, c := range cases {
+		if code, _, stderr := runCLI(c.stdin, c.args...); code != c.want {
+			t.Errorf("%s: exit %d, want %d (%s)", c.name, code, c.want, stderr)
+		}
+	}
+}
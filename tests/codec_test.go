@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/utils/codec"
+)
+
+func TestCodec_Keys(t *testing.T) {
+	if _, err := codec.EncodeData([]byte("x"), 60, nil); !errors.Is(err, codec.ErrNoKey) {
+		t.Fatalf("encode without key: %v", err)
+	}
+	tok, err := codec.EncodeData([]byte("payload"), 60, []byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rotation: data signed with a retired key still decodes while listed
+	got, err := codec.DecodeData(tok, []byte("new"), []byte("old"))
+	if err != nil || string(got) != "payload" {
+		t.Fatalf("decode: %q, %v", got, err)
+	}
+	if _, err := codec.DecodeData(tok, []byte("new")); !errors.Is(err, codec.ErrSignature) {
+		t.Errorf("decode with the wrong key: %v", err)
+	}
+	if _, err := codec.DecodeData("short", []byte("old")); !errors.Is(err, codec.ErrMalformed) {
+		t.Errorf("decode garbage: %v", err)
+	}
+	expired, _ := codec.EncodeData([]byte("payload"), -10, []byte("old"))
+	if _, err := codec.DecodeData(expired, []byte("old")); !errors.Is(err, codec.ErrExpired) {
+		t.Errorf("decode expired: %v", err)
+	}
+	// the former built-in key is not accepted implicitly
+	if _, err := codec.DecodeData(tok, nil); !errors.Is(err, codec.ErrNoKey) {
+		t.Errorf("decode without a key: %v", err)
+	}
+	if _, err := codec.DecodeData(tok, []byte{}, []byte("old")); !errors.Is(err, codec.ErrNoKey) {
+		t.Errorf("decode with an empty key: %v", err)
+	}
+}
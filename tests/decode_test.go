@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/decode"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/variant"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// pngChunk renders one PNG chunk with its CRC.
+func pngChunk(typ string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(b, typ...)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(append([]byte(typ), data...)))
+}
+
+// bomb is a valid small PNG whose header claims w x h.
+func bomb(t *testing.T, w, h uint32) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, tests.Gradient(8, 8)); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	ihdr := append([]byte(nil), b[16:29]...) // after signature, length and type
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	out := append([]byte(nil), b[:8]...)
+	out = append(out, pngChunk("IHDR", ihdr)...)
+	return append(out, b[33:]...)
+}
+
+func TestDecode_Limits(t *testing.T) {
+	l := decode.Limits{MaxBytes: 1 << 20, MaxWidth: 1000, MaxHeight: 800, MaxPixels: 500_000, MaxFrames: 3}
+	small := tests.ToJPEGBytes(t, tests.Gradient(40, 30), 90)
+
+	if img, format, err := decode.DecodeWith(small, l); err != nil || format != "jpeg" || img.Bounds().Dx() != 40 {
+		t.Fatalf("small image: %v", err)
+	}
+
+	var anim bytes.Buffer
+	g := &gif.GIF{}
+	for i := 0; i < 5; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9))
+		g.Delay = append(g.Delay, 10)
+	}
+	if err := gif.EncodeAll(&anim, g); err != nil {
+		t.Fatal(err)
+	}
+	if n := decode.Frames(anim.Bytes(), 0); n != 5 {
+		t.Errorf("gif frames = %d", n)
+	}
+
+	// an APNG announcing 10 frames; acTL precedes the image data
+	plain := bomb(t, 8, 8)
+	actl := binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 10), 0)
+	apng := append(append(append([]byte(nil), plain[:33]...), pngChunk("acTL", actl)...), plain[33:]...)
+
+	cases := []struct {
+		name  string
+		in    []byte
+		limit string
+	}{
+		{"bytes", make([]byte, 1<<20+1), "bytes"},
+		{"width", bomb(t, 1001, 10), "width"},
+		{"height", bomb(t, 10, 801), "height"},
+		{"pixels", bomb(t, 1000, 501), "pixels"},
+		{"gif frames", anim.Bytes(), "frames"},
+		{"apng frames", apng, "frames"},
+	}
+	for _, c := range cases {
+		_, _, err := decode.DecodeWith(c.in, l)
+		var le *decode.LimitError
+		if !errors.Is(err, decode.ErrImageTooLarge) || !errors.As(err, &le) || le.Limit != c.limit {
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+
+	if _, _, err := decode.DecodeWith([]byte("not an image"), l); !errors.Is(err, decode.ErrDecode) {
+		t.Errorf("garbage: %v", err)
+	}
+	if _, _, err := decode.DecodeWith(bomb(t, 1000, 500), decode.Limits{}); errors.Is(err, decode.ErrImageTooLarge) {
+		t.Errorf("zero limits limited: %v", err)
+	}
+}
+
+func TestDecode_Operations(t *testing.T) {
+	old := decode.CurrentLimits()
+	t.Cleanup(func() { decode.SetLimits(old) })
+
+	// the default limits already stop a 50000x50000 PNG of a few hundred bytes
+	b := bomb(t, 50000, 50000)
+	if _, err := resize.Resize(b, resize.Options{Mode: resize.ModeFit, Width: 10, Height: 10, Quality: 80}); !errors.Is(err, decode.ErrImageTooLarge) {
+		t.Errorf("resize: %v", err)
+	}
+
+	decode.SetLimits(decode.Limits{MaxPixels: 100})
+	in := tests.ToJPEGBytes(t, tests.Gradient(20, 20), 90)
+	_, err := variant.Generate(in, variant.Options{Variants: []variant.Variant{{Name: "x"}}})
+	if !errors.Is(err, decode.ErrImageTooLarge) {
+		t.Errorf("variant: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/filter"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/recipe"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/watermark"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+func TestErrors_Classes(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(20, 20), 90)
+
+	_, err := filter.Filter([]byte("not an image"), filter.Options{Kind: filter.Gaussian})
+	var oe *imgerr.OpError
+	if !errors.Is(err, imgerr.ErrUnsupportedFormat) || !errors.Is(err, imgerr.ErrDecode) ||
+		!errors.As(err, &oe) || oe.Op != "filter" || oe.Step != 0 {
+		t.Errorf("garbage: %v", err)
+	}
+	if s := imgerr.HTTPStatus(err); s != http.StatusUnsupportedMediaType {
+		t.Errorf("garbage: status %d", s)
+	}
+
+	_, err = resize.Resize(bomb(t, 50000, 50000), resize.Options{Mode: resize.ModeFit, Width: 10, Height: 10, Quality: 80})
+	if !errors.Is(err, imgerr.ErrImageTooLarge) || !errors.As(err, &oe) || oe.Op != "resize" {
+		t.Errorf("bomb: %v", err)
+	}
+	if s := imgerr.HTTPStatus(err); s != http.StatusRequestEntityTooLarge {
+		t.Errorf("bomb: status %d", s)
+	}
+
+	_, err = filter.Filter(in, filter.Options{Kind: filter.Custom})
+	var opt *imgerr.OptionError
+	if !errors.Is(err, imgerr.ErrInvalidOptions) || !errors.As(err, &opt) || opt.Field != "Kernel" {
+		t.Errorf("no kernel: %v", err)
+	}
+	if err == nil || err.Error() != "filter: Kernel: custom filter needs a kernel" {
+		t.Errorf("no kernel message: %v", err)
+	}
+	if s := imgerr.HTTPStatus(err); s != http.StatusBadRequest {
+		t.Errorf("no kernel: status %d", s)
+	}
+
+	_, err = watermark.Watermark(in, watermark.Spec{Layers: []watermark.Layer{{Text: "{width:px}"}}})
+	if !errors.As(err, &opt) || opt.Field != "Text" || !errors.As(err, &oe) || oe.Op != "watermark" {
+		t.Errorf("template: %v", err)
+	}
+
+	enc := imgerr.Encode(errors.New("short write"))
+	if !errors.Is(enc, imgerr.ErrEncode) || imgerr.HTTPStatus(enc) != http.StatusInternalServerError {
+		t.Errorf("encode: %v", enc)
+	}
+	if imgerr.Encode(nil) != nil || imgerr.Wrap("x", nil) != nil {
+		t.Error("nil errors are wrapped")
+	}
+}
+
+func TestErrors_PipelineStep(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(20, 20), 90)
+	_, err := imageops.NewPipeline().
+		Add(filter.Handler(filter.Options{Kind: filter.Gaussian, Quality: 90})).
+		Add(filter.Handler(filter.Options{Kind: filter.Kind(99), Quality: 90})).
+		Run(in)
+	var oe *imgerr.OpError
+	if !errors.As(err, &oe) || oe.Step != 2 || oe.Op != "filter" {
+		t.Fatalf("pipeline: %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "step 2: filter: Kind: ") || !errors.Is(err, imgerr.ErrInvalidOptions) {
+		t.Errorf("pipeline: %v", err)
+	}
+
+	// handlers that wrap the error, or return one without an operation,
+	// still get their step
+	wrapping := func(in []byte) ([]byte, error) {
+		_, err := filter.Filter(in, filter.Options{Kind: filter.Kind(99)})
+		return nil, fmt.Errorf("retouch: %w", err)
+	}
+	plain := func(in []byte) ([]byte, error) { return nil, errors.New("quota exceeded") }
+	keep := func(in []byte) ([]byte, error) { return in, nil }
+	for i, h := range []imageops.Handler{wrapping, plain} {
+		_, err := imageops.NewPipeline().Add(keep).Add(h).Run(in)
+		if !errors.As(err, &oe) || oe.Step != 2 || !strings.Contains(err.Error(), "step 2: ") {
+			t.Errorf("handler %d: %v", i, err)
+		}
+	}
+
+	// wrapping does not hide the class
+	wrapped := fmt.Errorf("job 7: %w", err)
+	if imgerr.HTTPStatus(wrapped) != http.StatusBadRequest {
+		t.Errorf("wrapped: %v", wrapped)
+	}
+}
+
+func TestErrors_Recipe(t *testing.T) {
+	book, err := recipe.Parse([]byte(`
+a:
+  - op: resize
+    width: 0
+    height: 10
+b:
+  - op: convert
+    format: webp
+c:
+  - op: sharpen-more
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, class := range map[string]error{
+		"a": imgerr.ErrInvalidOptions,
+		"b": imgerr.ErrUnsupportedFormat,
+		"c": imgerr.ErrInvalidOptions,
+	} {
+		_, err := book[name].Compile()
+		var se *recipe.StepError
+		if !errors.Is(err, class) || !errors.As(err, &se) || se.Step != 1 {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/filter"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// step is black on the left half and white on the right.
+func step(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(w/2, 0, w, h), image.NewUniform(color.White), image.Point{}, draw.Src)
+	return img
+}
+
+func TestFilter_Blur(t *testing.T) {
+	dot := image.NewRGBA(image.Rect(0, 0, 21, 21))
+	draw.Draw(dot, dot.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	dot.SetRGBA(10, 10, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+
+	g := filter.GaussianBlur(dot, 1.5)
+	c, n := g.RGBAAt(10, 10).R, g.RGBAAt(11, 10).R
+	if c == 255 || c <= n || n == 0 {
+		t.Fatalf("gaussian should spread the dot: centre %d, neighbour %d", c, n)
+	}
+	if g.RGBAAt(9, 10) != g.RGBAAt(11, 10) || g.RGBAAt(10, 9) != g.RGBAAt(10, 11) {
+		t.Fatalf("gaussian is not symmetric")
+	}
+
+	b := filter.BoxBlur(step(20, 4), 1)
+	// the 3-wide box straddling the edge sees one or two white pixels
+	if v := b.RGBAAt(9, 2).R; v < 80 || v > 90 {
+		t.Fatalf("box blur left of edge: %d, want ~85", v)
+	}
+	if v := b.RGBAAt(10, 2).R; v < 165 || v > 175 {
+		t.Fatalf("box blur right of edge: %d, want ~170", v)
+	}
+}
+
+func TestFilter_Sharpen(t *testing.T) {
+	soft := filter.GaussianBlur(step(40, 4), 2)
+
+	sharp := filter.UnsharpMask(soft, 2, 1.5, 0)
+	if a, b := sharp.RGBAAt(18, 2).R, soft.RGBAAt(18, 2).R; a >= b {
+		t.Fatalf("unsharp mask should darken the dark side of the edge: %d >= %d", a, b)
+	}
+	if a, b := sharp.RGBAAt(21, 2).R, soft.RGBAAt(21, 2).R; a <= b {
+		t.Fatalf("unsharp mask should brighten the bright side of the edge: %d <= %d", a, b)
+	}
+	// with a huge threshold nothing changes
+	if same := filter.UnsharpMask(soft, 2, 1.5, 255); same.RGBAAt(18, 2) != soft.RGBAAt(18, 2) {
+		t.Fatalf("threshold should suppress sharpening")
+	}
+
+	k, err := filter.Apply(soft, filter.Options{Kind: filter.Sharpen})
+	if err != nil {
+		t.Fatalf("sharpen: %v", err)
+	}
+	if k.RGBAAt(21, 2).R <= soft.RGBAAt(21, 2).R {
+		t.Fatalf("sharpen kernel did not increase edge contrast")
+	}
+}
+
+func TestFilter_EdgesAndKernels(t *testing.T) {
+	e := filter.Sobel(step(20, 10))
+	if e.RGBAAt(3, 5).R != 0 || e.RGBAAt(16, 5).R != 0 {
+		t.Fatalf("flat areas should have no edges")
+	}
+	if e.RGBAAt(10, 5).R != 255 {
+		t.Fatalf("vertical edge should be bright, got %d", e.RGBAAt(10, 5).R)
+	}
+
+	src := tests.Gradient(30, 20)
+	id, err := filter.Apply(src, filter.Options{Kind: filter.Custom, Kernel: &filter.Kernel{
+		Width: 3, Height: 3, Weights: []float64{0, 0, 0, 0, 1, 0, 0, 0, 0},
+	}})
+	if err != nil {
+		t.Fatalf("custom: %v", err)
+	}
+	if id.RGBAAt(7, 7) != src.RGBAAt(7, 7) {
+		t.Fatalf("identity kernel changed the image")
+	}
+	if _, err := filter.Apply(src, filter.Options{Kind: filter.Custom, Kernel: &filter.Kernel{Width: 2, Height: 2, Weights: []float64{1, 1, 1, 1}}}); err == nil {
+		t.Fatalf("expected error for even kernel")
+	}
+
+	in := tests.ToJPEGBytes(t, src, 90)
+	out, err := imageops.NewPipeline().
+		Add(filter.Handler(filter.Options{Kind: filter.Unsharp, Radius: 1, Amount: 0.8, Threshold: 3, Quality: 90})).
+		Run(in)
+	if err != nil {
+		t.Fatalf("pipeline: %v", err)
+	}
+	tests.AssertDecodable(t, out)
+
+	// the zero Quality encodes at 85
+	def, err := filter.Handler(filter.Options{Kind: filter.Sharpen})(in)
+	if err != nil {
+		t.Fatalf("default quality: %v", err)
+	}
+	q85, _ := filter.Handler(filter.Options{Kind: filter.Sharpen, Quality: 85})(in)
+	if !bytes.Equal(def, q85) {
+		t.Errorf("Quality 0 did not encode at 85")
+	}
+}
+
+// Huge, infinite and NaN radii are rejected by Validate and clamped by
+// Apply instead of sizing a kernel from them.
+func TestFilter_RadiusLimit(t *testing.T) {
+	for _, r := range []float64{1e12, math.Inf(1), math.NaN(), -1} {
+		if err := (filter.Options{Kind: filter.Gaussian, Radius: r}).Validate(); !errors.Is(err, imgerr.ErrInvalidOptions) {
+			t.Errorf("radius %g: %v", r, err)
+		}
+		for _, k := range []filter.Kind{filter.Gaussian, filter.Box, filter.Unsharp} {
+			out, err := filter.Apply(step(8, 8), filter.Options{Kind: k, Radius: r})
+			if err != nil || out.Bounds() != image.Rect(0, 0, 8, 8) {
+				t.Errorf("kind %d, radius %g: %v", k, r, err)
+			}
+		}
+	}
+	if out := filter.BoxBlur(step(8, 8), math.MaxInt); out.Bounds().Dx() != 8 {
+		t.Errorf("box blur: %v", out.Bounds())
+	}
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/grade"
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// cube writes a size^3 .cube table mapping each lattice colour through fn.
+func cube(size int, fn func(r, g, b float64) (float64, float64, float64)) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# generated\nTITLE \"test\"\nLUT_3D_SIZE %d\n", size)
+	n := float64(size - 1)
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				x, y, z := fn(float64(r)/n, float64(g)/n, float64(b)/n)
+				fmt.Fprintf(&sb, "%.6f %.6f %.6f\n", x, y, z)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func TestGrade_Looks(t *testing.T) {
+	px := func(c color.NRGBA, opt grade.Options) color.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+		img.SetNRGBA(0, 0, c)
+		out, err := grade.Apply(img, opt)
+		if err != nil {
+			t.Fatalf("apply: %v", err)
+		}
+		return out.NRGBAAt(0, 0)
+	}
+	green := color.NRGBA{G: 255, A: 255}
+
+	if g := px(green, grade.Options{Kind: grade.Grayscale}); g.R != g.G || g.G != g.B || g.R < 180 || g.R > 184 {
+		t.Fatalf("grayscale of pure green should be ~182 (Rec. 709), got %v", g)
+	}
+	if s := px(color.NRGBA{R: 128, G: 128, B: 128, A: 255}, grade.Options{Kind: grade.Sepia}); s.R <= s.G || s.G <= s.B {
+		t.Fatalf("sepia should be warm, got %v", s)
+	}
+	duo := grade.Options{Kind: grade.Duotone, Shadow: color.RGBA{B: 128, A: 255}, Highlight: color.RGBA{R: 255, G: 200, A: 255}}
+	if d := px(color.NRGBA{A: 255}, duo); d != (color.NRGBA{B: 128, A: 255}) {
+		t.Fatalf("duotone black should map to the shadow colour, got %v", d)
+	}
+	if d := px(color.NRGBA{R: 255, G: 255, B: 255, A: 255}, duo); d != (color.NRGBA{R: 255, G: 200, A: 255}) {
+		t.Fatalf("duotone white should map to the highlight colour, got %v", d)
+	}
+	if th := px(color.NRGBA{R: 140, G: 140, B: 140, A: 255}, grade.Options{Kind: grade.Threshold}); th.R != 255 {
+		t.Fatalf("threshold: got %v", th)
+	}
+	if th := px(color.NRGBA{R: 100, G: 100, B: 100, A: 255}, grade.Options{Kind: grade.Threshold}); th.R != 0 {
+		t.Fatalf("threshold: got %v", th)
+	}
+	if half := px(green, grade.Options{Kind: grade.Threshold, Level: 0.9, Amount: 0.5}); half.G != 128 {
+		t.Fatalf("amount 0.5 should mix halfway, got %v", half)
+	}
+
+	// the zero Quality encodes at 85
+	in := tests.ToJPEGBytes(t, tests.Gradient(32, 32), 90)
+	def, err := grade.Handler(grade.Options{Kind: grade.Sepia})(in)
+	if err != nil {
+		t.Fatalf("default quality: %v", err)
+	}
+	q85, _ := grade.Handler(grade.Options{Kind: grade.Sepia, Quality: 85})(in)
+	if !bytes.Equal(def, q85) {
+		t.Errorf("Quality 0 did not encode at 85")
+	}
+}
+
+func TestGrade_Cube(t *testing.T) {
+	invert, err := grade.ParseCube(strings.NewReader(cube(2, func(r, g, b float64) (float64, float64, float64) {
+		return 1 - r, 1 - g, 1 - b
+	})))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := invert.Lookup([3]float64{0.25, 0.5, 1}); abs(got[0]-0.75) > 1e-6 || abs(got[1]-0.5) > 1e-6 || abs(got[2]) > 1e-6 {
+		t.Fatalf("trilinear invert: got %v", got)
+	}
+
+	// a non-linear table is interpolated between lattice points
+	path := filepath.Join(t.TempDir(), "square.cube")
+	sq := cube(17, func(r, g, b float64) (float64, float64, float64) { return r * r, g * g, b * b })
+	if err := os.WriteFile(path, []byte(sq), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	c, err := grade.LoadCube(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := c.Lookup([3]float64{0.5, 0.3, 0.9}); abs(got[0]-0.25) > 0.002 || abs(got[1]-0.09) > 0.002 || abs(got[2]-0.81) > 0.002 {
+		t.Fatalf("square lut: got %v", got)
+	}
+
+	oneD, err := grade.ParseCube(strings.NewReader("LUT_1D_SIZE 2\n1 0 0\n0 1 1\n"))
+	if err != nil {
+		t.Fatalf("parse 1d: %v", err)
+	}
+	if got := oneD.Lookup([3]float64{0, 0.5, 1}); got != [3]float64{1, 0.5, 1} {
+		t.Fatalf("1d lut: got %v", got)
+	}
+
+	for _, bad := range []string{
+		"LUT_3D_SIZE 2\n0 0 0\n", // too few entries
+		"0 0 0\n1 1 1\n",         // no size
+		"LUT_3D_SIZE 2\n0 0 x\n", // not a number
+		"LUT_1D_SIZE 1\n0 0 0\n", // size too small
+	} {
+		if _, err := grade.ParseCube(strings.NewReader(bad)); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+
+	in := tests.ToJPEGBytes(t, tests.Gradient(64, 64), 90)
+	out, err := imageops.NewPipeline().
+		Add(grade.Handler(grade.Options{Kind: grade.LUT, Cube: c, Quality: 90})).
+		Add(grade.Handler(grade.Options{Kind: grade.Sepia, Amount: 0.3, Quality: 90})).
+		Run(in)
+	if err != nil {
+		t.Fatalf("pipeline: %v", err)
+	}
+	tests.AssertDecodable(t, out)
+	if _, err := grade.Grade(in, grade.Options{Kind: grade.LUT}); err == nil {
+		t.Fatalf("expected error for LUT without a cube")
+	}
+	// hand-built tables are checked before any lookup
+	for _, bad := range []*grade.Cube{
+		{Size: 1, Is3D: true, DomainMax: [3]float64{1, 1, 1}, Data: make([][3]float64, 1)},
+		{Size: 2, Is3D: true, DomainMax: [3]float64{1, 1, 1}, Data: make([][3]float64, 7)},
+		{Size: 2, Data: make([][3]float64, 2)}, // zero domain
+	} {
+		_, err := grade.Grade(in, grade.Options{Kind: grade.LUT, Cube: bad})
+		var oe *imgerr.OptionError
+		if !errors.As(err, &oe) || oe.Field != "Cube" {
+			t.Errorf("cube %+v: %v", bad, err)
+		}
+	}
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/palette"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// twoTone is 75% red with a blue block in the middle.
+func twoTone() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 220, G: 30, B: 30, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(50, 25, 150, 75), image.NewUniform(color.RGBA{R: 20, G: 40, B: 200, A: 255}), image.Point{}, draw.Src)
+	return img
+}
+
+func near(a, b color.RGBA, tol int) bool {
+	d := func(x, y uint8) bool { return int(x)-int(y) <= tol && int(y)-int(x) <= tol }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B)
+}
+
+func TestPalette_Extract(t *testing.T) {
+	img := twoTone()
+	sw := palette.Extract(img, 4)
+	if len(sw) != 2 {
+		t.Fatalf("expected 2 swatches for a two-colour image, got %d", len(sw))
+	}
+	if !near(sw[0].Color, color.RGBA{R: 220, G: 30, B: 30}, 2) || sw[0].Share < 0.74 || sw[0].Share > 0.76 {
+		t.Fatalf("unexpected main swatch %+v", sw[0])
+	}
+	if !near(sw[1].Color, color.RGBA{R: 20, G: 40, B: 200}, 2) {
+		t.Fatalf("unexpected second swatch %+v", sw[1])
+	}
+
+	if c := palette.Dominant(img); !near(c, sw[0].Color, 0) {
+		t.Fatalf("dominant %v, want %v", c, sw[0].Color)
+	}
+	if c := palette.EdgeAverage(img, 0); !near(c, color.RGBA{R: 220, G: 30, B: 30}, 2) {
+		t.Fatalf("edge average %v", c)
+	}
+	// the accent of a red/blue image is the complement of the more colourful blue
+	if c := palette.Accent(img); c.B > c.R || c.B > c.G {
+		t.Fatalf("accent %v is not opposite to blue", c)
+	}
+}
+
+func TestPalette_KMeans(t *testing.T) {
+	in := tests.ToJPEGBytes(t, twoTone(), 95)
+
+	sw, err := palette.Palette(in, palette.Options{Count: 4})
+	if err != nil {
+		t.Fatalf("palette: %v", err)
+	}
+	if len(sw) < 2 {
+		t.Fatalf("expected at least 2 swatches, got %d", len(sw))
+	}
+	var total float64
+	for _, s := range sw {
+		total += s.Share
+	}
+	if total < 0.999 || total > 1.001 {
+		t.Fatalf("shares sum to %f", total)
+	}
+	// JPEG chroma subsampling shifts colours and adds small edge clusters;
+	// the two real colours still dominate
+	if !near(sw[0].Color, color.RGBA{R: 220, G: 30, B: 30}, 30) || sw[0].Share < 0.6 {
+		t.Fatalf("unexpected main swatch %+v", sw[0])
+	}
+	if !near(sw[1].Color, color.RGBA{R: 20, G: 40, B: 200}, 30) || sw[1].Share < 0.15 {
+		t.Fatalf("unexpected second swatch %+v", sw[1])
+	}
+
+	js, err := json.Marshal(sw[:1])
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var back []map[string]any
+	if err := json.Unmarshal(js, &back); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if back[0]["hex"] != sw[0].Hex || len(sw[0].Hex) != 7 {
+		t.Fatalf("unexpected json %s", js)
+	}
+
+	if _, err := palette.Palette([]byte("nope"), palette.Options{}); err == nil {
+		t.Fatalf("expected decode error")
+	}
+}
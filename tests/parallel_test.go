@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/rotate"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// Rotation output must not depend on the worker limit.
+func TestParallel_RotateMatchesSerial(t *testing.T) {
+	defer imageops.SetMaxProcs(0)
+	in := tests.ToJPEGBytes(t, tests.Gradient(640, 360), 90)
+
+	imageops.SetMaxProcs(1)
+	serial, err := rotate.Rotate(in, rotate.Options{Mode: rotate.Rotate90CW, Quality: 90})
+	if err != nil {
+		t.Fatalf("rotate serial: %v", err)
+	}
+
+	imageops.SetMaxProcs(8)
+	par, err := rotate.Rotate(in, rotate.Options{Mode: rotate.Rotate90CW, Quality: 90})
+	if err != nil {
+		t.Fatalf("rotate parallel: %v", err)
+	}
+
+	if string(serial) != string(par) {
+		t.Fatalf("parallel rotation differs from serial output")
+	}
+	w, h := tests.ImgWH(t, par)
+	if w != 360 || h != 640 {
+		t.Fatalf("unexpected size: got=%dx%d want=360x640", w, h)
+	}
+}
+
+// Resampling gives the same bytes for every worker limit, in both pass
+// orders.
+func TestParallel_ResizeMatchesSerial(t *testing.T) {
+	defer imageops.SetMaxProcs(0)
+	in := tests.ToJPEGBytes(t, tests.Gradient(1200, 900), 95)
+	for _, opt := range []resize.Options{
+		{Mode: resize.ModeStretch, Width: 800, Height: 450, Quality: 100},
+		{Mode: resize.ModeStretch, Width: 500, Height: 800, Quality: 100},
+	} {
+		var first []byte
+		for _, n := range []int{1, 3, 8} {
+			imageops.SetMaxProcs(n)
+			if got := imageops.MaxProcs(); got != n {
+				t.Fatalf("MaxProcs: got=%d want=%d", got, n)
+			}
+			out, err := resize.Resize(in, opt)
+			if err != nil {
+				t.Fatalf("resize with %d workers: %v", n, err)
+			}
+			if first == nil {
+				first = out
+			} else if !bytes.Equal(first, out) {
+				t.Errorf("%dx%d: %d workers differ from 1", opt.Width, opt.Height, n)
+			}
+		}
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,302 @@
+package tests
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/cli"
+	"github.com/HumbleLines/imgpipe/pkg/exif"
+	"github.com/HumbleLines/imgpipe/pkg/recipe"
+	"github.com/HumbleLines/imgpipe/pkg/rotate"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+const recipeYAML = `
+# social card
+thumb:
+  - op: auto-orient
+  - op: resize
+    mode: fill
+    width: 80
+    height: 45
+  - op: watermark
+    text: "© {width}px"   # comments after values are fine
+    anchor: top-left
+    opacity: 0.8
+  - op: redact
+    method: fill
+    regions: [[0, 0, 10, 10], [[20, 20], [30, 20], [25, 30]]]
+  - op: convert
+    format: png
+`
+
+const recipeJSON = `{
+  "thumb": [
+    {"op": "auto-orient"},
+    {"op": "resize", "mode": "fill", "width": 80, "height": 45},
+    {"op": "watermark", "text": "© {width}px", "anchor": "top-left", "opacity": 0.8},
+    {"op": "redact", "method": "fill", "regions": [[0, 0, 10, 10], [[20, 20], [30, 20], [25, 30]]]},
+    {"op": "convert", "format": "png"}
+  ]
+}`
+
+const recipeTOML = `
+# social card
+[[thumb]]
+op = "auto-orient"
+
+[[thumb]]
+op = "resize"
+mode = "fill"
+width = 80
+height = 45
+
+[[thumb]]
+op = "watermark"
+text = "© {width}px"
+anchor = 'top-left'
+opacity = 0.8
+
+[[thumb]]
+op = "redact"
+method = "fill"
+regions = [
+  [0, 0, 10, 10],
+  [[20, 20], [30, 20], [25, 30]],
+]
+
+[[thumb]]
+op = "convert"
+format = "png"
+`
+
+func TestRecipe_Formats(t *testing.T) {
+	var want []recipe.Step
+	for _, c := range []struct{ format, doc string }{
+		{"yaml", recipeYAML}, {"json", recipeJSON}, {"toml", recipeTOML}, {"", recipeTOML},
+	} {
+		book, err := recipe.Parse([]byte(c.doc), c.format)
+		if err != nil {
+			t.Fatalf("%s: %v", c.format, err)
+		}
+		r := book["thumb"]
+		if r == nil || len(r.Steps) != 5 {
+			t.Fatalf("%s: got %+v", c.format, book)
+		}
+		steps := append([]recipe.Step(nil), r.Steps...)
+		for i := range steps {
+			steps[i].Line = 0
+		}
+		if want == nil {
+			want = steps
+		} else if !reflect.DeepEqual(steps, want) {
+			t.Fatalf("%s: steps differ\n got %#v\nwant %#v", c.format, steps, want)
+		}
+
+		out, err := r.Run(tests.ToJPEGBytes(t, tests.Gradient(160, 120), 90))
+		if err != nil {
+			t.Fatalf("%s: run: %v", c.format, err)
+		}
+		img, format := tests.AssertDecodable(t, out)
+		if format != "png" || img.Bounds().Dx() != 80 || img.Bounds().Dy() != 45 {
+			t.Fatalf("%s: got %s %v", c.format, format, img.Bounds())
+		}
+	}
+	book, _ := recipe.Parse([]byte(recipeYAML), "yaml")
+	if got := book["thumb"].Steps[1].Line; got != 5 {
+		t.Fatalf("resize step line: got %d, want 5", got)
+	}
+}
+
+func TestRecipe_Errors(t *testing.T) {
+	book, err := recipe.Parse([]byte(`
+web:
+  - op: resize
+    width: 800
+    hieght: 450
+  - op: sharpen-more
+  - op: convert
+    format: webp
+  - op: grade
+    kind: sepia
+    amount: lots
+`), "yaml")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	_, err = book["web"].Compile()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{
+		`recipe "web": step 1 (resize) at line 3: unknown parameter "hieght"`,
+		`step 2 (sharpen-more) at line 6: unknown op "sharpen-more"`,
+		`step 3 (convert) at line 7: unsupported format "webp"`,
+		`step 4 (grade) at line 9: amount: want a number, got "lots"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+	var se *recipe.StepError
+	if !errors.As(err, &se) || se.Step != 1 || se.Op != "resize" {
+		t.Fatalf("errors.As: got %+v", se)
+	}
+
+	// errors while running name the step too
+	ok, _ := recipe.Parse([]byte(`{"x": [{"op": "compress"}, {"op": "rotate", "degrees": 90}]}`), "")
+	if _, err := ok["x"].Run([]byte("not an image")); !errors.As(err, &se) || se.Step != 1 ||
+		strings.Count(err.Error(), "step 1") != 1 {
+		t.Fatalf("run error: %v", err)
+	}
+
+	for doc, line := range map[string]int{
+		"a:\n  - op: resize\n     width: 1\n": 3,
+		"a:\n  - op: \"abc\n":                 2,
+		"[[a]]\nop = resize\n":                2,
+	} {
+		_, err := recipe.Parse([]byte(doc), "")
+		var syn *recipe.SyntaxError
+		if !errors.As(err, &syn) || syn.Line != line {
+			t.Errorf("%q: got %v, want an error at line %d", doc, err, line)
+		}
+	}
+}
+
+func TestRecipe_AutoOrient(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			src.Set(x, y, color.RGBA{R: 255, A: 255})
+			if x < 20 {
+				src.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	// orientation 6: the camera was turned, the picture must rotate 90° clockwise
+	in, err := exif.Embed(tests.ToJPEGBytes(t, src, 95), orientationTIFF(6))
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	out, err := rotate.AutoOrient(in, 95)
+	if err != nil {
+		t.Fatalf("auto-orient: %v", err)
+	}
+	img, _ := tests.AssertDecodable(t, out)
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w != 20 || h != 40 {
+		t.Fatalf("got %dx%d, want 20x40", w, h)
+	}
+	// the blue left half ends up on top
+	if r, _, b, _ := img.At(10, 5).RGBA(); b>>8 < 200 || r>>8 > 60 {
+		t.Fatalf("top pixel not blue: r=%d b=%d", r>>8, b>>8)
+	}
+
+	upright := tests.ToJPEGBytes(t, src, 95)
+	if out, _ := rotate.AutoOrient(upright, 95); &out[0] != &upright[0] {
+		t.Fatal("upright image should pass through untouched")
+	}
+}
+
+// orientationTIFF is an EXIF block holding only the Orientation tag.
+func orientationTIFF(o uint16) []byte {
+	le := binary.LittleEndian
+	b := []byte("II*\x00")
+	b = le.AppendUint32(b, 8)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, 0x0112)
+	b = le.AppendUint16(b, 3) // SHORT
+	b = le.AppendUint32(b, 1)
+	b = le.AppendUint16(b, o)
+	b = le.AppendUint16(b, 0)
+	return le.AppendUint32(b, 0)
+}
+
+func TestRecipe_CLI(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recipes.yaml")
+	if err := os.WriteFile(path, []byte(recipeYAML+"\nbad:\n  - op: resize\n    width: -1\n    height: 10\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	in := tests.ToJPEGBytes(t, tests.Gradient(160, 120), 90)
+
+	code, out, stderr := runCLI(in, "run", "-f", path, "-r", "thumb")
+	if code != cli.ExitOK {
+		t.Fatalf("run: exit %d: %s", code, stderr)
+	}
+	if w, h := tests.ImgWH(t, out); w != 80 || h != 45 {
+		t.Fatalf("run: got %dx%d", w, h)
+	}
+	if code, out, _ := runCLI(nil, "run", "-f", path, "-list"); code != cli.ExitOK || !strings.Contains(string(out), "thumb: auto-orient -> resize") {
+		t.Fatalf("list: exit %d: %s", code, out)
+	}
+	if code, _, stderr := runCLI(nil, "run", "-f", path, "-check"); code != cli.ExitError || !strings.Contains(stderr, `recipe "bad": step 1 (resize)`) {
+		t.Fatalf("check: exit %d: %s", code, stderr)
+	}
+	if code, _, _ := runCLI(in, "run", "-f", path); code != cli.ExitUsage {
+		t.Fatalf("ambiguous recipe: exit %d", code)
+	}
+	if code, _, _ := runCLI(in, "run", "-f", filepath.Join(dir, "missing.toml")); code != cli.ExitIO {
+		t.Fatalf("missing file: exit %d", code)
+	}
+}
+
+func TestRecipe_RelativeFiles(t *testing.T) {
+	dir := t.TempDir()
+	mark := tests.ToJPEGBytes(t, tests.Gradient(20, 20), 90)
+	if err := os.WriteFile(filepath.Join(dir, "mark.jpg"), mark, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "recipes.yaml")
+	if err := os.WriteFile(path, []byte("stamp:\n  - op: watermark\n    image: mark.jpg\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	book, err := recipe.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := book.Validate(); err != nil {
+		t.Fatalf("image next to the recipe file: %v", err)
+	}
+	if book["stamp"].Dir = ""; book.Validate() == nil {
+		t.Fatal("without Dir the image should resolve against the working directory")
+	}
+}
+
+func TestRecipe_YAMLAnchors(t *testing.T) {
+	book, err := recipe.Parse([]byte(`
+small: &small
+  - op: resize
+    <<: &box {width: 40, height: 30}
+large:
+  - op: resize
+    <<: *box
+    width: 80
+copy: *small
+---
+turn:
+  - op: rotate
+    degrees: 90
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]int64{"small": 40, "large": 80, "copy": 40} {
+		r := book[name]
+		if r == nil || len(r.Steps) != 1 || r.Steps[0].Params["width"] != want || r.Steps[0].Params["height"] != int64(30) {
+			t.Errorf("%s: got %+v", name, r)
+		}
+	}
+	if book["turn"] == nil {
+		t.Error("recipes of the second document are missing")
+	}
+	if _, err := recipe.Parse([]byte("a:\n  - op: resize\n---\na:\n  - op: rotate\n"), "yaml"); err == nil {
+		t.Error("a recipe defined in two documents should be rejected")
+	}
+}
@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/exif"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/redact"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// checker is a 4px black/white checkerboard.
+func checker(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x/4+y/4)%2 == 0 {
+				img.SetRGBA(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestRedact_Methods(t *testing.T) {
+	src := checker(100, 100)
+	box := []redact.Region{{Rect: image.Rect(20, 20, 60, 60)}}
+
+	fill := redact.Apply(src, redact.Options{Regions: box, Method: redact.Fill, Color: color.RGBA{R: 255, A: 255}})
+	if fill.RGBAAt(40, 40) != (color.RGBA{R: 255, A: 255}) {
+		t.Fatalf("fill: got %v inside", fill.RGBAAt(40, 40))
+	}
+	if fill.RGBAAt(10, 10) != src.RGBAAt(10, 10) || fill.RGBAAt(60, 60) != src.RGBAAt(60, 60) {
+		t.Fatalf("fill leaked outside the region")
+	}
+
+	// a translucent fill colour is drawn opaque
+	half := redact.Apply(src, redact.Options{Regions: box, Method: redact.Fill, Color: color.RGBA{R: 128, A: 128}})
+	if half.RGBAAt(40, 40) != (color.RGBA{R: 255, A: 255}) || half.RGBAAt(44, 44) != half.RGBAAt(40, 40) {
+		t.Fatalf("translucent fill: got %v and %v inside", half.RGBAAt(40, 40), half.RGBAAt(44, 44))
+	}
+
+	blur := redact.Apply(src, redact.Options{Regions: box, Method: redact.Blur})
+	for _, p := range []image.Point{{30, 30}, {41, 37}, {55, 22}} {
+		if v := blur.RGBAAt(p.X, p.Y).R; v < 100 || v > 155 {
+			t.Fatalf("blur: pattern still visible at %v (%d)", p, v)
+		}
+	}
+
+	pix := redact.Apply(src, redact.Options{Regions: box, Method: redact.Pixelate, Strength: 10})
+	if pix.RGBAAt(20, 20) != pix.RGBAAt(29, 29) {
+		t.Fatalf("pixelate: block not uniform")
+	}
+
+	// triangle: the centroid is covered, the opposite corner of its box is not
+	tri := []redact.Region{{Polygon: []image.Point{{20, 20}, {80, 20}, {20, 80}}}}
+	poly := redact.Apply(src, redact.Options{Regions: tri, Method: redact.Fill})
+	if poly.RGBAAt(40, 40) != (color.RGBA{A: 255}) || poly.RGBAAt(44, 36) != (color.RGBA{A: 255}) {
+		t.Fatalf("polygon interior not filled")
+	}
+	if poly.RGBAAt(75, 75) != src.RGBAAt(75, 75) {
+		t.Fatalf("polygon filled outside its edges")
+	}
+
+	// feathering softens the outside edge but keeps the region fully covered
+	white := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for i := range white.Pix {
+		white.Pix[i] = 255
+	}
+	soft := redact.Apply(white, redact.Options{Regions: box, Method: redact.Fill, Feather: 6})
+	if soft.RGBAAt(21, 40).R != 0 {
+		t.Fatalf("feather weakened the region edge: %v", soft.RGBAAt(21, 40))
+	}
+	if v := soft.RGBAAt(18, 40).R; v == 0 || v == 255 {
+		t.Fatalf("expected a soft edge just outside, got %d", v)
+	}
+}
+
+// tiffWithThumb builds a little-endian EXIF block with an Artist tag in
+// IFD0 and a fake preview referenced from IFD1.
+func tiffWithThumb(thumb []byte) []byte {
+	le := binary.LittleEndian
+	b := []byte("II*\x00")
+	b = le.AppendUint32(b, 8)
+	// IFD0 at 8: one entry, next IFD at 26
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, 0x013B) // Artist
+	b = le.AppendUint16(b, 2)
+	b = le.AppendUint32(b, 3)
+	b = append(b, 'm', 'e', 0, 0)
+	b = le.AppendUint32(b, 26)
+	// IFD1 at 26: offset + length of the preview at 56
+	b = le.AppendUint16(b, 2)
+	b = le.AppendUint16(b, 0x0201)
+	b = le.AppendUint16(b, 4)
+	b = le.AppendUint32(b, 1)
+	b = le.AppendUint32(b, 56)
+	b = le.AppendUint16(b, 0x0202)
+	b = le.AppendUint16(b, 4)
+	b = le.AppendUint32(b, 1)
+	b = le.AppendUint32(b, uint32(len(thumb)))
+	b = le.AppendUint32(b, 0)
+	return append(b, thumb...)
+}
+
+// tiffWithPrivate builds a little-endian EXIF block with an Artist tag,
+// a MakerNote holding note in the Exif sub-IFD and a GPS IFD whose
+// latitude is the 24 bytes of lat.
+func tiffWithPrivate(note, lat []byte) []byte {
+	le := binary.LittleEndian
+	entry := func(b []byte, tag, typ uint16, count, value uint32) []byte {
+		b = le.AppendUint16(b, tag)
+		b = le.AppendUint16(b, typ)
+		b = le.AppendUint32(b, count)
+		return le.AppendUint32(b, value)
+	}
+	b := []byte("II*\x00")
+	b = le.AppendUint32(b, 8)
+	// IFD0 at 8: Artist, Exif IFD at 50, GPS IFD at 68
+	b = le.AppendUint16(b, 3)
+	b = append(le.AppendUint16(le.AppendUint16(b, 0x013B), 2), 3, 0, 0, 0, 'm', 'e', 0, 0)
+	b = entry(b, 0x8769, 4, 1, 50)
+	b = entry(b, 0x8825, 4, 1, 68)
+	b = le.AppendUint32(b, 0)
+	// Exif IFD at 50: MakerNote at 86
+	b = le.AppendUint16(b, 1)
+	b = entry(b, 0x927C, 7, uint32(len(note)), 86)
+	b = le.AppendUint32(b, 0)
+	// GPS IFD at 68: GPSLatitude after the note
+	b = le.AppendUint16(b, 1)
+	b = entry(b, 0x0002, 5, 3, uint32(86+len(note)))
+	b = le.AppendUint32(b, 0)
+	b = append(b, note...)
+	return append(b, lat...)
+}
+
+func TestRedact_Metadata(t *testing.T) {
+	thumb := []byte("UNREDACTED-PREVIEW")
+	in, err := exif.Embed(tests.ToJPEGBytes(t, tests.Gradient(64, 64), 90), tiffWithThumb(thumb))
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	opt := redact.Options{Regions: []redact.Region{{Rect: image.Rect(0, 0, 32, 32)}}, Method: redact.Pixelate, Quality: 90}
+
+	out, err := redact.Redact(in, opt)
+	if err != nil {
+		t.Fatalf("redact: %v", err)
+	}
+	tests.AssertDecodable(t, out)
+	tags, err := exif.Decode(out)
+	if err != nil || tags["Artist"] != "me" {
+		t.Fatalf("expected EXIF to be kept, got %v (%v)", tags, err)
+	}
+	if bytes.Contains(out, thumb) {
+		t.Fatalf("embedded preview survived redaction")
+	}
+
+	opt.StripMetadata = true
+	out, err = redact.Redact(in, opt)
+	if err != nil {
+		t.Fatalf("redact: %v", err)
+	}
+	if _, err := exif.Decode(out); !errors.Is(err, exif.ErrNoEXIF) {
+		t.Fatalf("expected no EXIF after StripMetadata, got %v", err)
+	}
+
+	// the MakerNote and the GPS position are dropped too
+	note, lat := []byte("MAKERNOTE-PREVIEW"), []byte("LATITUDE-0123456789ABCDE")
+	in, err = exif.Embed(tests.ToJPEGBytes(t, tests.Gradient(64, 64), 90), tiffWithPrivate(note, lat))
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	opt.StripMetadata = false
+	out, err = redact.Redact(in, opt)
+	if err != nil {
+		t.Fatalf("redact: %v", err)
+	}
+	if tags, err := exif.Decode(out); err != nil || tags["Artist"] != "me" {
+		t.Fatalf("expected EXIF to be kept, got %v (%v)", tags, err)
+	}
+	if bytes.Contains(out, note) || bytes.Contains(out, lat) {
+		t.Fatalf("MakerNote or GPS data survived redaction")
+	}
+
+	// the zero Quality encodes at 85
+	opt.Quality = 0
+	def, err := redact.Handler(opt)(in)
+	if err != nil {
+		t.Fatalf("default quality: %v", err)
+	}
+	opt.Quality = 85
+	if q85, _ := redact.Handler(opt)(in); !bytes.Equal(def, q85) {
+		t.Errorf("Quality 0 did not encode at 85")
+	}
+}
+
+// A huge or NaN Strength is rejected and clamped instead of sizing the blur.
+func TestRedact_StrengthLimit(t *testing.T) {
+	box := []redact.Region{{Rect: image.Rect(2, 2, 6, 6)}}
+	for _, s := range []float64{1e12, math.Inf(1), math.NaN()} {
+		opt := redact.Options{Regions: box, Strength: s}
+		var oe *imgerr.OptionError
+		if err := opt.Validate(); !errors.As(err, &oe) || oe.Field != "Strength" {
+			t.Errorf("strength %g: %v", s, err)
+		}
+		for _, m := range []redact.Method{redact.Blur, redact.Pixelate} {
+			opt.Method = m
+			if out := redact.Apply(checker(8, 8), opt); out.Bounds() != image.Rect(0, 0, 8, 8) {
+				t.Errorf("method %d, strength %g: %v", m, s, out.Bounds())
+			}
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package tests
 
 import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
 	"testing"
 
 	"github.com/HumbleLines/imgpipe/pkg/rotate"
@@ -30,4 +34,35 @@ func TestRotate_90(t *testing.T) {
 		}
 	}
 }
+
+// Rotation reads decoded YCbCr images directly, whatever their origin.
+func TestRotate_Apply(t *testing.T) {
+	dec, err := jpeg.Decode(bytes.NewReader(tests.ToJPEGBytes(t, tests.Gradient(30, 20), 90)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := dec.(*image.YCbCr).SubImage(image.Rect(3, 2, 30, 20))
+	w, h := 27, 18
+	ref := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(ref, ref.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	for name, c := range map[string]struct {
+		got *image.RGBA
+		to  func(x, y int) (int, int)
+	}{
+		"90":     {rotate.Apply(src, rotate.Rotate90CW), func(x, y int) (int, int) { return h - 1 - y, x }},
+		"180":    {rotate.Apply(src, rotate.Rotate180), func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }},
+		"270":    {rotate.Apply(src, rotate.Rotate270CW), func(x, y int) (int, int) { return y, w - 1 - x }},
+		"none":   {rotate.Apply(src, 0), func(x, y int) (int, int) { return x, y }},
+		"exif 7": {rotate.Orient(src, 7), func(x, y int) (int, int) { return h - 1 - y, w - 1 - x }},
+	} {
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if got, want := c.got.RGBAAt(c.to(x, y)), ref.RGBAAt(x, y); got != want {
+					t.Fatalf("%s: pixel %d,%d: got %v, want %v", name, x, y, got, want)
+				}
+			}
+		}
+	}
+}
 // update 28
@@ -0,0 +1,352 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/server"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// newServer serves a directory holding a.jpg (400x300) and b.png (40x30).
+func newServer(t *testing.T, opt server.Options) (*httptest.Server, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	jpg := tests.ToJPEGBytes(t, tests.Gradient(400, 300), 90)
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, tests.Gradient(40, 30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), jpg, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.png"), pngBuf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opt.Root = dir
+	s, err := server.New(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return ts, jpg
+}
+
+func get(t *testing.T, url string, header ...string) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	return res, tests.ReadAll(t, res.Body)
+}
+
+func TestServer_Operations(t *testing.T) {
+	ts, jpg := newServer(t, server.Options{AllowUpload: true})
+
+	cases := []struct {
+		url, accept string
+		ctype       string
+		w, h        int
+	}{
+		{"/resize?src=a.jpg&w=200&h=200&mode=fit", "", "image/jpeg", 200, 150},
+		{"/resize?src=a.jpg&w=100&h=100&mode=fill&fmt=png", "", "image/png", 100, 100},
+		{"/crop?src=a.jpg&x=10&y=20&w=50&h=60", "", "image/jpeg", 50, 60},
+		{"/crop?src=a.jpg&ratio=1:1", "", "image/jpeg", 300, 300},
+		{"/rotate?src=a.jpg&deg=90", "", "image/jpeg", 300, 400},
+		{"/convert?src=b.png", "", "image/png", 40, 30},
+		{"/convert?src=a.jpg", "image/webp,image/png;q=0.9,*/*;q=0.1", "image/png", 400, 300},
+		{"/convert?src=b.png", "image/jpeg", "image/jpeg", 40, 30},
+	}
+	for _, c := range cases {
+		res, body := get(t, ts.URL+c.url, "Accept", c.accept)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", c.url, res.StatusCode, body)
+		}
+		if got := res.Header.Get("Content-Type"); got != c.ctype {
+			t.Errorf("%s: Content-Type %q, want %q", c.url, got, c.ctype)
+		}
+		if w, h := tests.ImgWH(t, body); w != c.w || h != c.h {
+			t.Errorf("%s: got %dx%d, want %dx%d", c.url, w, h, c.w, c.h)
+		}
+		if res.Header.Get("ETag") == "" || res.Header.Get("Cache-Control") == "" {
+			t.Errorf("%s: missing ETag or Cache-Control", c.url)
+		}
+	}
+
+	// uploads
+	res, err := http.Post(ts.URL+"/resize?w=80&h=60&mode=stretch", "image/jpeg", bytes.NewReader(jpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := tests.ReadAll(t, res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("upload: status %d: %s", res.StatusCode, body)
+	}
+	if w, h := tests.ImgWH(t, body); w != 80 || h != 60 {
+		t.Errorf("upload: got %dx%d", w, h)
+	}
+
+	// info
+	res, body = get(t, ts.URL+"/info?src=a.jpg")
+	var info struct {
+		Format        string
+		Width, Height int
+	}
+	if err := json.Unmarshal(body, &info); err != nil || info.Format != "jpeg" || info.Width != 400 || info.Height != 300 {
+		t.Errorf("info: %s (%v)", body, err)
+	}
+}
+
+// Filling a large box from a thin source scales only the visible part
+// instead of the whole source blown up to cover the box.
+func TestServer_ResizeFillThinSource(t *testing.T) {
+	ts, _ := newServer(t, server.Options{AllowUpload: true})
+	var thin bytes.Buffer
+	if err := png.Encode(&thin, tests.Gradient(2, 2000)); err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Post(ts.URL+"/resize?w=2000&h=2000&mode=fill", "image/png", &thin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := tests.ReadAll(t, res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", res.StatusCode, body)
+	}
+	if w, h := tests.ImgWH(t, body); w != 2000 || h != 2000 {
+		t.Errorf("got %dx%d", w, h)
+	}
+}
+
+// A root of "/" serves any absolute path; MaxBytes still applies.
+func TestServer_FilesystemRoot(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpg := tests.ToJPEGBytes(t, tests.Gradient(40, 30), 90)
+	if err := os.WriteFile(filepath.Join(dir, "a.jpg"), jpg, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		max  int64
+		want int
+	}{{0, http.StatusOK}, {int64(len(jpg)) - 1, http.StatusRequestEntityTooLarge}} {
+		s, err := server.New(server.Options{Root: "/", MaxBytes: c.max})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := httptest.NewServer(s)
+		res, body := get(t, ts.URL+"/resize?w=20&h=20&src="+filepath.ToSlash(filepath.Join(dir, "a.jpg")))
+		ts.Close()
+		if res.StatusCode != c.want {
+			t.Errorf("MaxBytes %d: status %d: %s", c.max, res.StatusCode, body)
+		}
+	}
+}
+
+func TestServer_Caching(t *testing.T) {
+	ts, _ := newServer(t, server.Options{CacheControl: "public, max-age=60"})
+	url := ts.URL + "/resize?src=a.jpg&w=100&h=100"
+
+	res, _ := get(t, url)
+	etag := res.Header.Get("ETag")
+	if res.Header.Get("Cache-Control") != "public, max-age=60" || res.Header.Get("Vary") != "Accept" {
+		t.Errorf("headers: %v", res.Header)
+	}
+	res, body := get(t, url, "If-None-Match", etag)
+	if res.StatusCode != http.StatusNotModified || len(body) != 0 {
+		t.Errorf("If-None-Match: status %d, %d bytes", res.StatusCode, len(body))
+	}
+
+	// the ETag does not depend on parameter order but does on values and format
+	res, _ = get(t, ts.URL+"/resize?h=100&w=100&src=a.jpg")
+	if res.Header.Get("ETag") != etag {
+		t.Error("ETag depends on parameter order")
+	}
+	for _, u := range []string{"/resize?src=a.jpg&w=100&h=99", "/resize?src=a.jpg&w=100&h=100&fmt=png"} {
+		if res, _ := get(t, ts.URL+u); res.Header.Get("ETag") == etag {
+			t.Errorf("%s: same ETag as a different result", u)
+		}
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	ts, _ := newServer(t, server.Options{MaxPixels: 100_000, MaxSide: 500})
+
+	cases := []struct {
+		url, accept string
+		status      int
+		msg         string
+	}{
+		{"/resize?src=a.jpg&w=100", "", 400, "w and h"},
+		{"/resize?src=a.jpg&w=600&h=100", "", 400, "exceed 500"},
+		{"/resize?src=a.jpg&w=10&h=10&mode=zoom", "", 400, "unknown mode"},
+		{"/resize?src=a.jpg&w=10&h=10&q=0", "", 400, "q:"},
+		{"/resize?src=a.jpg&w=10&h=10&fmt=webp", "", 400, "fmt: unsupported format"},
+		{"/rotate?src=a.jpg&deg=45", "", 400, "unknown deg"},
+		{"/crop?src=a.jpg&ratio=16", "", 400, "W:H"},
+		{"/convert?src=../secret.jpg", "", 400, "below the root"},
+		{"/convert?src=missing.jpg", "", 404, "not found"},
+		{"/convert?src=b.png", "image/webp", 406, "image/png"},
+		{"/convert?src=a.jpg", "", 413, "pixels"}, // 120000 > 100000
+	}
+	for _, c := range cases {
+		res, body := get(t, ts.URL+c.url, "Accept", c.accept)
+		if res.StatusCode != c.status || !strings.Contains(string(body), c.msg) {
+			t.Errorf("%s: status %d %q, want %d containing %q", c.url, res.StatusCode, body, c.status, c.msg)
+		}
+	}
+
+	// uploads are disabled
+	res, err := http.Post(ts.URL+"/convert", "image/png", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("upload: status %d", res.StatusCode)
+	}
+
+	// oversized and undecodable uploads
+	s, err := server.New(server.Options{AllowUpload: true, MaxBytes: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		body   []byte
+		status int
+	}{
+		{bytes.Repeat([]byte("x"), 1001), http.StatusRequestEntityTooLarge},
+		{[]byte("not an image"), http.StatusUnsupportedMediaType},
+	} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/convert", bytes.NewReader(c.body)))
+		if rec.Code != c.status {
+			t.Errorf("upload of %d bytes: status %d, want %d", len(c.body), rec.Code, c.status)
+		}
+	}
+
+	if _, err := server.New(server.Options{}); err == nil {
+		t.Error("New without sources: no error")
+	}
+}
+
+func TestServer_Signed(t *testing.T) {
+	old, cur := server.Key{ID: "old", Secret: []byte("s1")}, server.Key{ID: "cur", Secret: []byte("s2")}
+	ts, _ := newServer(t, server.Options{
+		Keys:    []server.Key{cur, old},
+		Presets: map[string]string{"thumb": "resize?w=40&h=40&mode=fill", "small": "resize?w=20&h=20"},
+	})
+	params := url.Values{"src": {"a.jpg"}, "w": {"50"}, "h": {"50"}}
+	hour := time.Now().Add(time.Hour)
+
+	ok := []string{
+		server.Sign(cur, "/resize", params, hour),
+		server.Sign(old, "/resize", params, time.Time{}),                              // rotated out, still listed
+		server.Sign(server.Key{Secret: []byte("s1")}, "/resize", params, time.Time{}), // no kid: every key is tried
+		server.Sign(cur, "/resize", url.Values{"src": {"a.jpg"}, "preset": {"thumb"}}, hour),
+		server.Sign(cur, "/info", url.Values{"src": {"a.jpg"}}, hour),
+	}
+	for _, u := range ok {
+		if res, body := get(t, ts.URL+u); res.StatusCode != http.StatusOK {
+			t.Errorf("%s: status %d: %s", u, res.StatusCode, body)
+		}
+	}
+	if _, body := get(t, ts.URL+ok[3]); len(body) > 0 {
+		if w, h := tests.ImgWH(t, body); w != 40 || h != 40 {
+			t.Errorf("preset: got %dx%d", w, h)
+		}
+	}
+
+	signed := server.Sign(cur, "/resize", params, hour)
+	bad := []struct{ url, msg string }{
+		{"/resize?src=a.jpg&w=50&h=50", "unsigned"},
+		{strings.Replace(signed, "w=50", "w=500", 1), "bad signature"},
+		{signed + "&fmt=png", "bad signature"},
+		{strings.Replace(signed, "/resize", "/crop", 1), "bad signature"},
+		{server.Sign(server.Key{ID: "cur", Secret: []byte("guess")}, "/resize", params, hour), "bad signature"},
+		{server.Sign(server.Key{ID: "gone", Secret: []byte("s1")}, "/resize", params, hour), "unknown key"},
+		{server.Sign(cur, "/resize", params, time.Now().Add(-time.Minute)), "expired"},
+	}
+	for _, c := range bad {
+		res, body := get(t, ts.URL+c.url)
+		if res.StatusCode != http.StatusForbidden || !strings.Contains(string(body), c.msg) {
+			t.Errorf("%s: status %d %q, want 403 containing %q", c.url, res.StatusCode, body, c.msg)
+		}
+	}
+}
+
+func TestServer_Presets(t *testing.T) {
+	ts, _ := newServer(t, server.Options{
+		Presets:     map[string]string{"thumb": "resize?w=40&h=40&mode=fill", "q": "rotate?deg=90"},
+		PresetsOnly: true,
+	})
+	res, body := get(t, ts.URL+"/resize?src=a.jpg&preset=thumb")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("preset: status %d: %s", res.StatusCode, body)
+	}
+	for _, c := range []struct {
+		url    string
+		status int
+	}{
+		{"/resize?src=a.jpg&w=40&h=40", http.StatusForbidden},
+		{"/resize?src=a.jpg&preset=thumb&fmt=png", http.StatusForbidden},
+		{"/resize?src=a.jpg&preset=huge", http.StatusBadRequest},
+		{"/crop?src=a.jpg&preset=thumb", http.StatusBadRequest},
+	} {
+		if res, body := get(t, ts.URL+c.url); res.StatusCode != c.status {
+			t.Errorf("%s: status %d %q, want %d", c.url, res.StatusCode, body, c.status)
+		}
+	}
+
+	dir := t.TempDir()
+	for _, opt := range []server.Options{
+		{Root: dir, Presets: map[string]string{"x": "blur?r=2"}},
+		{Root: dir, Presets: map[string]string{"x": "resize?w=10"}},
+		{Root: dir, Presets: map[string]string{"x": "resize?w=10&h=10&src=a.jpg"}},
+		{Root: dir, PresetsOnly: true},
+		{Root: dir, Keys: []server.Key{{ID: "k"}}},
+	} {
+		if _, err := server.New(opt); err == nil {
+			t.Errorf("New(%+v): no error", opt)
+		}
+	}
+}
+
+func TestServer_SignCLI(t *testing.T) {
+	keys := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(keys, []byte("# current first\ncur s2\nold s1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, out, stderr := runCLI(nil, "sign", "-keys", keys, "-ttl", "1h", "/resize?src=a.jpg&w=50&h=50")
+	if code != 0 {
+		t.Fatalf("sign: exit %d: %s", code, stderr)
+	}
+	ts, _ := newServer(t, server.Options{Keys: []server.Key{{ID: "cur", Secret: []byte("s2")}}})
+	u := strings.TrimSpace(string(out))
+	if res, body := get(t, ts.URL+u); res.StatusCode != http.StatusOK {
+		t.Errorf("%s: status %d: %s", u, res.StatusCode, body)
+	}
+	if code, _, _ := runCLI(nil, "sign", "/resize?w=1"); code != 2 {
+		t.Errorf("sign without keys: exit %d", code)
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HumbleLines/imgpipe/pkg/exif"
+	"github.com/HumbleLines/imgpipe/pkg/watermark"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// EXIF fields, dimensions, caller vars and time specs all expand.
+func TestTemplate_Expand(t *testing.T) {
+	img := tests.Gradient(320, 200)
+	in := tests.WithEXIF(t, tests.ToJPEGBytes(t, img, 90),
+		map[uint16]string{0x013B: "Jane Roe"},
+		map[uint16]string{0x9003: "2021:07:04 10:30:00"},
+	)
+
+	tags, err := exif.Decode(in)
+	if err != nil {
+		t.Fatalf("exif: %v", err)
+	}
+	if tags["Artist"] != "Jane Roe" {
+		t.Fatalf("artist: got %q", tags["Artist"])
+	}
+
+	ctx := watermark.NewTemplateContext(in, img, "jpeg", map[string]string{"filename": "beach.jpg"})
+	ctx.Now = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	cases := map[string]string{
+		"© {exif.Artist} {exif.DateTimeOriginal:2006}": "© Jane Roe 2021",
+		"{width}x{height}":           "320x200",
+		"{filename} {now:Jan 2006}":  "beach.jpg Jan 2024",
+		"{width:%05d} {exif.Model}|": "00320 |",
+		"{filename:%.5s} {width:%x}": "beach 140",
+		"{width:%d%%}":               "320%",
+		"{{literal}}":                "{literal}",
+		"{missing} {width":           "{missing} {width",
+		"x} {draft {width}}":         "x} {draft 320}",
+	}
+	for in, want := range cases {
+		got, err := watermark.ExpandText(in, ctx)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%q: got %q want %q", in, got, want)
+		}
+	}
+
+	for _, bad := range []string{
+		"{format:2006}", "{bytes:06d}", "{format:%d}", "{width:%s}", "{filename:%5.2f}",
+		"{width:%d%d}", "{width:%*d}", "{width:%[1]d}", "{width:%05}",
+	} {
+		if _, err := watermark.ExpandText(bad, ctx); err == nil {
+			t.Fatalf("%q: expected error", bad)
+		}
+	}
+}
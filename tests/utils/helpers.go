@@ -2,13 +2,16 @@ package tests
 
 import (
 	"bytes"
+	"encoding/binary"
 	"image"
+	"image/color"
 	_ "image/gif"
 	"image/jpeg"
 	_ "image/png"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 )
 
@@ -87,5 +90,96 @@ func ReadAll(t *testing.T, r io.Reader) []byte {
 	}
 	return b
 }
+// Gradient builds a deterministic w x h test image with a colour ramp on
+// both axes, for tests that should not depend on fixture files.
+func Gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(x * 255 / max(1, w-1)),
+				G: uint8(y * 255 / max(1, h-1)),
+				B: uint8((x + y) * 255 / max(1, w+h-2)),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// WithEXIF inserts an APP1 EXIF segment after the SOI marker of a JPEG.
+// ifd0 and sub hold ASCII values keyed by tag id for IFD0 and the Exif
+// sub-IFD respectively.
+func WithEXIF(t *testing.T, jpg []byte, ifd0, sub map[uint16]string) []byte {
+	t.Helper()
+	if len(jpg) < 2 || jpg[0] != 0xFF || jpg[1] != 0xD8 {
+		t.Fatalf("WithEXIF: not a jpeg")
+	}
+	le := binary.LittleEndian
+
+	// layout: header(8) | IFD0 | sub-IFD | string data
+	ifdSize := func(n int) int { return 2 + 12*n + 4 }
+	n0 := len(ifd0)
+	if len(sub) > 0 {
+		n0++
+	}
+	subOff := 8 + ifdSize(n0)
+	dataOff := subOff + ifdSize(len(sub))
+
+	var data []byte
+	writeIFD := func(tags map[uint16]string, extra func(b []byte) []byte) []byte {
+		keys := make([]int, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, int(k))
+		}
+		sort.Ints(keys)
+		cnt := len(keys)
+		if extra != nil {
+			cnt++
+		}
+		b := le.AppendUint16(nil, uint16(cnt))
+		for _, k := range keys {
+			v := append([]byte(tags[uint16(k)]), 0)
+			b = le.AppendUint16(b, uint16(k))
+			b = le.AppendUint16(b, 2) // ASCII
+			b = le.AppendUint32(b, uint32(len(v)))
+			if len(v) <= 4 {
+				b = append(b, append(v, make([]byte, 4-len(v))...)...)
+			} else {
+				b = le.AppendUint32(b, uint32(dataOff+len(data)))
+				data = append(data, v...)
+			}
+		}
+		if extra != nil {
+			b = extra(b)
+		}
+		return le.AppendUint32(b, 0)
+	}
+
+	tiff := []byte("II*\x00")
+	tiff = le.AppendUint32(tiff, 8)
+	tiff = append(tiff, writeIFD(ifd0, func(b []byte) []byte {
+		if len(sub) == 0 {
+			return b
+		}
+		b = le.AppendUint16(b, 0x8769)
+		b = le.AppendUint16(b, 4) // LONG
+		b = le.AppendUint32(b, 1)
+		return le.AppendUint32(b, uint32(subOff))
+	})...)
+	if len(sub) > 0 {
+		tiff = append(tiff, writeIFD(sub, nil)...)
+	} else {
+		tiff = append(tiff, make([]byte, ifdSize(0))...)
+	}
+	tiff = append(tiff, data...)
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(seg)+2))
+	out = append(out, seg...)
+	return append(out, jpg[2:]...)
+}
+
 // update 48
 // update 49
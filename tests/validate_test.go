@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"errors"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/adjust"
+	"github.com/HumbleLines/imgpipe/pkg/batch"
+	"github.com/HumbleLines/imgpipe/pkg/border"
+	"github.com/HumbleLines/imgpipe/pkg/cli"
+	"github.com/HumbleLines/imgpipe/pkg/compress"
+	"github.com/HumbleLines/imgpipe/pkg/convert"
+	"github.com/HumbleLines/imgpipe/pkg/crop"
+	"github.com/HumbleLines/imgpipe/pkg/filter"
+	"github.com/HumbleLines/imgpipe/pkg/grade"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
+	"github.com/HumbleLines/imgpipe/pkg/palette"
+	"github.com/HumbleLines/imgpipe/pkg/redact"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/rotate"
+	"github.com/HumbleLines/imgpipe/pkg/server"
+	"github.com/HumbleLines/imgpipe/pkg/validate"
+	"github.com/HumbleLines/imgpipe/pkg/variant"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+// capture returns a lenient policy collecting its warnings in got.
+func capture(got *[]string) validate.Policy {
+	return validate.Policy{Warn: func(msg string) { *got = append(*got, msg) }}
+}
+
+func TestValidate_Options(t *testing.T) {
+	box := image.Rect(0, 0, 10, 10)
+	cases := []struct {
+		name  string
+		err   error
+		field string // "" -> valid
+	}{
+		{"resize ok", resize.Options{Mode: resize.ModeFit, Width: 10, Height: 10, Quality: 80}.Validate(), ""},
+		{"resize stretch to 0", resize.Options{Mode: resize.ModeStretch, Height: 10, Quality: 80}.Validate(), "Width"},
+		{"resize unknown mode", resize.Options{Mode: 9, Width: 10, Height: 10, Quality: 80}.Validate(), "Mode"},
+		{"crop ratio", crop.Options{Mode: crop.ModeCenterRatio, RatioW: 16, RatioH: 9, Quality: 80}.Validate(), ""},
+		{"crop rect with ratio", crop.Options{Mode: crop.ModeRect, Width: 5, Height: 5, RatioW: 1, Quality: 80}.Validate(), "RatioW"},
+		{"crop ratio with rect", crop.Options{Mode: crop.ModeCenterRatio, RatioW: 1, RatioH: 1, Width: 5, Quality: 80}.Validate(), "Width"},
+		{"rotate unknown mode", rotate.Options{Quality: 80}.Validate(), "Mode"},
+		{"border ok", (border.Options{Mode: border.Outset, Thickness: 4, Quality: 80}).Validate(), ""},
+		{"border negative thickness", (border.Options{Mode: border.Inset, Thickness: -3, Quality: 80}).Validate(), "Thickness"},
+		{"border negative side", (border.Options{Mode: border.Inset, Sides: border.Sides{Top: 2, Left: -1}, Quality: 80}).Validate(), "Sides"},
+		{"border format", (border.Options{Mode: border.Inset, Thickness: 1, Format: "gif", Quality: 80}).Validate(), "Format"},
+		{"convert png", convert.Options{To: "PNG"}.Validate(), ""},
+		{"convert webp", convert.Options{To: "webp", Quality: 80}.Validate(), "To"},
+		{"compress quality", compress.Options{Quality: 0}.Validate(), "Quality"},
+		{"adjust range", adjust.Options{Brightness: 2, Quality: 80}.Validate(), "Brightness"},
+		{"filter stray kernel", filter.Options{Kind: filter.Gaussian, Kernel: &filter.Kernel{}, Quality: 80}.Validate(), "Kernel"},
+		{"filter threshold", filter.Options{Kind: filter.Unsharp, Threshold: 300, Quality: 80}.Validate(), "Threshold"},
+		{"grade amount", grade.Options{Kind: grade.Sepia, Amount: 2, Quality: 80}.Validate(), "Amount"},
+		{"redact nothing", redact.Options{Quality: 80}.Validate(), "Regions"},
+		{"redact polygon", redact.Options{Regions: []redact.Region{{Rect: box, Polygon: []image.Point{{1, 1}, {2, 2}}}}, Quality: 80}.Validate(), "Regions[0].Polygon"},
+		{"redact feather", redact.Options{Regions: []redact.Region{{Rect: box}}, Feather: 1000000, Quality: 80}.Validate(), "Feather"},
+		{"palette method", palette.Options{Method: 7}.Validate(), "Method"},
+		{"variant workers", variant.Options{Variants: []variant.Variant{{Name: "a"}}, Workers: -1}.Validate(), "Workers"},
+		{"server limits", server.Options{AllowUpload: true, MaxSide: -1}.Validate(), "MaxSide"},
+	}
+	for _, c := range cases {
+		var oe *imgerr.OptionError
+		switch {
+		case c.field == "" && c.err != nil:
+			t.Errorf("%s: %v", c.name, c.err)
+		case c.field != "" && (!errors.As(c.err, &oe) || oe.Field != c.field || !errors.Is(c.err, imgerr.ErrInvalidOptions)):
+			t.Errorf("%s: want a %s error, got %v", c.name, c.field, c.err)
+		}
+	}
+
+	// options the operations never accept are invalid too
+	if err := (batch.Options{Inputs: []string{"x"}}).Validate(); !errors.Is(err, imgerr.ErrInvalidOptions) {
+		t.Errorf("batch without handler: %v", err)
+	}
+	if err := (server.Options{}).Validate(); !errors.Is(err, imgerr.ErrInvalidOptions) {
+		t.Errorf("server without source: %v", err)
+	}
+}
+
+func TestValidate_Strict(t *testing.T) {
+	var warnings []string
+	in := tests.ToJPEGBytes(t, tests.Gradient(40, 30), 90)
+	stretch := resize.Options{Mode: resize.ModeStretch, Height: 10, Quality: 80, Policy: capture(&warnings)}
+
+	// default: warn and clamp the width to 1
+	out, err := resize.Resize(in, stretch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := tests.ImgWH(t, out); w != 1 || h != 10 {
+		t.Errorf("fallback: got %dx%d", w, h)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "resize: Width: must be positive") {
+		t.Errorf("warnings: %q", warnings)
+	}
+	if _, err := convert.Convert(in, "webp", 80); err != nil {
+		t.Errorf("convert fallback: %v", err)
+	}
+
+	// a handler is validated once, when it is built
+	warnings = nil
+	h := adjust.Handler(adjust.Options{Brightness: 2, Policy: capture(&warnings)})
+	for i := 0; i < 3; i++ {
+		if _, err := h(in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(warnings) != 1 {
+		t.Errorf("handler warned %d times", len(warnings))
+	}
+
+	warnings = nil
+	stretch.Policy.Strict = true
+	_, err = resize.Resize(in, stretch)
+	var oe *imgerr.OpError
+	var fe *imgerr.OptionError
+	if !errors.As(err, &oe) || oe.Op != "resize" || !errors.As(err, &fe) || fe.Field != "Width" {
+		t.Errorf("strict resize: %v", err)
+	}
+	strict := validate.Policy{Strict: true, Warn: stretch.Policy.Warn}
+	if _, err := border.Border(in, border.Options{Mode: border.Outset, Thickness: -2, Quality: 80, Policy: strict}); !errors.Is(err, imgerr.ErrInvalidOptions) {
+		t.Errorf("strict border: %v", err)
+	}
+	if _, err := resize.Resize(in, resize.Options{Mode: resize.ModeFit, Width: 20, Height: 20, Quality: 80, Policy: strict}); err != nil {
+		t.Errorf("strict, valid options: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("strict mode warned: %q", warnings)
+	}
+}
+
+func TestValidate_CLI(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(40, 30), 90)
+	code, _, stderr := runCLI(in, "border", "-t", "0")
+	if code != cli.ExitOK || !strings.Contains(stderr, "imgpipe border: warning: border: Thickness: must be positive") {
+		t.Errorf("border -t 0: exit %d: %s", code, stderr)
+	}
+	code, _, stderr = runCLI(in, "border", "-strict", "-t", "0")
+	if code != cli.ExitError || !strings.Contains(stderr, "Thickness: must be positive") {
+		t.Errorf("border -strict -t 0: exit %d: %s", code, stderr)
+	}
+}
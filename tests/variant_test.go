@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+
+	"github.com/HumbleLines/imgpipe/pkg/crop"
+	"github.com/HumbleLines/imgpipe/pkg/exif"
+	"github.com/HumbleLines/imgpipe/pkg/resize"
+	"github.com/HumbleLines/imgpipe/pkg/variant"
+	tests "github.com/HumbleLines/imgpipe/tests/utils"
+)
+
+func TestVariant_Generate(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(400, 300), 92)
+	var vs []variant.Variant
+	for _, w := range []int{320, 160, 80} {
+		for _, f := range []string{"jpeg", "png"} {
+			vs = append(vs, variant.Variant{
+				Name:    f + "-" + string(rune('0'+w/80)),
+				Resize:  &resize.Options{Mode: resize.ModeFit, Width: w, Height: w},
+				Format:  f,
+				Quality: 80,
+			})
+		}
+	}
+	vs = append(vs, variant.Variant{
+		Name:   "square",
+		Crop:   &crop.Options{Mode: crop.ModeCenterRatio, RatioW: 1, RatioH: 1},
+		Resize: &resize.Options{Mode: resize.ModeStretch, Width: 64, Height: 64},
+	})
+
+	m, err := variant.Generate(in, variant.Options{Variants: vs, Workers: 3})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if m.Source.Width != 400 || m.Source.Height != 300 || m.Source.Format != "jpeg" || len(m.Variants) != len(vs) {
+		t.Fatalf("manifest: %+v", m.Source)
+	}
+	for i, o := range m.Variants {
+		if o.Name != vs[i].Name {
+			t.Fatalf("order: got %s at %d, want %s", o.Name, i, vs[i].Name)
+		}
+		img, format := tests.AssertDecodable(t, o.Data)
+		if format != o.Format || img.Bounds().Dx() != o.Width || img.Bounds().Dy() != o.Height || len(o.Data) != o.Bytes {
+			t.Fatalf("%s: manifest %+v does not match the data (%s %v)", o.Name, o, format, img.Bounds())
+		}
+		if sum := sha256.Sum256(o.Data); hex.EncodeToString(sum[:]) != o.SHA256 {
+			t.Fatalf("%s: hash mismatch", o.Name)
+		}
+	}
+	if o := m.Get("jpeg-4"); o == nil || o.Width != 320 || o.Height != 240 {
+		t.Fatalf("jpeg-4: %+v", o)
+	}
+	if o := m.Get("square"); o == nil || o.Width != 64 || o.Height != 64 || o.Format != "jpeg" {
+		t.Fatalf("square: %+v", o)
+	}
+
+	// a variant matches the single-operation result
+	one, err := resize.Resize(in, resize.Options{Mode: resize.ModeFit, Width: 160, Height: 160, Quality: 80})
+	if err != nil {
+		t.Fatalf("resize: %v", err)
+	}
+	if w, h := tests.ImgWH(t, one); w != m.Get("jpeg-2").Width || h != m.Get("jpeg-2").Height {
+		t.Fatalf("resize.Resize gave %dx%d", w, h)
+	}
+
+	b, _ := json.Marshal(m)
+	if !strings.Contains(string(b), `"sha256":"`) || strings.Contains(string(b), `"Data"`) {
+		t.Fatalf("json: %s", b)
+	}
+}
+
+func TestVariant_Errors(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(40, 30), 90)
+	for _, c := range []struct {
+		vs   []variant.Variant
+		want string
+	}{
+		{nil, "no variants"},
+		{[]variant.Variant{{Name: "a"}, {Name: "a"}}, `"a": duplicate name`},
+		{[]variant.Variant{{Name: "a", Format: "webp"}}, `"a": unsupported format "webp"`},
+		{[]variant.Variant{{Name: "a", Resize: &resize.Options{Mode: resize.ModeFit}}}, "must be positive"},
+	} {
+		if _, err := variant.Generate(in, variant.Options{Variants: c.vs}); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("got %v, want %q", err, c.want)
+		}
+	}
+}
+
+func TestVariant_AutoOrient(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 60, 20)), nil); err != nil {
+		t.Fatal(err)
+	}
+	in, err := exif.Embed(buf.Bytes(), orientationTIFF(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := variant.Generate(in, variant.Options{AutoOrient: true, Variants: []variant.Variant{{Name: "full"}}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if o := m.Variants[0]; o.Width != 20 || o.Height != 60 || m.Source.Width != 20 {
+		t.Fatalf("got %+v source %+v", o, m.Source)
+	}
+}
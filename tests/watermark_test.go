@@ -1,10 +1,25 @@
 package tests
 
 import (
+	"bytes"
+	"errors"
+	"image"
 	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
+
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
 
 	"github.com/HumbleLines/imgpipe/pkg/imageops"
+	"github.com/HumbleLines/imgpipe/pkg/imgerr"
 	"github.com/HumbleLines/imgpipe/pkg/watermark"
 	tests "github.com/HumbleLines/imgpipe/tests/utils"
 )
@@ -33,6 +48,434 @@ func TestWatermark_Text(t *testing.T) {
 
 	tests.AssertDecodable(t, out)
 }
+// An anchored, width-relative logo lands in the same relative spot on
+// targets of different sizes.
+func TestWatermark_ImageAnchor(t *testing.T) {
+	mark := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	draw.Draw(mark, mark.Bounds(), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+
+	opt := watermark.ImageOptions{
+		Opacity:  1,
+		Anchor:   watermark.AnchorBottomRight,
+		Margin:   watermark.Margin{PctX: 0.05, PctY: 0.05},
+		RelWidth: 0.25,
+	}
+	for _, size := range []image.Point{{800, 600}, {400, 300}} {
+		out := watermark.AddImageWatermark(tests.Gradient(size.X, size.Y), mark, opt)
+
+		// mark is 25% of the width, its bottom-right corner 5% from the edges
+		mw, mh := size.X/4, size.X/4/2
+		right, bottom := size.X-size.X/20, size.Y-size.Y/20
+		inside := out.RGBAAt(right-mw/2, bottom-mh/2)
+		if inside.R != 255 || inside.G != 0 {
+			t.Fatalf("%v: expected mark at centre of anchored box, got %v", size, inside)
+		}
+		if outside := out.RGBAAt(right+1, bottom+1); outside.R == 255 && outside.G == 0 {
+			t.Fatalf("%v: mark overflows its margin", size)
+		}
+		if outside := out.RGBAAt(right-mw-2, bottom-mh/2); outside.R == 255 && outside.G == 0 {
+			t.Fatalf("%v: mark wider than RelWidth", size)
+		}
+	}
+}
+
+// Tiled marks cover every quadrant of the image, for both text and logos.
+func TestWatermark_Tiled(t *testing.T) {
+	base := tests.Gradient(600, 400)
+	tile := &watermark.TileOptions{Angle: 30, SpacingX: 40, SpacingY: 30, Stagger: 0.5}
+
+	mark := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	draw.Draw(mark, mark.Bounds(), image.NewUniform(color.RGBA{G: 255, A: 255}), image.Point{}, draw.Src)
+	// both calls draw in place on *image.RGBA inputs, so pass fresh copies
+	logo := watermark.AddImageWatermark(tests.Gradient(600, 400), mark, watermark.ImageOptions{Scale: 1, Opacity: 1, Tile: tile})
+
+	text := watermark.AddTextWatermark(tests.Gradient(600, 400), "imgpipe", watermark.TextOptions{
+		Color:   color.RGBA{G: 255, A: 255},
+		Opacity: 1,
+		Tile:    tile,
+	})
+
+	for name, img := range map[string]*image.RGBA{"image": logo, "text": text} {
+		b := img.Bounds()
+		for _, q := range []image.Rectangle{
+			image.Rect(0, 0, b.Dx()/2, b.Dy()/2),
+			image.Rect(b.Dx()/2, 0, b.Dx(), b.Dy()/2),
+			image.Rect(0, b.Dy()/2, b.Dx()/2, b.Dy()),
+			image.Rect(b.Dx()/2, b.Dy()/2, b.Dx(), b.Dy()),
+		} {
+			changed := 0
+			for y := q.Min.Y; y < q.Max.Y; y++ {
+				for x := q.Min.X; x < q.Max.X; x++ {
+					if img.RGBAAt(x, y) != base.RGBAAt(x, y) {
+						changed++
+					}
+				}
+			}
+			if changed == 0 {
+				t.Fatalf("%s: quadrant %v has no watermark", name, q)
+			}
+		}
+	}
+}
+
+// Tiling a long, thin image does not allocate a square the size of its
+// diagonal, and still covers both ends.
+func TestWatermark_TiledThin(t *testing.T) {
+	dst := image.NewRGBA(image.Rect(0, 0, 4000, 20))
+	mark := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(mark, mark.Bounds(), image.NewUniform(color.RGBA{G: 255, A: 255}), image.Point{}, draw.Src)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	watermark.DrawTiled(dst, mark, watermark.TileOptions{Angle: 45, SpacingX: 4, SpacingY: 4})
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 4<<20 {
+		t.Errorf("allocated %d bytes for a %v image", n, dst.Bounds())
+	}
+	for _, end := range []image.Rectangle{image.Rect(0, 0, 20, 20), image.Rect(3980, 0, 4000, 20)} {
+		covered := false
+		for y := end.Min.Y; y < end.Max.Y; y++ {
+			for x := end.Min.X; x < end.Max.X; x++ {
+				covered = covered || dst.RGBAAt(x, y).A != 0
+			}
+		}
+		if !covered {
+			t.Errorf("no tiles in %v", end)
+		}
+	}
+}
+
+// Each band only walks the grid cells it can see, so the result must not
+// depend on how the image is cut into bands. Negative spacing is invalid.
+func TestWatermark_TiledBands(t *testing.T) {
+	defer imageops.SetMaxProcs(0)
+	mark := tests.Gradient(30, 12)
+	for _, angle := range []float64{0, 30, -75, 180} {
+		opt := watermark.TileOptions{Angle: angle, SpacingX: 10, SpacingY: 6, Stagger: 0.5}
+		imageops.SetMaxProcs(1)
+		serial := image.NewRGBA(image.Rect(0, 0, 700, 500))
+		watermark.DrawTiled(serial, mark, opt)
+		imageops.SetMaxProcs(8)
+		banded := image.NewRGBA(serial.Bounds())
+		watermark.DrawTiled(banded, mark, opt)
+		if !bytes.Equal(serial.Pix, banded.Pix) {
+			t.Errorf("angle %v: banded tiling differs from serial", angle)
+		}
+	}
+
+	in := tests.ToJPEGBytes(t, tests.Gradient(40, 30), 90)
+	spec := watermark.Spec{Layers: []watermark.Layer{{Text: "x", Tile: &watermark.TileOptions{SpacingY: -5}}}}
+	spec.Policy.Strict = true
+	var oe *imgerr.OptionError
+	if _, err := watermark.Watermark(in, spec); !errors.As(err, &oe) || oe.Field != "Layers[0].Tile.SpacingY" {
+		t.Errorf("strict: %v", err)
+	}
+}
+
+// Fonts are parsed once per content and faces are reused per size.
+func TestWatermark_FontCache(t *testing.T) {
+	bold, err := watermark.ParseFont(gobold.TTF)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	again, err := watermark.ParseFont(append([]byte(nil), gobold.TTF...))
+	if err != nil {
+		t.Fatalf("parse again: %v", err)
+	}
+	if bold != again {
+		t.Fatalf("same font bytes were parsed twice")
+	}
+
+	regular, err := watermark.DefaultFont()
+	if err != nil {
+		t.Fatalf("default font: %v", err)
+	}
+	fonts := watermark.FontSet{bold, regular}
+	face, release, err := fonts.Face(24)
+	if err != nil {
+		t.Fatalf("face: %v", err)
+	}
+	if adv, ok := face.GlyphAdvance('A'); !ok || adv <= 0 {
+		t.Fatalf("fallback face has no advance for 'A'")
+	}
+	release()
+
+	in := tests.ToJPEGBytes(t, tests.Gradient(640, 360), 90)
+	out, err := imageops.NewPipeline().
+		Add(imageops.WatermarkText(watermark.TextConfig{Text: "imgpipe", Opacity: 0.8, RelX: 0.5, RelY: 0.5, Fonts: fonts}, 85)).
+		Run(in)
+	if err != nil {
+		t.Fatalf("pipeline: %v", err)
+	}
+	tests.AssertDecodable(t, out)
+}
+
+// Fonts loaded by path are re-read when the file changes, and a face
+// that cannot be built is an error only for AddTextWatermarkErr.
+func TestWatermark_FontReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "brand.ttf")
+	if err := os.WriteFile(path, gobold.TTF, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	first, err := watermark.LoadFont(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if again, _ := watermark.LoadFont(path); again != first {
+		t.Fatal("unchanged file was parsed again")
+	}
+	if err := os.WriteFile(path, goregular.TTF, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := watermark.LoadFont(path); err != nil || reloaded == first {
+		t.Fatalf("changed file: got the cached font (%v)", err)
+	}
+
+	opt := watermark.TextOptions{Fonts: watermark.FontSet{first}, Size: math.NaN(), Opacity: 1}
+	if _, err := watermark.AddTextWatermarkErr(tests.Gradient(60, 30), "x", opt); err == nil {
+		t.Error("NaN size: expected an error")
+	}
+	if out := watermark.AddTextWatermark(tests.Gradient(60, 30), "x", opt); out == nil {
+		t.Error("NaN size: expected a basicfont fallback")
+	}
+}
+
+// The deprecated adapter keeps the first baseline on RelY.
+func TestWatermark_TextBaseline(t *testing.T) {
+	black := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(black, black.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, black); err != nil {
+		t.Fatal(err)
+	}
+	out, err := imageops.WatermarkText(watermark.TextConfig{
+		Text: "HHH", Opacity: 1, RelX: 0.5, RelY: 0.5, FontPt: 30, Color: color.RGBA{R: 255, G: 255, B: 255},
+	}, 95)(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _ := tests.AssertDecodable(t, out)
+	top, bottom := 100, 0
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r>>8 > 128 {
+				top, bottom = min(top, y), max(bottom, y)
+			}
+		}
+	}
+	if bottom < 47 || bottom > 51 || top > 35 {
+		t.Fatalf("text spans rows %d-%d, want it standing on row 50", top, bottom)
+	}
+}
+
+// Every Opacity field treats 0 as opaque.
+func TestWatermark_OpacityZero(t *testing.T) {
+	text := func(o float64) *image.RGBA {
+		return watermark.AddTextWatermark(tests.Gradient(80, 40), "Hi", watermark.TextOptions{X: 5, Y: 20, Opacity: o})
+	}
+	if !bytes.Equal(text(0).Pix, text(1).Pix) {
+		t.Error("TextOptions: opacity 0 is not opaque")
+	}
+
+	green := color.RGBA{G: 255, A: 255}
+	mark := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	draw.Draw(mark, mark.Bounds(), image.NewUniform(green), image.Point{}, draw.Src)
+	logo := watermark.AddImageWatermark(tests.Gradient(80, 40), mark, watermark.ImageOptions{Scale: 1})
+	if got := logo.RGBAAt(5, 5); got != green {
+		t.Errorf("ImageOptions: opacity 0 gives %v", got)
+	}
+
+	cfg := watermark.TextConfig{Text: "x"}
+	if cfg.Sanitize(); cfg.Opacity != 1 {
+		t.Errorf("TextConfig: opacity 0 sanitizes to %v", cfg.Opacity)
+	}
+}
+
+// Right-aligned multi-line text sits on a padded background box.
+func TestWatermark_TextStyle(t *testing.T) {
+	base := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(base, base.Bounds(), image.NewUniform(color.RGBA{R: 128, G: 128, B: 128, A: 255}), image.Point{}, draw.Src)
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	// basicfont glyphs are 7px wide, 13px line height
+	out := watermark.AddTextWatermark(base, "WWWWWW\nW", watermark.TextOptions{
+		X: 40, Y: 30,
+		Color:   white,
+		Opacity: 1,
+		Style: watermark.TextStyle{
+			Align: watermark.AlignRight,
+			Box:   &watermark.Box{Padding: 5, Color: blue},
+		},
+	})
+
+	if got := out.RGBAAt(40-4, 30-11-4); got != blue {
+		t.Fatalf("expected box colour inside padding, got %v", got)
+	}
+	if got := out.RGBAAt(40-6, 30-11-6); got == blue {
+		t.Fatalf("box extends beyond its padding")
+	}
+	// second line: only the last 7px column of the 42px block holds ink
+	for y := 30 + 13 - 10; y < 30+13; y++ {
+		for x := 40; x < 40+42-7; x++ {
+			if out.RGBAAt(x, y) == white {
+				t.Fatalf("right-aligned line has ink at x=%d", x)
+			}
+		}
+	}
+}
+
+// One Spec draws several text and image layers in a single pass.
+func TestWatermark_Spec(t *testing.T) {
+	in := tests.ToJPEGBytes(t, tests.Gradient(800, 600), 92)
+	logo := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	draw.Draw(logo, logo.Bounds(), image.NewUniform(color.RGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+	var logoPNG bytes.Buffer
+	if err := png.Encode(&logoPNG, logo); err != nil {
+		t.Fatalf("png: %v", err)
+	}
+
+	out, err := watermark.Watermark(in, watermark.Spec{
+		Layers: []watermark.Layer{
+			{
+				Text:   "{width}x{height}",
+				Anchor: watermark.AnchorTopLeft,
+				Margin: watermark.Margin{X: 10, Y: 10},
+				Style:  watermark.TextStyle{Box: &watermark.Box{Padding: 6, Color: color.Black}},
+			},
+			{
+				Image:    logoPNG.Bytes(),
+				Anchor:   watermark.AnchorBottomRight,
+				Margin:   watermark.Margin{PctX: 0.02, PctY: 0.02},
+				RelWidth: 0.2,
+			},
+		},
+		Quality: 95,
+	})
+	if err != nil {
+		t.Fatalf("watermark: %v", err)
+	}
+	tests.MustWriteOut(t, "watermark_spec.jpg", out)
+
+	img, _ := tests.AssertDecodable(t, out)
+	if b := img.Bounds(); b.Dx() != 800 || b.Dy() != 600 {
+		t.Fatalf("unexpected size %v", b)
+	}
+	// centre of the 160x80 logo box, 16/12 px from the bottom-right corner
+	r, g, b, _ := img.At(800-16-80, 600-12-40).RGBA()
+	if b>>8 < 200 || r>>8 > 60 || g>>8 > 60 {
+		t.Fatalf("expected blue logo, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+	// the box behind the text starts at the top-left margin
+	r, g, b, _ = img.At(14, 14).RGBA()
+	if r>>8 > 40 || g>>8 > 40 || b>>8 > 40 {
+		t.Fatalf("expected dark box, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+
+	if _, err := watermark.Watermark(in, watermark.Spec{
+		Layers: []watermark.Layer{{Image: []byte("not an image")}},
+	}); err == nil {
+		t.Fatalf("expected error for undecodable mark")
+	}
+	if _, err := watermark.Watermark(in, watermark.Spec{
+		Layers: []watermark.Layer{{Image: bomb(t, 50000, 50000)}},
+	}); !errors.Is(err, imgerr.ErrImageTooLarge) {
+		t.Fatalf("expected the decode limits to apply to the mark, got %v", err)
+	}
+}
+
+func TestWatermark_Blend(t *testing.T) {
+	solid := func(c color.RGBA) *image.RGBA {
+		m := image.NewRGBA(image.Rect(0, 0, 40, 40))
+		draw.Draw(m, m.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		return m
+	}
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	grey := color.RGBA{R: 128, G: 128, B: 128, A: 255}
+	black := color.RGBA{A: 255}
+
+	cases := []struct {
+		name string
+		base color.RGBA
+		mark color.RGBA
+		mode watermark.BlendMode
+		want color.RGBA
+	}{
+		{"multiply white is neutral", grey, white, watermark.BlendMultiply, grey},
+		{"multiply grey darkens", grey, grey, watermark.BlendMultiply, color.RGBA{R: 64, G: 64, B: 64, A: 255}},
+		{"screen black is neutral", grey, black, watermark.BlendScreen, grey},
+		{"difference inverts", black, white, watermark.BlendDifference, white},
+		{"normal replaces", grey, black, watermark.BlendNormal, black},
+	}
+	for _, c := range cases {
+		// AddImageWatermark draws in place on *image.RGBA, so use a fresh base
+		dst := watermark.AddImageWatermark(solid(c.base), solid(c.mark), watermark.ImageOptions{
+			X: 10, Y: 10, Scale: 1, Opacity: 1, Blend: c.mode,
+		})
+		got := dst.RGBAAt(30, 30)
+		if absDiff(uint32(got.R), uint32(c.want.R)) > 1 || absDiff(uint32(got.G), uint32(c.want.G)) > 1 || got.A != c.want.A {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+		if outside := dst.RGBAAt(5, 5); outside != c.base {
+			t.Errorf("%s: pixel outside the mark changed to %v", c.name, outside)
+		}
+	}
+
+	// atop leaves transparent areas of the image transparent
+	clear := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	dst := watermark.AddImageWatermark(clear, solid(white), watermark.ImageOptions{Scale: 1, Opacity: 1, Blend: watermark.BlendAtop})
+	if a := dst.RGBAAt(20, 20).A; a != 0 {
+		t.Fatalf("atop on transparent image: alpha %d, want 0", a)
+	}
+}
+
 // update 38
 // update 39
 // update 29
+
+// The stroke is the glyph mask dilated by a disc of the stroke width, and
+// widths above MaxStroke are rejected or clamped.
+func TestWatermark_Stroke(t *testing.T) {
+	white := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	plain := watermark.RenderLabel("Wg|", basicfont.Face7x13, white, 1, 0, watermark.TextStyle{})
+	const r = 3
+	stroked := watermark.RenderLabel("Wg|", basicfont.Face7x13, white, 1, 0, watermark.TextStyle{Stroke: r})
+	pb, sb := plain.Img.Bounds(), stroked.Img.Bounds()
+	if sb.Dx() != pb.Dx()+2*r || sb.Dy() != pb.Dy()+2*r {
+		t.Fatalf("stroked %v, plain %v", sb, pb)
+	}
+	for y := 0; y < sb.Dy(); y++ {
+		for x := 0; x < sb.Dx(); x++ {
+			var want uint8
+			for dy := -r; dy <= r; dy++ {
+				for dx := -r; dx <= r; dx++ {
+					if dx*dx+dy*dy > r*r {
+						continue
+					}
+					if p := image.Pt(x+dx-r, y+dy-r); p.In(pb) {
+						want = max(want, plain.Img.RGBAAt(p.X, p.Y).A)
+					}
+				}
+			}
+			if got := stroked.Img.RGBAAt(x, y).A; got != want {
+				t.Fatalf("alpha at %d,%d: got %d, want %d", x, y, got, want)
+			}
+		}
+	}
+
+	in := tests.ToJPEGBytes(t, tests.Gradient(40, 30), 90)
+	spec := watermark.Spec{Layers: []watermark.Layer{{Text: "x", Style: watermark.TextStyle{Stroke: 1000000}}}}
+	spec.Policy.Strict = true
+	var oe *imgerr.OptionError
+	if _, err := watermark.Watermark(in, spec); !errors.As(err, &oe) || oe.Field != "Layers[0].Style.Stroke" {
+		t.Errorf("strict: %v", err)
+	}
+	wide := watermark.RenderLabel("x", basicfont.Face7x13, white, 1, 0, watermark.TextStyle{Stroke: 1000000})
+	if w := wide.Img.Bounds().Dx(); w != 7+2*watermark.MaxStroke {
+		t.Errorf("clamped stroke: width %d", w)
+	}
+}
@@ -9,14 +9,30 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 )
 
+// ErrNoKey is returned when no (non-empty) secret is supplied. There is no
+// built-in key: callers own their secrets.
+var ErrNoKey = errors.New("codec: no key")
+
+// Errors returned by DecodeData for data it rejects.
+var (
+	ErrMalformed = errors.New("codec: malformed data")
+	ErrSignature = errors.New("codec: signature mismatch")
+	ErrExpired   = errors.New("codec: data expired")
+)
+
 // EncodeData wraps and encrypts raw data with HMAC, expiration, and optional compression.
 // Used for securely packaging business metadata for archival or cross-component transmission.
-// TTL is in seconds. The output is base64-url encoded, suitable for embedding or transport.
-func EncodeData(raw []byte, ttl int) (string, error) {
+// TTL is in seconds; key is the caller's HMAC secret. The output is base64-url encoded,
+// suitable for embedding or transport.
+func EncodeData(raw []byte, ttl int, key []byte) (string, error) {
+	if len(key) == 0 {
+		return "", ErrNoKey
+	}
 	var buf bytes.Buffer
 	buf.WriteByte(1) // version marker
 	exp := uint32(time.Now().Unix() + int64(ttl))
@@ -29,7 +45,7 @@ func EncodeData(raw []byte, ttl int) (string, error) {
 	w := zlib.NewWriter(&buf)
 	_, _ = w.Write(raw)
 	_ = w.Close()
-	h := hmac.New(sha256.New, []byte("imgpipe"))
+	h := hmac.New(sha256.New, key)
 	h.Write(buf.Bytes())
 	mac := h.Sum(nil)
 	out := append(buf.Bytes(), mac...)
@@ -37,18 +53,33 @@ func EncodeData(raw []byte, ttl int) (string, error) {
 }
 
 // DecodeData verifies HMAC integrity, checks expiry, decompresses and returns the original data.
+// key is the current secret and must not be empty; data signed with any of the older keys is
+// accepted too, so secrets can be rotated (empty older keys are ignored).
 // Only decodes and validates package integrity; does not interpret payload semantics.
 // External callers should handle post-processing according to their own requirements.
-func DecodeData(data string) ([]byte, error) {
+func DecodeData(data string, key []byte, older ...[]byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
 	raw, err := base64.RawURLEncoding.DecodeString(data)
 	if err != nil || len(raw) < 1+4+8+32 {
-		return nil, errors.New("invalid")
+		return nil, ErrMalformed
 	}
 	payload, mac := raw[:len(raw)-32], raw[len(raw)-32:]
-	h := hmac.New(sha256.New, []byte("imgpipe"))
-	h.Write(payload)
-	if !hmac.Equal(mac, h.Sum(nil)) {
-		return nil, errors.New("check failed")
+	ok := false
+	for _, k := range append([][]byte{key}, older...) {
+		if len(k) == 0 {
+			continue
+		}
+		h := hmac.New(sha256.New, k)
+		h.Write(payload)
+		if hmac.Equal(mac, h.Sum(nil)) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return nil, ErrSignature
 	}
 	r := bytes.NewReader(payload)
 	var ver byte
@@ -56,14 +87,14 @@ func DecodeData(data string) ([]byte, error) {
 	binary.Read(r, binary.BigEndian, &ver)
 	binary.Read(r, binary.BigEndian, &exp)
 	if uint32(time.Now().Unix()) > exp {
-		return nil, errors.New("failed")
+		return nil, ErrExpired
 	}
 	nonce := make([]byte, 8)
 	r.Read(nonce)
 	compressed, _ := io.ReadAll(r)
 	zr, err := zlib.NewReader(bytes.NewReader(compressed))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
 	}
 	defer zr.Close()
 	return io.ReadAll(zr)